@@ -0,0 +1,205 @@
+package gosound
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gotracker/gomixing/mixing"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrFormatNotSupported is returned when the requested format is not supported by the device
+	ErrFormatNotSupported = errors.New("format not supported")
+)
+
+// StreamFormat is the format of the audio stream sent to an output device
+type StreamFormat struct {
+	Channels         int
+	SamplesPerSecond int
+	BitsPerSample    int
+	SampleFormat     SampleFormat
+}
+
+func (f StreamFormat) String() string {
+	return fmt.Sprintf("%dch %dHz %v", f.Channels, f.SamplesPerSecond, f.SampleFormat)
+}
+
+// Capabilities is the set of stream formats supported by an output device
+type Capabilities struct {
+	Channels            []int
+	MinSamplesPerSecond int
+	MaxSamplesPerSecond int
+	// SampleRates, when set, are the only sample rates supported
+	SampleRates   []int
+	SampleFormats []SampleFormat
+}
+
+func (c Capabilities) String() string {
+	if len(c.SampleRates) > 0 {
+		return fmt.Sprintf("channels %v, %vHz, sample formats %v", c.Channels, c.SampleRates, c.SampleFormats)
+	}
+	return fmt.Sprintf("channels %v, %d-%dHz, sample formats %v", c.Channels, c.MinSamplesPerSecond, c.MaxSamplesPerSecond, c.SampleFormats)
+}
+
+// Supports returns true if the stream format is supported
+func (c Capabilities) Supports(f StreamFormat) bool {
+	return containsInt(c.Channels, f.Channels) &&
+		containsSampleFormat(c.SampleFormats, f.SampleFormat) &&
+		f.SamplesPerSecond >= c.MinSamplesPerSecond &&
+		f.SamplesPerSecond <= c.MaxSamplesPerSecond &&
+		(len(c.SampleRates) == 0 || containsInt(c.SampleRates, f.SamplesPerSecond))
+}
+
+// Closest returns the supported stream format that is closest to the one provided
+func (c Capabilities) Closest(f StreamFormat) StreamFormat {
+	sampleFormat := closestSampleFormat(c.SampleFormats, f.SampleFormat)
+	out := StreamFormat{
+		Channels:         closestInt(c.Channels, f.Channels),
+		SamplesPerSecond: f.SamplesPerSecond,
+		BitsPerSample:    sampleFormat.BitsPerSample(),
+		SampleFormat:     sampleFormat,
+	}
+	if len(c.SampleRates) > 0 {
+		out.SamplesPerSecond = closestInt(c.SampleRates, f.SamplesPerSecond)
+	} else if out.SamplesPerSecond < c.MinSamplesPerSecond {
+		out.SamplesPerSecond = c.MinSamplesPerSecond
+	} else if out.SamplesPerSecond > c.MaxSamplesPerSecond {
+		out.SamplesPerSecond = c.MaxSamplesPerSecond
+	}
+	return out
+}
+
+// Negotiate returns the format to use for the requested format. If strict is
+// set, an unsupported format results in an error describing the supported formats.
+func (c Capabilities) Negotiate(f StreamFormat, strict bool) (StreamFormat, error) {
+	if c.Supports(f) {
+		return f, nil
+	}
+	if strict || len(c.Channels) == 0 || len(c.SampleFormats) == 0 {
+		return f, errors.Wrapf(ErrFormatNotSupported, "%v (supported: %v)", f, c)
+	}
+	return c.Closest(f), nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+// closestInt returns the value in the list closest to v, preferring the larger value on a tie
+func closestInt(list []int, v int) int {
+	if len(list) == 0 {
+		return v
+	}
+	sorted := append([]int(nil), list...)
+	sort.Ints(sorted)
+	best := sorted[0]
+	for _, l := range sorted[1:] {
+		if absInt(l-v) <= absInt(best-v) {
+			best = l
+		}
+	}
+	return best
+}
+
+func containsSampleFormat(list []SampleFormat, f SampleFormat) bool {
+	for _, l := range list {
+		if l == f {
+			return true
+		}
+	}
+	return false
+}
+
+// closestSampleFormat returns the sample format in the list closest to f,
+// preferring formats of the same kind (integer or float) over bit depth
+func closestSampleFormat(list []SampleFormat, f SampleFormat) SampleFormat {
+	best := SampleFormatDefault
+	bestScore := math.MaxInt32
+	for _, l := range list {
+		score := absInt(l.BitsPerSample() - f.BitsPerSample())
+		if l.IsFloat() != f.IsFloat() {
+			score += 64
+		}
+		// prefer the larger format on a tie
+		if score < bestScore || (score == bestScore && l.BitsPerSample() > best.BitsPerSample()) {
+			best, bestScore = l, score
+		}
+	}
+	if best == SampleFormatDefault {
+		return f
+	}
+	return best
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// mixerChannels returns the channel counts the mixer is able to pan into
+func mixerChannels() []int {
+	var channels []int
+	for c := 1; c <= 8; c++ {
+		if mixing.GetPanMixer(c) != nil {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+type formatGetter interface {
+	GetStreamFormat() StreamFormat
+}
+
+// GetStreamFormat returns the negotiated stream format of the passed in device
+func GetStreamFormat(d Device) (StreamFormat, bool) {
+	if dev, ok := d.(formatGetter); ok {
+		return dev.GetStreamFormat(), true
+	}
+	return StreamFormat{}, false
+}
+
+// QueryCapabilities returns the capabilities of the device that would be created for the provided settings
+func QueryCapabilities(settings Settings) (Capabilities, error) {
+	details, ok := lookupDevice(settings.Name)
+	if !ok {
+		return Capabilities{}, errors.Wrap(ErrDeviceNotSupported, settings.Name)
+	}
+	return details.capabilities(settings)
+}
+
+func (d deviceDetails) capabilities(settings Settings) (Capabilities, error) {
+	if d.caps == nil {
+		return Capabilities{}, errors.New("device does not report capabilities")
+	}
+	return d.caps(settings)
+}
+
+// negotiateFormat updates the settings to a format supported by the device
+func (d deviceDetails) negotiateFormat(settings Settings) (Settings, error) {
+	if d.caps == nil {
+		return settings, nil
+	}
+	caps, err := d.caps(settings)
+	if err != nil {
+		return settings, err
+	}
+	f, err := caps.Negotiate(settings.streamFormat(), settings.StrictFormat)
+	if err != nil {
+		return settings, errors.Wrap(err, settings.Name)
+	}
+	settings.Channels = f.Channels
+	settings.SamplesPerSecond = f.SamplesPerSecond
+	settings.BitsPerSample = f.BitsPerSample
+	settings.SampleFormat = f.SampleFormat
+	return settings, nil
+}
@@ -0,0 +1,102 @@
+package gosound
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	ranged := Capabilities{
+		Channels:            []int{1, 2},
+		MinSamplesPerSecond: 8000,
+		MaxSamplesPerSecond: 48000,
+		SampleFormats:       []SampleFormat{SampleFormatInt8, SampleFormatInt16, SampleFormatFloat32},
+	}
+	listed := Capabilities{
+		Channels:            []int{2, 4},
+		MinSamplesPerSecond: 32000,
+		MaxSamplesPerSecond: 48000,
+		SampleRates:         []int{32000, 44100, 48000},
+		SampleFormats:       []SampleFormat{SampleFormatInt16, SampleFormatInt24},
+	}
+	format := func(channels int, rate int, sampleFormat SampleFormat) StreamFormat {
+		return StreamFormat{Channels: channels, SamplesPerSecond: rate, BitsPerSample: sampleFormat.BitsPerSample(), SampleFormat: sampleFormat}
+	}
+	for _, tc := range []struct {
+		name string
+		caps Capabilities
+		in   StreamFormat
+		// want is the format negotiated when not strict; a strict negotiation fails unless it is in
+		want StreamFormat
+	}{
+		{"supported", ranged, format(2, 44100, SampleFormatInt16), format(2, 44100, SampleFormatInt16)},
+		{"rate below the range", ranged, format(2, 4000, SampleFormatInt16), format(2, 8000, SampleFormatInt16)},
+		{"rate above the range", ranged, format(2, 96000, SampleFormatInt16), format(2, 48000, SampleFormatInt16)},
+		{"channels", ranged, format(4, 44100, SampleFormatInt16), format(2, 44100, SampleFormatInt16)},
+		{"closest integer format", ranged, format(2, 44100, SampleFormatInt24), format(2, 44100, SampleFormatInt16)},
+		{"integer kept over float", ranged, format(2, 44100, SampleFormatInt32), format(2, 44100, SampleFormatInt16)},
+		{"float, with no float format", listed, format(2, 44100, SampleFormatFloat32), format(2, 44100, SampleFormatInt24)},
+		{"listed rate", listed, format(4, 32000, SampleFormatInt24), format(4, 32000, SampleFormatInt24)},
+		{"rate between listed", listed, format(2, 40000, SampleFormatInt16), format(2, 44100, SampleFormatInt16)},
+		{"rate tied between listed", listed, format(2, 46050, SampleFormatInt16), format(2, 48000, SampleFormatInt16)},
+		{"rate below listed", listed, format(2, 8000, SampleFormatInt16), format(2, 32000, SampleFormatInt16)},
+		{"channels tied", listed, format(3, 44100, SampleFormatInt16), format(4, 44100, SampleFormatInt16)},
+		{"everything", listed, format(1, 11025, SampleFormatInt8), format(2, 32000, SampleFormatInt16)},
+	} {
+		supported := tc.in == tc.want
+		if tc.caps.Supports(tc.in) != supported {
+			t.Errorf("%s: supported is %v", tc.name, !supported)
+		}
+		if got, err := tc.caps.Negotiate(tc.in, false); err != nil || got != tc.want {
+			t.Errorf("%s: negotiated %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+		got, err := tc.caps.Negotiate(tc.in, true)
+		if supported && (err != nil || got != tc.in) {
+			t.Errorf("%s: strict negotiation gave %v, %v", tc.name, got, err)
+		}
+		if !supported && !errors.Is(err, ErrFormatNotSupported) {
+			t.Errorf("%s: strict negotiation gave %v, %v", tc.name, got, err)
+		}
+	}
+
+	// with nothing to fall back on, even a lenient negotiation fails
+	if _, err := (Capabilities{}).Negotiate(format(2, 44100, SampleFormatInt16), false); !errors.Is(err, ErrFormatNotSupported) {
+		t.Errorf("empty capabilities: %v", err)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	d := deviceDetails{caps: func(Settings) (Capabilities, error) {
+		return Capabilities{
+			Channels:            []int{2},
+			MinSamplesPerSecond: 8000,
+			MaxSamplesPerSecond: 48000,
+			SampleFormats:       []SampleFormat{SampleFormatInt16, SampleFormatFloat32},
+		}, nil
+	}}
+	in := Settings{Name: "test", Channels: 6, SamplesPerSecond: 96000, BitsPerSample: 24}
+	got, err := d.negotiateFormat(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Channels != 2 || got.SamplesPerSecond != 48000 || got.BitsPerSample != 16 || got.SampleFormat != SampleFormatInt16 {
+		t.Fatalf("negotiated %+v", got)
+	}
+
+	in.StrictFormat = true
+	if _, err := d.negotiateFormat(in); !errors.Is(err, ErrFormatNotSupported) {
+		t.Fatalf("strict negotiation gave %v", err)
+	}
+
+	// a device that does not report capabilities takes the settings as they are
+	if got, err := (deviceDetails{}).negotiateFormat(in); err != nil || got.Channels != 6 || got.SamplesPerSecond != 96000 {
+		t.Fatalf("negotiated %+v, %v without capabilities", got, err)
+	}
+
+	failing := deviceDetails{caps: func(Settings) (Capabilities, error) {
+		return Capabilities{}, errors.New("no server")
+	}}
+	if _, err := failing.negotiateFormat(in); err == nil {
+		t.Fatal("capabilities error not returned")
+	}
+}
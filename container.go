@@ -0,0 +1,29 @@
+package gosound
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// containerMuxer writes the packets of an encoded audio stream into a container format
+type containerMuxer interface {
+	// writePacket writes a packet holding the number of samples of each channel
+	writePacket(packet []byte, samples int) error
+	// close finishes the container. If the output is seekable, the codec header given
+	// when the muxer was created is replaced with header, which must be the same size.
+	close(header []byte) error
+}
+
+// newStreamSerial returns a random, non-zero number identifying a stream, for the serial
+// number of an Ogg bitstream or the UID of a Matroska track
+func newStreamSerial() (uint32, error) {
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if serial := binary.LittleEndian.Uint32(b[:]); serial != 0 {
+			return serial, nil
+		}
+	}
+}
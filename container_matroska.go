@@ -0,0 +1,300 @@
+package gosound
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+)
+
+const (
+	// mkvTimecodeScale is the length of a timecode tick in nanoseconds, so timecodes are in milliseconds
+	mkvTimecodeScale = 1000000
+	// mkvClusterLength is the length of audio in each cluster, in milliseconds
+	mkvClusterLength = 1000
+	// mkvMaxClusterSize is the size of cluster data after which a cluster is written, even if it is shorter
+	mkvMaxClusterSize = 1 << 22
+	// mkvSeekHeadSize is the space reserved for the SeekHead at the start of the segment
+	mkvSeekHeadSize = 128
+	// mkvDurationSize is the size of the Duration element, which is a Void until the length is known
+	mkvDurationSize = 2 + 1 + 8
+	// mkvTrackNumber is the number of the only track
+	mkvTrackNumber = 1
+
+	mkvDocType   = "matroska"
+	mkvMuxingApp = "gosound"
+
+	mkvTrackTypeAudio = 2
+)
+
+// matroskaTrack describes the audio track of a Matroska file
+type matroskaTrack struct {
+	codecID string
+	// codecPrivate is the codec header, which may be replaced on close
+	codecPrivate []byte
+	channels     int
+	rate         int
+	// bitDepth is the bits per sample, or 0 if it is not given
+	bitDepth int
+}
+
+// matroskaMuxer writes packets as the blocks of a single audio track of a Matroska file.
+// The blocks are gathered into clusters of about a second, each of which is indexed in the cues.
+type matroskaMuxer struct {
+	out     *fileOutput
+	w       *bufio.Writer
+	cw      *countingWriter
+	track   matroskaTrack
+	markers *markerRecorder
+
+	// segmentPos is the position of the segment data, to which the positions in the segment are relative
+	segmentPos int64
+	// seeks holds the IDs and positions of the top level elements
+	seeks           []mkvSeek
+	durationPos     int64
+	codecPrivatePos int64
+
+	cluster     bytes.Buffer
+	clusterTime uint64
+	cues        []mkvSeek
+	samples     uint64
+}
+
+// mkvSeek is the position of an element in the segment, for the SeekHead and the cues
+type mkvSeek struct {
+	id   uint32
+	time uint64
+	pos  int64
+}
+
+// newMatroskaMuxer returns a muxer writing the header of the file, with the metadata as tags.
+// The markers are written as chapters on close.
+func newMatroskaMuxer(out *fileOutput, w *bufio.Writer, track matroskaTrack, metadata Metadata, markers *markerRecorder) (*matroskaMuxer, error) {
+	uid, err := newStreamSerial()
+	if err != nil {
+		return nil, err
+	}
+	m := &matroskaMuxer{
+		out:     out,
+		w:       w,
+		cw:      &countingWriter{w: w},
+		track:   track,
+		markers: markers,
+	}
+
+	var b bytes.Buffer
+	var hdr bytes.Buffer
+	ebmlWriteUint(&hdr, ebmlIDVersion, 1)
+	ebmlWriteUint(&hdr, ebmlIDReadVersion, 1)
+	ebmlWriteUint(&hdr, ebmlIDMaxIDLength, 4)
+	ebmlWriteUint(&hdr, ebmlIDMaxSizeLength, ebmlMaxSizeLength)
+	ebmlWriteString(&hdr, ebmlIDDocType, mkvDocType)
+	ebmlWriteUint(&hdr, ebmlIDDocTypeVersion, 4)
+	ebmlWriteUint(&hdr, ebmlIDDocTypeReadVersion, 2)
+	ebmlWriteElement(&b, ebmlIDHeader, hdr.Bytes())
+
+	// the segment size is filled in on close
+	ebmlWriteID(&b, mkvIDSegment)
+	ebmlWriteSize(&b, ebmlUnknownSize, ebmlMaxSizeLength)
+	m.segmentPos = int64(b.Len())
+	b.Write(make([]byte, mkvSeekHeadSize))
+
+	var info bytes.Buffer
+	ebmlWriteUint(&info, mkvIDTimecodeScale, mkvTimecodeScale)
+	ebmlWriteString(&info, mkvIDMuxingApp, mkvMuxingApp)
+	ebmlWriteString(&info, mkvIDWritingApp, mkvMuxingApp)
+	if metadata.Title != "" {
+		ebmlWriteString(&info, mkvIDTitle, metadata.Title)
+	}
+	// the duration is last, so its position is known
+	ebmlWriteVoid(&info, mkvDurationSize)
+	m.durationPos = m.writeTopLevel(&b, mkvIDInfo, info.Bytes()) - mkvDurationSize
+
+	var entry bytes.Buffer
+	ebmlWriteUint(&entry, mkvIDTrackNumber, mkvTrackNumber)
+	ebmlWriteUint(&entry, mkvIDTrackUID, uint64(uid))
+	ebmlWriteUint(&entry, mkvIDTrackType, mkvTrackTypeAudio)
+	ebmlWriteUint(&entry, mkvIDFlagLacing, 0)
+	ebmlWriteString(&entry, mkvIDCodecID, track.codecID)
+	var audio bytes.Buffer
+	ebmlWriteFloat(&audio, mkvIDSamplingFrequency, float64(track.rate))
+	ebmlWriteUint(&audio, mkvIDChannels, uint64(track.channels))
+	if track.bitDepth > 0 {
+		ebmlWriteUint(&audio, mkvIDBitDepth, uint64(track.bitDepth))
+	}
+	ebmlWriteElement(&entry, mkvIDAudio, audio.Bytes())
+	// the codec header is last, so its position is known
+	if len(track.codecPrivate) > 0 {
+		ebmlWriteElement(&entry, mkvIDCodecPrivate, track.codecPrivate)
+	}
+	var tracks bytes.Buffer
+	ebmlWriteElement(&tracks, mkvIDTrackEntry, entry.Bytes())
+	m.codecPrivatePos = m.writeTopLevel(&b, mkvIDTracks, tracks.Bytes()) - int64(len(track.codecPrivate))
+
+	if comments := metadata.vorbisComments(); len(comments) > 0 {
+		var tag bytes.Buffer
+		ebmlWriteElement(&tag, mkvIDTargets, nil)
+		for _, c := range comments {
+			var simple bytes.Buffer
+			ebmlWriteString(&simple, mkvIDTagName, c[0])
+			ebmlWriteString(&simple, mkvIDTagString, c[1])
+			ebmlWriteElement(&tag, mkvIDSimpleTag, simple.Bytes())
+		}
+		var tags bytes.Buffer
+		ebmlWriteElement(&tags, mkvIDTag, tag.Bytes())
+		m.writeTopLevel(&b, mkvIDTags, tags.Bytes())
+	}
+
+	// the SeekHead is written now, in case the output cannot be rewritten on close
+	copy(b.Bytes()[m.segmentPos:], m.seekHead())
+	if _, err := m.cw.Write(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeTopLevel writes a top level element of the segment to the header being built, which
+// starts at the current position, recording it in the SeekHead. It returns the position of its end.
+func (m *matroskaMuxer) writeTopLevel(b *bytes.Buffer, id uint32, body []byte) int64 {
+	m.seeks = append(m.seeks, mkvSeek{
+		id:  id,
+		pos: m.cw.n + int64(b.Len()) - m.segmentPos,
+	})
+	ebmlWriteElement(b, id, body)
+	return m.cw.n + int64(b.Len())
+}
+
+// seekHead returns the SeekHead of the top level elements, padded to the space reserved for it
+func (m *matroskaMuxer) seekHead() []byte {
+	var seeks bytes.Buffer
+	for _, s := range m.seeks {
+		var seek bytes.Buffer
+		var id bytes.Buffer
+		ebmlWriteID(&id, s.id)
+		ebmlWriteElement(&seek, mkvIDSeekID, id.Bytes())
+		ebmlWriteFixedUint(&seek, mkvIDSeekPosition, uint64(s.pos))
+		ebmlWriteElement(&seeks, mkvIDSeek, seek.Bytes())
+	}
+	var b bytes.Buffer
+	ebmlWriteElement(&b, mkvIDSeekHead, seeks.Bytes())
+	ebmlWriteVoid(&b, mkvSeekHeadSize-b.Len())
+	return b.Bytes()
+}
+
+// timecode returns the time of the sample position, in timecode ticks
+func (m *matroskaMuxer) timecode(samples uint64) uint64 {
+	return samples * 1000 / uint64(m.track.rate)
+}
+
+func (m *matroskaMuxer) writePacket(packet []byte, samples int) error {
+	time := m.timecode(m.samples)
+	if m.cluster.Len() > 0 && (time-m.clusterTime >= mkvClusterLength || m.cluster.Len() >= mkvMaxClusterSize) {
+		if err := m.writeCluster(); err != nil {
+			return err
+		}
+	}
+	if m.cluster.Len() == 0 {
+		m.clusterTime = time
+		ebmlWriteUint(&m.cluster, mkvIDTimecode, time)
+	}
+
+	// track number, timecode relative to the cluster, and keyframe flag
+	relative := time - m.clusterTime
+	block := []byte{0x80 | mkvTrackNumber, byte(relative >> 8), byte(relative), 0x80}
+	ebmlWriteID(&m.cluster, mkvIDSimpleBlock)
+	ebmlWriteSize(&m.cluster, uint64(len(block)+len(packet)), 0)
+	m.cluster.Write(block)
+	m.cluster.Write(packet)
+	m.samples += uint64(samples)
+	return nil
+}
+
+// writeCluster writes the cluster being built, and indexes it in the cues
+func (m *matroskaMuxer) writeCluster() error {
+	m.cues = append(m.cues, mkvSeek{
+		time: m.clusterTime,
+		pos:  m.cw.n - m.segmentPos,
+	})
+	var b bytes.Buffer
+	ebmlWriteElement(&b, mkvIDCluster, m.cluster.Bytes())
+	m.cluster.Reset()
+	_, err := m.cw.Write(b.Bytes())
+	return err
+}
+
+func (m *matroskaMuxer) close(header []byte) error {
+	if m.cluster.Len() > 0 {
+		if err := m.writeCluster(); err != nil {
+			return err
+		}
+	}
+
+	var b bytes.Buffer
+	if len(m.cues) > 0 {
+		var cues bytes.Buffer
+		for _, c := range m.cues {
+			var pos bytes.Buffer
+			ebmlWriteUint(&pos, mkvIDCueTrack, mkvTrackNumber)
+			ebmlWriteUint(&pos, mkvIDCueClusterPosition, uint64(c.pos))
+			var point bytes.Buffer
+			ebmlWriteUint(&point, mkvIDCueTime, c.time)
+			ebmlWriteElement(&point, mkvIDCueTrackPositions, pos.Bytes())
+			ebmlWriteElement(&cues, mkvIDCuePoint, point.Bytes())
+		}
+		m.writeTopLevel(&b, mkvIDCues, cues.Bytes())
+	}
+	if markers := m.markers.embedded(); len(markers) > 0 {
+		var edition bytes.Buffer
+		for i, mk := range markers {
+			var display bytes.Buffer
+			ebmlWriteString(&display, mkvIDChapString, mk.Label)
+			ebmlWriteString(&display, mkvIDChapLanguage, "eng")
+			var atom bytes.Buffer
+			ebmlWriteUint(&atom, mkvIDChapterUID, uint64(i+1))
+			// chapter times are in nanoseconds, whatever the timecode scale
+			ebmlWriteUint(&atom, mkvIDChapterTimeStart, mk.Frame*1000000000/uint64(m.track.rate))
+			ebmlWriteElement(&atom, mkvIDChapterDisplay, display.Bytes())
+			ebmlWriteElement(&edition, mkvIDChapterAtom, atom.Bytes())
+		}
+		var chapters bytes.Buffer
+		ebmlWriteElement(&chapters, mkvIDEditionEntry, edition.Bytes())
+		m.writeTopLevel(&b, mkvIDChapters, chapters.Bytes())
+	}
+	if _, err := m.cw.Write(b.Bytes()); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	if !m.out.Seekable() {
+		return nil
+	}
+	if len(header) != len(m.track.codecPrivate) {
+		return errors.New("matroska codec header size changed")
+	}
+
+	// the segment size, SeekHead, duration and codec header are only known now
+	var size bytes.Buffer
+	ebmlWriteSize(&size, uint64(m.cw.n-m.segmentPos), ebmlMaxSizeLength)
+	var duration bytes.Buffer
+	ebmlWriteFloat(&duration, mkvIDDuration, float64(m.samples)*1000/float64(m.track.rate))
+	for _, r := range []struct {
+		pos  int64
+		data []byte
+	}{
+		{m.segmentPos - ebmlMaxSizeLength, size.Bytes()},
+		{m.segmentPos, m.seekHead()},
+		{m.durationPos, duration.Bytes()},
+		{m.codecPrivatePos, header},
+	} {
+		if err := m.out.SeekTo(r.pos); err != nil {
+			return err
+		}
+		if _, err := m.w.Write(r.data); err != nil {
+			return err
+		}
+		if err := m.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testEbmlElement is an element of an EBML file
+type testEbmlElement struct {
+	id uint32
+	// pos is the position of the element in the file
+	pos  int
+	body []byte
+	// bodyPos is the position of the body in the file
+	bodyPos int
+}
+
+// testEbmlVint reads a variable length integer, returning it with its marker and without, and its length
+func testEbmlVint(t *testing.T, b []byte) (uint64, uint64, int) {
+	t.Helper()
+	if len(b) == 0 || b[0] == 0 {
+		t.Fatal("invalid EBML variable length integer")
+	}
+	n := 1
+	for b[0]&(0x80>>(n-1)) == 0 {
+		n++
+	}
+	if n > len(b) {
+		t.Fatal("truncated EBML variable length integer")
+	}
+	var v uint64
+	for _, c := range b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, v &^ (1 << (7 * n)), n
+}
+
+// testEbmlElements reads the elements filling b, which is at pos in the file
+func testEbmlElements(t *testing.T, b []byte, pos int) []testEbmlElement {
+	t.Helper()
+	var out []testEbmlElement
+	for i := 0; i < len(b); {
+		id, _, idLen := testEbmlVint(t, b[i:])
+		_, size, sizeLen := testEbmlVint(t, b[i+idLen:])
+		start := i + idLen + sizeLen
+		if size > uint64(len(b)-start) {
+			t.Fatalf("element %x of %d bytes at %d overruns its parent", id, size, pos+i)
+		}
+		out = append(out, testEbmlElement{
+			id:      uint32(id),
+			pos:     pos + i,
+			body:    b[start : start+int(size)],
+			bodyPos: pos + start,
+		})
+		i = start + int(size)
+	}
+	return out
+}
+
+// testEbmlFind returns the elements with the ID
+func testEbmlFind(els []testEbmlElement, id uint32) []testEbmlElement {
+	var out []testEbmlElement
+	for _, e := range els {
+		if e.id == id {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// testEbmlOne returns the only element with the ID
+func testEbmlOne(t *testing.T, els []testEbmlElement, id uint32) testEbmlElement {
+	t.Helper()
+	found := testEbmlFind(els, id)
+	if len(found) != 1 {
+		t.Fatalf("%d elements %x, want 1", len(found), id)
+	}
+	return found[0]
+}
+
+// testEbmlChildren returns the elements inside the only element with the ID
+func testEbmlChildren(t *testing.T, els []testEbmlElement, id uint32) []testEbmlElement {
+	t.Helper()
+	e := testEbmlOne(t, els, id)
+	return testEbmlElements(t, e.body, e.bodyPos)
+}
+
+// testEbmlUint returns the value of the only unsigned integer element with the ID
+func testEbmlUint(t *testing.T, els []testEbmlElement, id uint32) uint64 {
+	t.Helper()
+	var v uint64
+	for _, c := range testEbmlOne(t, els, id).body {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// testMatroskaFile checks the structure of a Matroska file holding frames of audio: the segment size,
+// the SeekHead, the duration and the cues. It returns the track entry and the frames of each block.
+func testMatroskaFile(t *testing.T, b []byte, frames int, rate int) ([]testEbmlElement, [][]byte) {
+	t.Helper()
+	top := testEbmlElements(t, b, 0)
+	if len(top) != 2 || top[0].id != ebmlIDHeader || top[1].id != mkvIDSegment {
+		t.Fatal("not an EBML header and a segment")
+	}
+	// the segment size was rewritten, so it fills the file
+	if _, size, _ := testEbmlVint(t, b[top[1].bodyPos-ebmlMaxSizeLength:]); int(size) != len(b)-top[1].bodyPos {
+		t.Fatalf("segment size %d, want %d", size, len(b)-top[1].bodyPos)
+	}
+	segmentPos := top[1].bodyPos
+	segment := testEbmlElements(t, top[1].body, segmentPos)
+
+	// the SeekHead points at each other top level element
+	seeks := testEbmlFind(testEbmlChildren(t, segment, mkvIDSeekHead), mkvIDSeek)
+	if len(seeks) < 3 {
+		t.Fatalf("%d SeekHead entries", len(seeks))
+	}
+	for _, s := range seeks {
+		seek := testEbmlElements(t, s.body, s.bodyPos)
+		id, _, _ := testEbmlVint(t, testEbmlOne(t, seek, mkvIDSeekID).body)
+		pos := segmentPos + int(testEbmlUint(t, seek, mkvIDSeekPosition))
+		if found := testEbmlFind(segment, uint32(id)); len(found) != 1 || found[0].pos != pos {
+			t.Fatalf("SeekHead points at %x at %d", id, pos)
+		}
+	}
+
+	info := testEbmlChildren(t, segment, mkvIDInfo)
+	if scale := testEbmlUint(t, info, mkvIDTimecodeScale); scale != mkvTimecodeScale {
+		t.Fatalf("timecode scale %d", scale)
+	}
+	duration := math.Float64frombits(binary.BigEndian.Uint64(testEbmlOne(t, info, mkvIDDuration).body))
+	if want := float64(frames) * 1000 / float64(rate); math.Abs(duration-want) > 1e-6 {
+		t.Fatalf("duration %v ms, want %v", duration, want)
+	}
+
+	entry := testEbmlChildren(t, testEbmlChildren(t, segment, mkvIDTracks), mkvIDTrackEntry)
+	if n := testEbmlUint(t, entry, mkvIDTrackNumber); n != mkvTrackNumber {
+		t.Fatalf("track number %d", n)
+	}
+	if uid := testEbmlUint(t, entry, mkvIDTrackUID); uid == 0 {
+		t.Fatal("track UID 0")
+	}
+
+	// each cluster is indexed in the cues, at the time of its first block
+	clusters := testEbmlFind(segment, mkvIDCluster)
+	points := testEbmlFind(testEbmlChildren(t, segment, mkvIDCues), mkvIDCuePoint)
+	if len(clusters) < 2 || len(points) != len(clusters) {
+		t.Fatalf("%d cue points for %d clusters", len(points), len(clusters))
+	}
+	var blocks [][]byte
+	for i, c := range clusters {
+		cluster := testEbmlElements(t, c.body, c.bodyPos)
+		time := testEbmlUint(t, cluster, mkvIDTimecode)
+		point := testEbmlElements(t, points[i].body, points[i].bodyPos)
+		positions := testEbmlChildren(t, point, mkvIDCueTrackPositions)
+		if cueTime := testEbmlUint(t, point, mkvIDCueTime); cueTime != time {
+			t.Fatalf("cluster %d: cue time %d, want %d", i, cueTime, time)
+		}
+		if pos := testEbmlUint(t, positions, mkvIDCueClusterPosition); segmentPos+int(pos) != c.pos {
+			t.Fatalf("cluster %d: cue position %d, want %d", i, pos, c.pos-segmentPos)
+		}
+		for _, block := range testEbmlFind(cluster, mkvIDSimpleBlock) {
+			if block.body[0] != 0x80|mkvTrackNumber || block.body[3]&0x80 == 0 {
+				t.Fatalf("cluster %d: block header %x", i, block.body[:4])
+			}
+			relative := uint64(binary.BigEndian.Uint16(block.body[1:]))
+			if len(blocks) == 0 && time+relative != 0 {
+				t.Fatalf("first block at %d ms", time+relative)
+			}
+			blocks = append(blocks, block.body[4:])
+		}
+	}
+	return entry, blocks
+}
+
+func TestMatroskaPCM(t *testing.T) {
+	rows := testSignal(2, 250, testRowLen, testSampleRate)
+	var uids []uint64
+	for _, s := range []Settings{
+		{Channels: 2, BitsPerSample: 16},
+		{Channels: 1, BitsPerSample: 24},
+	} {
+		want := testCapture(t, s, rows).Samples()
+		format := sampleFormatForBits(s.BitsPerSample)
+		b := testRenderFile(t, "mka", s, rows)
+		entry, blocks := testMatroskaFile(t, b, 250*testRowLen, testSampleRate)
+		uids = append(uids, testEbmlUint(t, entry, mkvIDTrackUID))
+		if id := string(testEbmlOne(t, entry, mkvIDCodecID).body); id != "A_PCM/INT/LIT" {
+			t.Fatalf("%+v: codec %q", s, id)
+		}
+		audio := testEbmlChildren(t, entry, mkvIDAudio)
+		if n := testEbmlUint(t, audio, mkvIDChannels); int(n) != s.Channels {
+			t.Fatalf("%+v: %d channels", s, n)
+		}
+		if n := testEbmlUint(t, audio, mkvIDBitDepth); int(n) != s.BitsPerSample {
+			t.Fatalf("%+v: bit depth %d", s, n)
+		}
+
+		var data []byte
+		for _, block := range blocks {
+			data = append(data, block...)
+		}
+		if got := testDecodeInts(data, s.Channels, format, binary.LittleEndian); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%+v: samples differ", s)
+		}
+	}
+	if uids[0] == uids[1] {
+		t.Fatalf("track UID %x given twice", uids[0])
+	}
+}
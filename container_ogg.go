@@ -0,0 +1,73 @@
+package gosound
+
+import (
+	"bufio"
+	"errors"
+
+	"github.com/gotracker/gosound/internal/ogg"
+)
+
+// oggMuxer writes packets into an Ogg bitstream, whose granule position counts the samples
+type oggMuxer struct {
+	out    *fileOutput
+	w      *bufio.Writer
+	ogg    *ogg.Writer
+	serial uint32
+	// headerSize is the size of the first header packet, which is rewritten on close
+	headerSize int
+	granule    uint64
+}
+
+// newOggMuxer returns a muxer writing the header packets, followed by the audio packets.
+// The first header packet is alone on the first page, and the audio starts on a new page.
+func newOggMuxer(out *fileOutput, w *bufio.Writer, headers ...[]byte) (*oggMuxer, error) {
+	serial, err := newStreamSerial()
+	if err != nil {
+		return nil, err
+	}
+	m := &oggMuxer{
+		out:        out,
+		w:          w,
+		ogg:        ogg.NewWriter(w, serial),
+		serial:     serial,
+		headerSize: len(headers[0]),
+	}
+	for i, h := range headers {
+		if err := m.ogg.WritePacket(h, 0); err != nil {
+			return nil, err
+		}
+		if i == 0 || i == len(headers)-1 {
+			if err := m.ogg.Flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *oggMuxer) writePacket(packet []byte, samples int) error {
+	m.granule += uint64(samples)
+	return m.ogg.WritePacket(packet, m.granule)
+}
+
+func (m *oggMuxer) close(header []byte) error {
+	if err := m.ogg.Close(); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	if !m.out.Seekable() {
+		return nil
+	}
+	if len(header) != m.headerSize {
+		return errors.New("ogg header size changed")
+	}
+	if err := m.out.SeekTo(0); err != nil {
+		return err
+	}
+	if _, err := m.w.Write(ogg.FirstPage(m.serial, header)); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
@@ -0,0 +1,133 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testOggPage is a page of an Ogg bitstream
+type testOggPage struct {
+	flags   byte
+	granule uint64
+	// packets is the number of packets ending on the page
+	packets int
+}
+
+// testOggCRC returns the checksum of an Ogg page, computed a bit at a time
+func testOggCRC(page []byte) uint32 {
+	var c uint32
+	for _, b := range page {
+		c ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+	}
+	return c
+}
+
+// testOggStream checks the pages of an Ogg file holding a single logical bitstream, returning
+// its serial number, its packets and its pages
+func testOggStream(t *testing.T, b []byte) (uint32, [][]byte, []testOggPage) {
+	t.Helper()
+	var serial uint32
+	var packets [][]byte
+	var pages []testOggPage
+	var packet []byte
+	// open is true while a packet continues on the next page
+	open := false
+	granule := uint64(0)
+	for pos := 0; pos < len(b); {
+		if pos+27 > len(b) || string(b[pos:pos+4]) != "OggS" || b[pos+4] != 0 {
+			t.Fatalf("no page header at %d", pos)
+		}
+		segments := int(b[pos+26])
+		lacing := b[pos+27 : pos+27+segments]
+		size := 27 + segments
+		for _, n := range lacing {
+			size += int(n)
+		}
+		if pos+size > len(b) {
+			t.Fatalf("page %d overruns the file", len(pages))
+		}
+		page := append([]byte(nil), b[pos:pos+size]...)
+		sum := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if c := testOggCRC(page); c != sum {
+			t.Fatalf("page %d: checksum %08x, want %08x", len(pages), sum, c)
+		}
+
+		p := testOggPage{flags: page[5], granule: binary.LittleEndian.Uint64(page[6:])}
+		if len(pages) == 0 {
+			serial = binary.LittleEndian.Uint32(page[14:])
+		} else if s := binary.LittleEndian.Uint32(page[14:]); s != serial {
+			t.Fatalf("page %d: serial %08x, want %08x", len(pages), s, serial)
+		}
+		if seq := binary.LittleEndian.Uint32(page[18:]); int(seq) != len(pages) {
+			t.Fatalf("page %d: sequence number %d", len(pages), seq)
+		}
+		if (p.flags&0x02 != 0) != (len(pages) == 0) || (p.flags&0x04 != 0) != (pos+size == len(b)) {
+			t.Fatalf("page %d: flags %02x", len(pages), p.flags)
+		}
+		if (p.flags&0x01 != 0) != open {
+			t.Fatalf("page %d: continued flag %v", len(pages), p.flags&0x01 != 0)
+		}
+
+		data := page[27+segments:]
+		for _, n := range lacing {
+			packet = append(packet, data[:n]...)
+			data = data[n:]
+			open = n == 255
+			if !open {
+				packets = append(packets, packet)
+				packet = nil
+				p.packets++
+			}
+		}
+		// a page on which no packet ends has no granule position
+		if p.packets == 0 && p.granule != ^uint64(0) {
+			t.Fatalf("page %d: granule position %d, with no packet ending", len(pages), p.granule)
+		}
+		if p.packets > 0 {
+			if p.granule < granule {
+				t.Fatalf("page %d: granule position %d, after %d", len(pages), p.granule, granule)
+			}
+			granule = p.granule
+		}
+		pages = append(pages, p)
+		pos += size
+	}
+	if open {
+		t.Fatal("last packet not ended")
+	}
+	return serial, packets, pages
+}
+
+func TestOggVorbisPages(t *testing.T) {
+	rows := testSignal(2, 150, testRowLen, testSampleRate)
+	var serials []uint32
+	for i := 0; i < 2; i++ {
+		b := testRenderFile(t, "ogg", Settings{}, rows)
+		serial, packets, pages := testOggStream(t, b)
+		serials = append(serials, serial)
+
+		// the identification header is alone on the first page, and the audio starts on a new page
+		if pages[0].packets != 1 || pages[0].granule != 0 || pages[1].packets != 2 || pages[1].granule != 0 {
+			t.Fatalf("header pages %+v", pages[:2])
+		}
+		if !bytes.HasPrefix(packets[0], []byte("\x01vorbis")) || !bytes.HasPrefix(packets[1], []byte("\x03vorbis")) || !bytes.HasPrefix(packets[2], []byte("\x05vorbis")) {
+			t.Fatal("header packets out of order")
+		}
+		// the granule position of the last page is the length of the audio
+		if g := pages[len(pages)-1].granule; g != 150*testRowLen {
+			t.Fatalf("last granule position %d, want %d", g, 150*testRowLen)
+		}
+	}
+	if serials[0] == serials[1] || serials[0] == 0 {
+		t.Fatalf("serial numbers %08x and %08x", serials[0], serials[1])
+	}
+}
@@ -2,6 +2,7 @@ package gosound
 
 import (
 	"context"
+	"io"
 
 	"github.com/pkg/errors"
 )
@@ -9,6 +10,8 @@ import (
 var (
 	// ErrDeviceNotSupported is returned when the requested device is not supported
 	ErrDeviceNotSupported = errors.New("device not supported")
+	// ErrTransportNotSupported is returned by the transport controls that a device cannot carry out
+	ErrTransportNotSupported = errors.New("transport control not supported")
 )
 
 // DisplayFunc defines the callback for when a premix buffer is mixed/rendered and output on the device
@@ -26,13 +29,6 @@ type kindGetter interface {
 	GetKind() Kind
 }
 
-type createOutputDeviceFunc func(settings Settings) (Device, error)
-
-type deviceDetails struct {
-	create createOutputDeviceFunc
-	Kind   Kind
-}
-
 // GetKind returns the kind for the passed in device
 func GetKind(d Device) Kind {
 	if dev, ok := d.(kindGetter); ok {
@@ -41,14 +37,20 @@ func GetKind(d Device) Kind {
 	return KindNone
 }
 
-var (
-	// Map is the mapping of device name to device details
-	Map = make(map[string]deviceDetails)
-)
-
-// CreateOutputDevice creates an output device based on the provided settings
+// CreateOutputDevice creates an output device based on the provided settings.
+// If settings.Name is DefaultName or settings.Fallbacks is populated, the first
+// device that can be created successfully is returned.
 func CreateOutputDevice(settings Settings) (Device, error) {
-	if details, ok := Map[settings.Name]; ok && details.create != nil {
+	dev, _, err := SelectOutputDevice(settings)
+	return dev, err
+}
+
+func createNamedOutputDevice(settings Settings) (Device, error) {
+	if details, ok := lookupDevice(settings.Name); ok && details.create != nil {
+		settings, err := details.negotiateFormat(settings)
+		if err != nil {
+			return nil, err
+		}
 		dev, err := details.create(settings)
 		if err != nil {
 			return nil, err
@@ -63,6 +65,52 @@ type device struct {
 	Device
 
 	onRowOutput DisplayFunc
+	format      StreamFormat
+	ctl         *transport
+	frames      *frameCounter
+}
+
+// GetStreamFormat returns the stream format of the device
+func (d *device) GetStreamFormat() StreamFormat {
+	return d.format
+}
+
+func newDevice(settings Settings) device {
+	return device{
+		onRowOutput: settings.OnRowOutput,
+		format:      settings.streamFormat(),
+		ctl:         newTransport(),
+		frames:      &frameCounter{},
+	}
+}
+
+// Position returns the playback position of the device
+func (d *device) Position() Position {
+	return d.frames.position(d.format.SamplesPerSecond)
+}
+
+// Pause holds playback at the current position
+func (d *device) Pause() error {
+	d.ctl.Pause()
+	return nil
+}
+
+// Resume continues playback after a Pause
+func (d *device) Resume() error {
+	d.ctl.Resume()
+	return nil
+}
+
+// Flush discards any audio queued on the device that has not been played yet.
+// Devices that write their output immediately have nothing to discard.
+func (d *device) Flush() error {
+	return nil
+}
+
+// Stop ends playback, causing Play/PlayWithCtx to return
+func (d *device) Stop() error {
+	d.ctl.Stop()
+	return nil
 }
 
 // Settings is the settings for configuring an output device
@@ -71,6 +119,42 @@ type Settings struct {
 	Channels         int
 	SamplesPerSecond int
 	BitsPerSample    int
-	Filepath         string
-	OnRowOutput      DisplayFunc
+	// SampleFormat is the encoding of each sample; when SampleFormatDefault, the
+	// integer format matching BitsPerSample is used
+	SampleFormat SampleFormat
+	Filepath     string
+	// Writer is the destination for file devices; when set, Filepath is not opened
+	Writer io.Writer
+	// Format is the name of the file format (e.g.: "wav" or "flac"); when empty, the Filepath extension is used
+	Format      string
+	OnRowOutput DisplayFunc
+	// Metadata is the title, artist and other tags written by file formats that support them
+	Metadata Metadata
+	// Markers writes the rows whose Userdata implements Marker as cue points,
+	// in the file formats that support them
+	Markers bool
+	// CueSheet writes the rows whose Userdata implements Marker to a .cue file next to Filepath
+	CueSheet bool
+	// Options holds device- or format-specific options (e.g.: *NullOptions or *WavOptions)
+	Options interface{}
+	// StrictFormat causes device creation to fail when the requested format is not
+	// supported, instead of falling back to the closest supported format
+	StrictFormat bool
+	// Fallbacks is the list of device names to try, in order, if the device named by Name cannot be created
+	Fallbacks []string
+}
+
+func (s Settings) streamFormat() StreamFormat {
+	f := StreamFormat{
+		Channels:         s.Channels,
+		SamplesPerSecond: s.SamplesPerSecond,
+		BitsPerSample:    s.BitsPerSample,
+		SampleFormat:     s.SampleFormat,
+	}
+	if f.SampleFormat == SampleFormatDefault {
+		f.SampleFormat = sampleFormatForBits(f.BitsPerSample)
+	} else {
+		f.BitsPerSample = f.SampleFormat.BitsPerSample()
+	}
+	return f
 }
@@ -23,7 +23,8 @@ type dsoundDevice struct {
 	lpdsbPrimary *directsound.Buffer
 	wfx          *winmm.WAVEFORMATEX
 
-	mix mixing.Mixer
+	mix  mixing.Mixer
+	rows *rowScheduler
 }
 
 func (d *dsoundDevice) GetKind() Kind {
@@ -32,9 +33,7 @@ func (d *dsoundDevice) GetKind() Kind {
 
 func newDSoundDevice(settings Settings) (Device, error) {
 	d := dsoundDevice{
-		device: device{
-			onRowOutput: settings.OnRowOutput,
-		},
+		device: newDevice(settings),
 		mix: mixing.Mixer{
 			Channels:      settings.Channels,
 			BitsPerSample: settings.BitsPerSample,
@@ -58,10 +57,23 @@ func newDSoundDevice(settings Settings) (Device, error) {
 	}
 	d.lpdsbPrimary = lpdsbPrimary
 	d.wfx = wfx
+	d.rows = newRowScheduler(KindSoundCard, d.onRowOutput, d.Position, settings.SamplesPerSecond)
 
 	return &d, nil
 }
 
+func probeDSound() error {
+	ds, err := directsound.NewDSound("")
+	if err != nil {
+		return err
+	}
+	if ds == nil {
+		return errors.New("could not create directsound device")
+	}
+	ds.Close()
+	return nil
+}
+
 // Name returns the device name
 func (d *dsoundDevice) Name() string {
 	return dsoundName
@@ -76,6 +88,7 @@ type playbackData struct {
 	event windows.Handle
 	row   *PremixData
 	pos   int
+	start uint64
 }
 
 type playbackBuffer struct {
@@ -84,6 +97,7 @@ type playbackBuffer struct {
 	rows       []playbackData
 	maxSamples int
 	writePos   int
+	endFrame   uint64
 }
 
 func (p *playbackBuffer) Add(mix *mixing.Mixer, row *PremixData, pos int, size int, blockAlign int, panmixer mixing.PanMixer) (int, error) {
@@ -138,6 +152,10 @@ func (d *dsoundDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) e
 	myCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	rowsCtx, rowsCancel := context.WithCancel(ctx)
+	defer rowsCancel()
+	go d.rows.Run(rowsCtx)
+
 	events := []windows.Handle{}
 	availableEvents := make(chan windows.Handle, maxOutstandingEvents)
 	defer func() {
@@ -184,45 +202,47 @@ func (d *dsoundDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) e
 	currentBuffer := <-availableBuffers
 
 	out := make(chan *playbackBuffer, maxOutstanding)
+	defer d.ctl.reset()
 	go func() {
 		defer close(out)
 		defer cancel()
 		for {
-			select {
-			case <-myCtx.Done():
+			row, err := d.ctl.nextRow(myCtx, in)
+			if err != nil || row == nil {
 				return
-			case row, ok := <-in:
-				if !ok {
-					return
-				}
+			}
 
-				size := row.SamplesLen
-				pos := 0
+			size := row.SamplesLen
+			pos := 0
 
-				blockAlign := int(d.wfx.NBlockAlign)
-				if size > 0 {
-					event, err := getAvailableEvent()
-					if err != nil {
-						panic(err)
-					}
-					currentBuffer.rows = append(currentBuffer.rows, playbackData{
-						event: event,
-						row:   row,
-						pos:   currentBuffer.writePos * blockAlign,
-					})
+			blockAlign := int(d.wfx.NBlockAlign)
+			if size > 0 {
+				event, err := getAvailableEvent()
+				if err != nil {
+					panic(err)
 				}
-				for size > 0 {
-					n, err := currentBuffer.Add(&d.mix, row, pos, row.SamplesLen, blockAlign, panmixer)
-					size -= n
-					pos += n
-					if err != nil {
-						if !errors.Is(err, io.EOF) {
-							panic(err)
-						}
-						currentBuffer.writePos = 0
-						out <- currentBuffer
-						currentBuffer = <-availableBuffers
+				start := d.frames.renderedFrames()
+				currentBuffer.rows = append(currentBuffer.rows, playbackData{
+					event: event,
+					row:   row,
+					pos:   currentBuffer.writePos * blockAlign,
+					start: start,
+				})
+				d.rows.Schedule(start, row)
+			}
+			for size > 0 {
+				n, err := currentBuffer.Add(&d.mix, row, pos, row.SamplesLen, blockAlign, panmixer)
+				size -= n
+				pos += n
+				d.frames.addRendered(n)
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						panic(err)
 					}
+					currentBuffer.writePos = 0
+					currentBuffer.endFrame = d.frames.renderedFrames()
+					out <- currentBuffer
+					currentBuffer = <-availableBuffers
 				}
 			}
 		}
@@ -242,6 +262,7 @@ func (d *dsoundDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) e
 		buffer.rows = []playbackData{}
 		availableBuffers <- buffer
 	}
+	d.rows.Drain(rowsCtx)
 	done <- struct{}{}
 	return nil
 }
@@ -277,14 +298,28 @@ func (d *dsoundDevice) playWaveBuffer(p *playbackBuffer, endEvent windows.Handle
 	}
 
 	for _, n := range p.rows {
-		if d.onRowOutput != nil {
-			d.onRowOutput(KindSoundCard, n.row)
-		}
 		if err := win32.WaitForSingleObjectInfinite(n.event); err != nil {
 			return err
 		}
+		d.frames.setPlayed(n.start)
+		d.rows.Kick()
+	}
+	if err := win32.WaitForSingleObjectInfinite(endEvent); err != nil {
+		return err
 	}
-	return win32.WaitForSingleObjectInfinite(endEvent)
+	d.frames.setPlayed(p.endFrame)
+	d.rows.Kick()
+	return nil
+}
+
+// Pause is not supported, as the buffers queued on the device cannot be held
+func (d *dsoundDevice) Pause() error {
+	return ErrTransportNotSupported
+}
+
+// Flush is not supported, as the buffers queued on the device cannot be discarded
+func (d *dsoundDevice) Flush() error {
+	return ErrTransportNotSupported
 }
 
 // Close closes the wave output device
@@ -298,8 +333,14 @@ func (d *dsoundDevice) Close() {
 }
 
 func init() {
-	Map[dsoundName] = deviceDetails{
-		create: newDSoundDevice,
-		Kind:   KindSoundCard,
-	}
+	Register(dsoundName, KindSoundCard, newDSoundDevice,
+		WithDescription("Microsoft DirectSound"),
+		WithProbe(probeDSound),
+		WithDefaultPriority(200),
+		WithCapabilities(Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 100,
+			MaxSamplesPerSecond: 200000,
+			SampleFormats:       []SampleFormat{SampleFormatInt8, SampleFormatInt16},
+		}))
 }
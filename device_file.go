@@ -1,19 +1,120 @@
 package gosound
 
 import (
-	"errors"
+	"io"
+	"os"
 	"path"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
 )
 
 const fileName = "file"
 
 var (
-	fileDeviceMap = make(map[string]createOutputDeviceFunc)
+	// ErrFileFormatNotSupported is returned when no encoder is registered for the requested file format
+	ErrFileFormatNotSupported = errors.New("unsupported output format")
+)
+
+// FileFormat describes an encoder available to the file device.
+// Encoders that accept options read them from Settings.Options, using an
+// option struct specific to the format (e.g.: *WavOptions).
+type FileFormat struct {
+	// Name is the name used to select the format through Settings.Format (e.g.: "wav")
+	Name string
+	// Extensions are the file extensions, including the leading dot, that select the format when Settings.Format is empty
+	Extensions []string
+	// Description is a human-readable description of the format
+	Description string
+	// Create creates the file device for the format
+	Create CreateOutputDeviceFunc
+	// Capabilities is the set of stream formats supported by the encoder
+	Capabilities Capabilities
+}
+
+var (
+	fileFormats    = make(map[string]FileFormat)
+	fileFormatExts = make(map[string]string)
+	fileFormatsMu  sync.RWMutex
 )
 
+// RegisterFileFormat makes an encoder available to the file device.
+// If RegisterFileFormat is called twice with the same name or extension or if Create is nil, it panics.
+func RegisterFileFormat(format FileFormat) {
+	name := strings.ToLower(format.Name)
+	if name == "" {
+		panic("gosound: RegisterFileFormat format name is empty")
+	}
+	if format.Create == nil {
+		panic("gosound: RegisterFileFormat create function is nil for " + name)
+	}
+
+	fileFormatsMu.Lock()
+	defer fileFormatsMu.Unlock()
+	if _, dup := fileFormats[name]; dup {
+		panic("gosound: RegisterFileFormat called twice for format " + name)
+	}
+	for _, ext := range format.Extensions {
+		ext = strings.ToLower(ext)
+		if _, dup := fileFormatExts[ext]; dup {
+			panic("gosound: RegisterFileFormat called twice for extension " + ext)
+		}
+		fileFormatExts[ext] = name
+	}
+	fileFormats[name] = format
+}
+
+// FileFormats returns the registered file formats, sorted by name
+func FileFormats() []FileFormat {
+	fileFormatsMu.RLock()
+	formats := make([]FileFormat, 0, len(fileFormats))
+	for _, f := range fileFormats {
+		formats = append(formats, f)
+	}
+	fileFormatsMu.RUnlock()
+
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i].Name < formats[j].Name
+	})
+	return formats
+}
+
+// lookupFileFormat finds the file format by Settings.Format, falling back to the extension of Settings.Filepath
+func lookupFileFormat(settings Settings) (FileFormat, error) {
+	fileFormatsMu.RLock()
+	defer fileFormatsMu.RUnlock()
+
+	if settings.Format != "" {
+		name := strings.ToLower(settings.Format)
+		if f, ok := fileFormats[name]; ok {
+			return f, nil
+		}
+		// allow the format to be specified by extension, too
+		if n, ok := fileFormatExts["."+strings.TrimPrefix(name, ".")]; ok {
+			return fileFormats[n], nil
+		}
+		return FileFormat{}, errors.Wrap(ErrFileFormatNotSupported, settings.Format)
+	}
+
+	ext := strings.ToLower(path.Ext(settings.Filepath))
+	if n, ok := fileFormatExts[ext]; ok {
+		return fileFormats[n], nil
+	}
+	return FileFormat{}, ErrFileFormatNotSupported
+}
+
 type fileDevice struct {
 	device
+	markers markerRecorder
+}
+
+func newFileDeviceBase(settings Settings) fileDevice {
+	return fileDevice{
+		device:  newDevice(settings),
+		markers: newMarkerRecorder(settings),
+	}
 }
 
 func (d *fileDevice) GetKind() Kind {
@@ -25,18 +126,101 @@ func (d *fileDevice) Name() string {
 	return fileName
 }
 
-func newFileDevice(settings Settings) (Device, error) {
-	ext := strings.ToLower(path.Ext(settings.Filepath))
-	if create, ok := fileDeviceMap[ext]; ok && create != nil {
-		return create(settings)
+// fileOutput is the destination of a file device
+type fileOutput struct {
+	w      io.Writer
+	seeker io.Seeker // nil if the output is not seekable
+	closer io.Closer // nil if the output is owned by the caller
+	base   int64
+}
+
+func openFileOutput(settings Settings) (*fileOutput, error) {
+	if settings.Writer != nil {
+		out := fileOutput{
+			w: settings.Writer,
+		}
+		if s, ok := settings.Writer.(io.Seeker); ok {
+			// pipes and terminals claim to be seekable, but fail when seeking
+			if base, err := s.Seek(0, io.SeekCurrent); err == nil {
+				out.seeker = s
+				out.base = base
+			}
+		}
+		return &out, nil
+	}
+
+	if settings.Filepath == "" {
+		return nil, errors.New("no output file or writer provided")
+	}
+
+	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == nil {
+		return nil, errors.New("unexpected file error")
 	}
 
-	return nil, errors.New("unsupported output format")
+	return &fileOutput{
+		w:      f,
+		seeker: f,
+		closer: f,
+	}, nil
 }
 
-func init() {
-	Map[fileName] = deviceDetails{
-		create: newFileDevice,
-		Kind:   KindFile,
+// Seekable returns true if the output supports seeking
+func (o *fileOutput) Seekable() bool {
+	return o.seeker != nil
+}
+
+// SeekTo moves the output to the position relative to where the output started
+func (o *fileOutput) SeekTo(pos int64) error {
+	if o.seeker == nil {
+		return errors.New("output is not seekable")
+	}
+	_, err := o.seeker.Seek(o.base+pos, io.SeekStart)
+	return err
+}
+
+// Close closes the output, if it is owned by the device
+func (o *fileOutput) Close() error {
+	if o.closer != nil {
+		return o.closer.Close()
 	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func fileDeviceCapabilities(settings Settings) (Capabilities, error) {
+	format, err := lookupFileFormat(settings)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return format.Capabilities, nil
+}
+
+func newFileDevice(settings Settings) (Device, error) {
+	format, err := lookupFileFormat(settings)
+	if err != nil {
+		return nil, err
+	}
+	return format.Create(settings)
+}
+
+func init() {
+	Register(fileName, KindFile, newFileDevice,
+		WithDescription("File or stream output (see FileFormats)"),
+		WithCapabilitiesFunc(fileDeviceCapabilities))
 }
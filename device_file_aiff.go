@@ -0,0 +1,385 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+// AiffOptions is the set of options for the AIFF and AIFF-C file formats
+type AiffOptions struct {
+	// LittleEndian writes little-endian integer samples, using the AIFF-C `sowt` compression type
+	LittleEndian bool
+}
+
+type fileDeviceAiff struct {
+	fileDevice
+	mix   sampleMixer
+	order binary.ByteOrder
+
+	out              *fileOutput
+	w                *bufio.Writer
+	sz               uint64
+	streaming        bool
+	blockAlign       int
+	numFramesPos     int64
+	ssndSizePos      int64
+	ssndPos          int64
+	samplesPerSecond int
+}
+
+const (
+	aiffFormChunkSizePos = 4
+
+	// aiffStreamingSize is the chunk size used when the output cannot be seeked to fix up the sizes
+	aiffStreamingSize = 0xFFFFFFFF
+
+	// aiffCommSize is the size of the COMM chunk body of an AIFF file
+	aiffCommSize = 18
+	// aiffSsndHeaderSize is the size of the SSND chunk body before the sample data
+	aiffSsndHeaderSize = 8
+	// aiffVersion is the AIFF-C version timestamp held in the FVER chunk
+	aiffVersion = 0xA2805140
+
+	// aiffMaxMarkers is the largest marker ID of the MARK chunk
+	aiffMaxMarkers = math.MaxInt16
+)
+
+// AIFF-C compression types
+const (
+	aifcCompressionNone  = "NONE"
+	aifcCompressionSowt  = "sowt"
+	aifcCompressionFloat = "fl32"
+)
+
+// aifcCompressionNames is the human-readable name of each AIFF-C compression type
+var aifcCompressionNames = map[string]string{
+	aifcCompressionNone:  "not compressed",
+	aifcCompressionSowt:  "",
+	aifcCompressionFloat: "32-bit floating point",
+}
+
+// aiffTextChunks maps the well-known tag names to their text chunk IDs
+var aiffTextChunks = map[string]string{
+	"COPYRIGHT": "(c) ",
+}
+
+func newFileAiffDevice(settings Settings) (Device, error) {
+	return newAiffDevice(settings, false)
+}
+
+func newFileAifcDevice(settings Settings) (Device, error) {
+	return newAiffDevice(settings, true)
+}
+
+// newAiffDevice creates an AIFF file device; AIFF-C is written when aifc is set,
+// or when the samples cannot be held by a plain AIFF file
+func newAiffDevice(settings Settings, aifc bool) (Device, error) {
+	fd := fileDeviceAiff{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		order:            binary.BigEndian,
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// sizes are fixed up on Close when the output is seekable
+	fd.streaming = !out.Seekable()
+	initialSize := uint32(0)
+	if fd.streaming {
+		initialSize = aiffStreamingSize
+	}
+
+	sampleFormat := fd.mix.Format
+	compression := aifcCompressionNone
+	if sampleFormat.IsFloat() {
+		compression = aifcCompressionFloat
+	} else if opts, ok := settings.Options.(*AiffOptions); ok && opts != nil && opts.LittleEndian && sampleFormat != SampleFormatInt8 {
+		compression = aifcCompressionSowt
+		fd.order = binary.LittleEndian
+	}
+	if compression != aifcCompressionNone {
+		aifc = true
+	}
+	bitsPerSample := sampleFormat.BitsPerSample()
+	fd.blockAlign = settings.Channels * bitsPerSample / 8
+
+	w := bufio.NewWriter(out.w)
+	formType := "AIFF"
+	if aifc {
+		formType = "AIFC"
+	}
+	// FORM header
+	if _, err := w.Write([]byte("FORM")); err != nil { // ChunkID
+		return nil, err
+	}
+	if err := binary.Write(w, binary.BigEndian, initialSize); err != nil { // ChunkSize
+		return nil, err
+	}
+	if _, err := w.Write([]byte(formType)); err != nil { // FormType
+		return nil, err
+	}
+	hdrLen := int64(12)
+
+	// FVER header - required by AIFF-C
+	if aifc {
+		var fver [4]byte
+		binary.BigEndian.PutUint32(fver[:], aiffVersion) // Timestamp
+		n, err := writeAiffChunk(w, "FVER", fver[:])
+		if err != nil {
+			return nil, err
+		}
+		hdrLen += n
+	}
+
+	// COMM header
+	comm := make([]byte, aiffCommSize)
+	binary.BigEndian.PutUint16(comm[0:], uint16(settings.Channels)) // NumChannels
+	binary.BigEndian.PutUint32(comm[2:], initialSize)               // NumSampleFrames
+	binary.BigEndian.PutUint16(comm[6:], uint16(bitsPerSample))     // SampleSize
+	putExtended(comm[8:], uint64(fd.samplesPerSecond))              // SampleRate
+	if aifc {
+		comm = append(comm, compression...)                                    // CompressionType
+		comm = append(comm, aiffPString(aifcCompressionNames[compression])...) // CompressionName
+	}
+	fd.numFramesPos = hdrLen + 8 + 2
+	n, err := writeAiffChunk(w, "COMM", comm)
+	if err != nil {
+		return nil, err
+	}
+	hdrLen += n
+
+	// NAME, AUTH, (c) and ANNO headers
+	texts := [][2]string{
+		{"NAME", settings.Metadata.Title},
+		{"AUTH", settings.Metadata.Artist},
+	}
+	for _, name := range settings.Metadata.tagNames() {
+		if id, ok := aiffTextChunks[name]; ok {
+			texts = append(texts, [2]string{id, settings.Metadata.Tags[name]})
+		}
+	}
+	texts = append(texts, [2]string{"ANNO", settings.Metadata.Comment})
+	for _, t := range texts {
+		if t[1] == "" {
+			continue
+		}
+		n, err := writeAiffChunk(w, t[0], []byte(t[1]))
+		if err != nil {
+			return nil, err
+		}
+		hdrLen += n
+	}
+
+	// SSND header
+	if _, err := w.Write([]byte("SSND")); err != nil { // ChunkID
+		return nil, err
+	}
+	if err := binary.Write(w, binary.BigEndian, initialSize); err != nil { // ChunkSize
+		return nil, err
+	}
+	// the sample data is not aligned to blocks
+	if _, err := w.Write(make([]byte, aiffSsndHeaderSize)); err != nil { // Offset, BlockSize
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	fd.ssndSizePos = hdrLen + 4
+	fd.ssndPos = hdrLen + 8
+
+	return &fd, nil
+}
+
+// Play starts the aiff output device playing
+func (d *fileDeviceAiff) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the aiff output device playing
+func (d *fileDeviceAiff) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		sz, err := d.w.Write(encodeSamples(mixedData, d.mix.Format, d.order))
+		if err != nil {
+			return err
+		}
+		d.sz += uint64(sz)
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the aiff output device
+func (d *fileDeviceAiff) Close() {
+	if d.w == nil {
+		return
+	}
+	d.w.Flush()
+	defer d.out.Close()
+	_ = d.markers.writeCueSheet("AIFF", d.samplesPerSecond)
+	if d.streaming {
+		d.w = nil
+		return
+	}
+	// chunks must be padded to an even size
+	pad := d.sz & 1
+	if pad != 0 {
+		if err := d.w.WriteByte(0); err != nil {
+			return
+		}
+	}
+	// MARK header - the markers follow the sample data
+	tail := int64(0)
+	if markers := d.markers.embedded(); len(markers) > 0 {
+		n, err := writeAiffChunk(d.w, "MARK", aiffMarkers(markers))
+		if err != nil {
+			return
+		}
+		tail += n
+	}
+	d.w.Flush()
+
+	ssndSize := aiffSsndHeaderSize + d.sz
+	formSize := uint64(d.ssndPos) + aiffSsndHeaderSize - 8 + d.sz + pad + uint64(tail)
+	if err := d.out.SeekTo(aiffFormChunkSizePos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.BigEndian, uint32(formSize)); err != nil { // ChunkSize
+		return
+	}
+	d.w.Flush()
+	if err := d.out.SeekTo(d.numFramesPos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.BigEndian, uint32(d.sz/uint64(d.blockAlign))); err != nil { // NumSampleFrames
+		return
+	}
+	d.w.Flush()
+	if err := d.out.SeekTo(d.ssndSizePos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.BigEndian, uint32(ssndSize)); err != nil { // ChunkSize
+		return
+	}
+	d.w.Flush()
+	d.w = nil
+}
+
+// writeAiffChunk writes a chunk, padded to an even size, returning the number of bytes written
+func writeAiffChunk(w io.Writer, id string, body []byte) (int64, error) {
+	if _, err := w.Write([]byte(id)); err != nil { // ChunkID
+		return 0, err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(body))); err != nil { // ChunkSize
+		return 0, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return 0, err
+	}
+	n := int64(8 + len(body))
+	if len(body)&1 != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// aiffPString returns s as a Pascal-style string, padded to an even size
+func aiffPString(s string) []byte {
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	b := append([]byte{byte(len(s))}, s...)
+	if len(b)&1 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// aiffMarkers returns the body of a MARK chunk holding the markers, identified by their index + 1.
+// Markers beyond the reach of a 32-bit position are not written.
+func aiffMarkers(markers []marker) []byte {
+	b := make([]byte, 2)
+	count := 0
+	for i, m := range markers {
+		if i >= aiffMaxMarkers || m.Frame > math.MaxUint32 {
+			break
+		}
+		var hdr [6]byte
+		binary.BigEndian.PutUint16(hdr[0:], uint16(i+1))     // ID
+		binary.BigEndian.PutUint32(hdr[2:], uint32(m.Frame)) // Position
+		b = append(b, hdr[:]...)
+		b = append(b, aiffPString(m.Label)...) // MarkerName
+		count++
+	}
+	binary.BigEndian.PutUint16(b[0:], uint16(count)) // NumMarkers
+	return b
+}
+
+// putExtended stores v as an 80-bit IEEE 754 extended precision float
+func putExtended(b []byte, v uint64) {
+	if v == 0 {
+		for i := range b[:10] {
+			b[i] = 0
+		}
+		return
+	}
+	exp := bits.Len64(v) - 1
+	binary.BigEndian.PutUint16(b[0:], uint16(16383+exp))
+	binary.BigEndian.PutUint64(b[2:], v<<(63-exp))
+}
+
+func init() {
+	capabilities := Capabilities{
+		Channels:            mixerChannels(),
+		MinSamplesPerSecond: 1,
+		MaxSamplesPerSecond: math.MaxInt32,
+		SampleFormats:       allSampleFormats(),
+	}
+	RegisterFileFormat(FileFormat{
+		Name:         "aiff",
+		Extensions:   []string{".aif", ".aiff"},
+		Description:  "Audio Interchange File Format",
+		Create:       newFileAiffDevice,
+		Capabilities: capabilities,
+	})
+	RegisterFileFormat(FileFormat{
+		Name:         "aifc",
+		Extensions:   []string{".aifc"},
+		Description:  "Audio Interchange File Format, compressed",
+		Create:       newFileAifcDevice,
+		Capabilities: capabilities,
+	})
+}
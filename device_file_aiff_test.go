@@ -0,0 +1,101 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testAiffChunks checks the FORM header of an AIFF file, returning its form type and chunks
+func testAiffChunks(t *testing.T, b []byte) (string, []testChunk) {
+	t.Helper()
+	if len(b) < 12 || string(b[0:4]) != "FORM" {
+		t.Fatal("no FORM header")
+	}
+	if size := binary.BigEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("FORM size %d, want %d", size, len(b)-8)
+	}
+	var chunks []testChunk
+	for pos := 12; pos < len(b); {
+		if pos+8 > len(b) {
+			t.Fatalf("truncated chunk header at %d", pos)
+		}
+		id := string(b[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(b[pos+4:]))
+		if pos+8+size > len(b) {
+			t.Fatalf("%q chunk of %d bytes overruns the file", id, size)
+		}
+		chunks = append(chunks, testChunk{id: id, body: b[pos+8 : pos+8+size]})
+		pos += 8 + size + size&1
+	}
+	return string(b[8:12]), chunks
+}
+
+func TestAiffRoundTrip(t *testing.T) {
+	rows := testMarked(testSignal(2, 101, testRowLen, testSampleRate))
+	frames := uint32(101 * testRowLen)
+	for _, tc := range []struct {
+		format      string
+		bits        int
+		opts        *AiffOptions
+		formType    string
+		compression string
+		order       binary.ByteOrder
+	}{
+		{"aiff", 16, nil, "AIFF", "", binary.BigEndian},
+		{"aiff", 8, nil, "AIFF", "", binary.BigEndian},
+		{"aiff", 24, nil, "AIFF", "", binary.BigEndian},
+		{"aifc", 16, nil, "AIFC", aifcCompressionNone, binary.BigEndian},
+		{"aiff", 16, &AiffOptions{LittleEndian: true}, "AIFC", aifcCompressionSowt, binary.LittleEndian},
+		{"aiff", 24, &AiffOptions{LittleEndian: true}, "AIFC", aifcCompressionSowt, binary.LittleEndian},
+	} {
+		for _, channels := range []int{1, 2} {
+			s := Settings{Channels: channels, BitsPerSample: tc.bits, Markers: true}
+			want := testCapture(t, s, rows).Samples()
+			s.Options = tc.opts
+			formType, chunks := testAiffChunks(t, testRenderFile(t, tc.format, s, rows))
+			if formType != tc.formType {
+				t.Fatalf("%s, %d bits: form type %q, want %q", tc.format, tc.bits, formType, tc.formType)
+			}
+
+			comm := testFindChunk(t, chunks, "COMM")
+			if n := binary.BigEndian.Uint16(comm[0:]); int(n) != channels {
+				t.Errorf("%s, %d bits: %d channels, want %d", tc.format, tc.bits, n, channels)
+			}
+			if n := binary.BigEndian.Uint32(comm[2:]); n != frames {
+				t.Errorf("%s, %d bits: %d sample frames, want %d", tc.format, tc.bits, n, frames)
+			}
+			if n := binary.BigEndian.Uint16(comm[6:]); int(n) != tc.bits {
+				t.Errorf("%s, %d bits: sample size %d", tc.format, tc.bits, n)
+			}
+			if tc.formType == "AIFC" {
+				testFindChunk(t, chunks, "FVER")
+				if c := string(comm[aiffCommSize : aiffCommSize+4]); c != tc.compression {
+					t.Errorf("%s, %d bits: compression %q, want %q", tc.format, tc.bits, c, tc.compression)
+				}
+			}
+
+			ssnd := testFindChunk(t, chunks, "SSND")
+			if len(ssnd) != aiffSsndHeaderSize+int(frames)*channels*tc.bits/8 {
+				t.Fatalf("%s, %d bits: SSND size %d", tc.format, tc.bits, len(ssnd))
+			}
+			got := testDecodeInts(ssnd[aiffSsndHeaderSize:], channels, sampleFormatForBits(tc.bits), tc.order)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s, %d bits, %d channels: samples differ", tc.format, tc.bits, channels)
+			}
+
+			mark := testFindChunk(t, chunks, "MARK")
+			if n := binary.BigEndian.Uint16(mark); n != 3 {
+				t.Errorf("%s, %d bits: %d markers, want 3", tc.format, tc.bits, n)
+			}
+		}
+	}
+}
+
+func TestAiffNotSeekable(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	b := testRenderStream(t, "aiff", Settings{}, rows)
+	if size := binary.BigEndian.Uint32(b[4:]); size != aiffStreamingSize {
+		t.Fatalf("FORM size %d written to a stream that cannot seek", size)
+	}
+}
@@ -0,0 +1,217 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+// AuEncoding is the encoding of the samples in a Sun AU file
+type AuEncoding int
+
+const (
+	// AuEncodingLinear writes the samples in the stream's sample format
+	AuEncodingLinear = AuEncoding(iota)
+	// AuEncodingMuLaw writes 8-bit G.711 μ-law samples
+	AuEncodingMuLaw
+	// AuEncodingALaw writes 8-bit G.711 A-law samples
+	AuEncodingALaw
+)
+
+// AuOptions is the set of options for the Sun AU file format
+type AuOptions struct {
+	Encoding AuEncoding
+}
+
+type fileDeviceAu struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+	encoding         AuEncoding
+
+	out *fileOutput
+	w   *bufio.Writer
+	sz  uint64
+}
+
+const (
+	auDataSizePos = 8
+
+	// auHeaderSize is the size of the header, before the annotation
+	auHeaderSize = 24
+	// auUnknownSize is the data size used when the size is not known
+	auUnknownSize = 0xFFFFFFFF
+)
+
+// Sun AU encodings
+const (
+	auEncodingMuLaw    = 1
+	auEncodingLinear8  = 2
+	auEncodingLinear16 = 3
+	auEncodingLinear24 = 4
+	auEncodingLinear32 = 5
+	auEncodingFloat    = 6
+	auEncodingALaw     = 27
+)
+
+// auLinearEncodings is the Sun AU encoding of each sample format
+var auLinearEncodings = map[SampleFormat]uint32{
+	SampleFormatInt8:    auEncodingLinear8,
+	SampleFormatInt16:   auEncodingLinear16,
+	SampleFormatInt24:   auEncodingLinear24,
+	SampleFormatInt32:   auEncodingLinear32,
+	SampleFormatFloat32: auEncodingFloat,
+}
+
+func newFileAuDevice(settings Settings) (Device, error) {
+	fd := fileDeviceAu{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	if opts, ok := settings.Options.(*AuOptions); ok && opts != nil {
+		fd.encoding = opts.Encoding
+	}
+	var encoding uint32
+	switch fd.encoding {
+	case AuEncodingLinear:
+		encoding = auLinearEncodings[fd.mix.Format]
+	case AuEncodingMuLaw:
+		encoding = auEncodingMuLaw
+	case AuEncodingALaw:
+		encoding = auEncodingALaw
+	}
+	if encoding == 0 {
+		return nil, errors.New("invalid encoding for au")
+	}
+
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// the annotation is NUL terminated, and padded so the data starts on an 8 byte boundary
+	annotation := append([]byte(settings.Metadata.Title), 0)
+	for len(annotation) < 4 || len(annotation)%8 != 0 {
+		annotation = append(annotation, 0)
+	}
+
+	hdr := make([]byte, auHeaderSize)
+	copy(hdr[0:], ".snd")                                                     // Magic
+	binary.BigEndian.PutUint32(hdr[4:], uint32(auHeaderSize+len(annotation))) // DataOffset
+	binary.BigEndian.PutUint32(hdr[8:], auUnknownSize)                        // DataSize
+	binary.BigEndian.PutUint32(hdr[12:], encoding)                            // Encoding
+	binary.BigEndian.PutUint32(hdr[16:], uint32(settings.SamplesPerSecond))   // SampleRate
+	binary.BigEndian.PutUint32(hdr[20:], uint32(settings.Channels))           // Channels
+
+	w := bufio.NewWriter(out.w)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(annotation); err != nil {
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	return &fd, nil
+}
+
+// Play starts the au output device playing
+func (d *fileDeviceAu) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the au output device playing
+func (d *fileDeviceAu) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		sz, err := d.w.Write(d.encode(mixedData))
+		if err != nil {
+			return err
+		}
+		d.sz += uint64(sz)
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// encode returns the interleaved sample data in the encoding of the file
+func (d *fileDeviceAu) encode(data [][]int32) []byte {
+	var compand func(int16) byte
+	switch d.encoding {
+	case AuEncodingMuLaw:
+		compand = linearToMuLaw
+	case AuEncodingALaw:
+		compand = linearToALaw
+	default:
+		return encodeSamples(data, d.mix.Format, binary.BigEndian)
+	}
+	out := make([]byte, 0, len(data)*len(data[0]))
+	for i := range data[0] {
+		for _, samples := range data {
+			out = append(out, compand(sampleTo16(samples[i], d.mix.Format)))
+		}
+	}
+	return out
+}
+
+// Close closes the au output device
+func (d *fileDeviceAu) Close() {
+	if d.w == nil {
+		return
+	}
+	d.w.Flush()
+	defer d.out.Close()
+	_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+	// the data size is optional, so it is left unknown if it does not fit
+	if d.out.Seekable() && d.sz < auUnknownSize {
+		if err := d.out.SeekTo(auDataSizePos); err != nil {
+			return
+		}
+		if err := binary.Write(d.w, binary.BigEndian, uint32(d.sz)); err != nil { // DataSize
+			return
+		}
+		d.w.Flush()
+	}
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "au",
+		Extensions:  []string{".au", ".snd"},
+		Description: "Sun/NeXT audio",
+		Create:      newFileAuDevice,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestAuRoundTrip(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	frames := 20 * testRowLen
+	for _, bits := range []int{8, 16, 24, 32} {
+		s := Settings{BitsPerSample: bits, Metadata: Metadata{Title: "tones"}}
+		want := testCapture(t, s, rows).Samples()
+		b := testRenderFile(t, "au", s, rows)
+		if string(b[0:4]) != ".snd" {
+			t.Fatal("no .snd header")
+		}
+		offset := binary.BigEndian.Uint32(b[4:])
+		// the title, NUL terminated and padded to 8 bytes, follows the header
+		if offset != auHeaderSize+8 || string(b[auHeaderSize:auHeaderSize+6]) != "tones\x00" {
+			t.Fatalf("%d bits: data offset %d", bits, offset)
+		}
+		size := binary.BigEndian.Uint32(b[auDataSizePos:])
+		if int(size) != len(b)-int(offset) || int(size) != frames*2*bits/8 {
+			t.Fatalf("%d bits: data size %d for %d bytes of data", bits, size, len(b)-int(offset))
+		}
+		if enc := binary.BigEndian.Uint32(b[12:]); enc != auLinearEncodings[sampleFormatForBits(bits)] {
+			t.Errorf("%d bits: encoding %d", bits, enc)
+		}
+		if rate, channels := binary.BigEndian.Uint32(b[16:]), binary.BigEndian.Uint32(b[20:]); rate != testSampleRate || channels != 2 {
+			t.Errorf("%d bits: %d Hz, %d channels", bits, rate, channels)
+		}
+		got := testDecodeInts(b[offset:], 2, sampleFormatForBits(bits), binary.BigEndian)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d bits: samples differ", bits)
+		}
+	}
+}
+
+func TestAuCompanded(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	want := testCapture(t, Settings{}, rows).Float32()
+	for _, tc := range []struct {
+		name     string
+		encoding AuEncoding
+		id       uint32
+		expand   func(byte) int16
+	}{
+		{"μ-law", AuEncodingMuLaw, auEncodingMuLaw, testMuLawToLinear},
+		{"A-law", AuEncodingALaw, auEncodingALaw, testALawToLinear},
+	} {
+		b := testRenderFile(t, "au", Settings{Options: &AuOptions{Encoding: tc.encoding}}, rows)
+		if enc := binary.BigEndian.Uint32(b[12:]); enc != tc.id {
+			t.Fatalf("%s: encoding %d", tc.name, enc)
+		}
+		offset := binary.BigEndian.Uint32(b[4:])
+		data := b[offset:]
+		if size := binary.BigEndian.Uint32(b[auDataSizePos:]); int(size) != len(data) || len(data) != 2*len(want[0]) {
+			t.Fatalf("%s: data size %d for %d bytes of data", tc.name, size, len(data))
+		}
+		got := make([][]float32, 2)
+		for i, v := range data {
+			got[i%2] = append(got[i%2], float32(tc.expand(v))/32768)
+		}
+		if snr := testSNR(want, got); snr < 30 {
+			t.Errorf("%s: SNR %.1f dB", tc.name, snr)
+		}
+	}
+}
+
+func TestAuNotSeekable(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	b := testRenderStream(t, "au", Settings{}, rows)
+	if size := binary.BigEndian.Uint32(b[auDataSizePos:]); size != auUnknownSize {
+		t.Fatalf("data size %d written to a stream that cannot seek", size)
+	}
+}
@@ -4,9 +4,12 @@ package gosound
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/binary"
 	"errors"
-	"os"
+	"hash"
 
 	"github.com/mewkiz/flac"
 	"github.com/mewkiz/flac/frame"
@@ -15,38 +18,234 @@ import (
 	"github.com/gotracker/gomixing/mixing"
 )
 
+const (
+	flacMaxChannels   = 8
+	flacMaxSampleRate = 655350
+)
+
+// flacChannels returns the channel counts supported by both the mixer and FLAC
+func flacChannels() []int {
+	var channels []int
+	for _, c := range mixerChannels() {
+		if c <= flacMaxChannels {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+// FlacOptions is the set of options for the FLAC file format
+type FlacOptions struct {
+	// CompressionLevel trades encoding speed for file size, from 0 (fastest) to 8 (smallest).
+	// When no options are provided, level 5 is used.
+	CompressionLevel int
+	// SeekPoints is the number of seek points reserved in the SEEKTABLE, which is filled in on Close.
+	// When 0, 100 points are reserved; when negative, no SEEKTABLE is written.
+	SeekPoints int
+	// Padding is the size of the PADDING block left for editing tags later.
+	// When 0, 8192 bytes are reserved, or enough for a CUESHEET of 254 markers if Settings.Markers is set;
+	// when negative, no PADDING is written.
+	// Markers are written on Close in the space left by the padding. If they do not fit, or the output
+	// cannot be seeked, they are written to a .cue file next to Settings.Filepath instead.
+	Padding int
+	// ChapterComments writes the markers as Vorbis chapter comments, instead of a CUESHEET
+	ChapterComments bool
+}
+
 type fileDeviceFlac struct {
 	fileDevice
-	mix              mixing.Mixer
+	mix              sampleMixer
 	samplesPerSecond int
+	level            flacLevel
 
-	f *os.File
-	w *bufio.Writer
+	out     *fileOutput
+	w       *bufio.Writer
+	cw      *countingWriter
+	enc     *flac.Encoder
+	info    meta.StreamInfo
+	md5sum  hash.Hash
+	pending [][]int32
+
+	seekPoints    int
+	firstFramePos int64
+	seekFrames    []meta.SeekPoint
+
+	comments        [][2]string
+	chapterComments bool
+	// markerPos is the position of the metadata blocks rewritten to hold the markers, or -1 if they cannot be written
+	markerPos  int64
+	markerRoom int
+
+	// container is the container format of the frames, or nil for a native FLAC stream
+	container *flacContainer
+	mux       containerMuxer
+	frameBuf  bytes.Buffer
+}
+
+// flacContainer wraps the FLAC frames in a container format, each frame as a packet
+type flacContainer struct {
+	// header returns the codec header of the container, holding the STREAMINFO body
+	header func(streamInfo []byte) []byte
+	// newMuxer writes the start of the container, with the codec header holding the STREAMINFO body
+	newMuxer func(d *fileDeviceFlac, settings Settings, streamInfo []byte) (containerMuxer, error)
 }
 
+const (
+	// flacStreamInfoPos is the position of the STREAMINFO body, after the stream marker and metadata block header
+	flacStreamInfoPos = 8
+	// flacStreamInfoSize is the size of the STREAMINFO body
+	flacStreamInfoSize = 34
+	// flacSeekTablePos is the position of the SEEKTABLE body, which directly follows the STREAMINFO block
+	flacSeekTablePos = flacStreamInfoPos + flacStreamInfoSize + 4
+	// flacSeekPointSize is the size of each point in the SEEKTABLE
+	flacSeekPointSize = 18
+
+	flacDefaultSeekPoints = 100
+	flacDefaultPadding    = 8192
+
+	flacVendor = "gosound"
+)
+
 func newFileFlacDevice(settings Settings) (Device, error) {
+	opts := FlacOptions{
+		CompressionLevel: flacDefaultCompressionLevel,
+	}
+	if o, ok := settings.Options.(*FlacOptions); ok && o != nil {
+		opts = *o
+	}
+	return newFlacDevice(settings, opts, nil)
+}
+
+// newFlacDevice returns a device writing FLAC frames into the container, or a native FLAC stream if it is nil.
+// The metadata blocks are only written into a native FLAC stream.
+func newFlacDevice(settings Settings, opts FlacOptions, container *flacContainer) (Device, error) {
 	fd := fileDeviceFlac{
-		fileDevice: fileDevice{
-			device: device{
-				onRowOutput: settings.OnRowOutput,
-			},
-		},
-		mix: mixing.Mixer{
-			Channels:      settings.Channels,
-			BitsPerSample: settings.BitsPerSample,
-		},
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
 		samplesPerSecond: settings.SamplesPerSecond,
+		level:            flacCompressionLevel(opts.CompressionLevel),
+		md5sum:           md5.New(),
+		pending:          make([][]int32, settings.Channels),
+		comments:         settings.Metadata.vorbisComments(),
+		chapterComments:  opts.ChapterComments,
+		markerPos:        -1,
+		container:        container,
 	}
-	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	seekPoints := flacDefaultSeekPoints
+	if opts.SeekPoints != 0 {
+		seekPoints = opts.SeekPoints
+	}
+	padding := flacDefaultPadding
+	if settings.Markers && !opts.ChapterComments && padding < flacMaxCueSheetSize+4 {
+		// the CUESHEET takes the place of some of the padding, which is left with at least its header
+		padding = flacMaxCueSheetSize + 4
+	}
+	if opts.Padding != 0 {
+		padding = opts.Padding
+	}
+	if container != nil {
+		seekPoints, padding = 0, 0
+	}
+	if fd.mix.Channels < 1 || fd.mix.Channels > flacMaxChannels {
+		return nil, errors.New("invalid channel count for flac")
+	}
+	switch fd.mix.Format {
+	case SampleFormatInt8, SampleFormatInt16, SampleFormatInt24:
+	default:
+		return nil, errors.New("invalid sample format for flac")
+	}
+
+	out, err := openFileOutput(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	if f == nil {
-		return nil, errors.New("unexpected file error")
+	// every frame but the last holds exactly one block; the sizes
+	// and the rest of the stream details are fixed up on Close
+	fd.info = meta.StreamInfo{
+		BlockSizeMin:  uint16(fd.level.blockSize),
+		BlockSizeMax:  uint16(fd.level.blockSize),
+		SampleRate:    uint32(fd.samplesPerSecond),
+		NChannels:     uint8(fd.mix.Channels),
+		BitsPerSample: uint8(fd.mix.Format.BitsPerSample()),
 	}
 
-	fd.f = f
+	var blocks []*meta.Block
+	// the seek table can only be filled in if the output is seekable
+	if seekPoints > 0 && out.Seekable() {
+		fd.seekPoints = seekPoints
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{
+				Type:   meta.TypeSeekTable,
+				Length: int64(seekPoints * flacSeekPointSize),
+			},
+			Body: &meta.SeekTable{
+				Points: flacSeekPlaceholders(seekPoints),
+			},
+		})
+	}
+	if len(fd.comments) > 0 && container == nil {
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{
+				Type:   meta.TypeVorbisComment,
+				Length: int64(len(flacVorbisCommentBytes(fd.comments))),
+			},
+			Body: &meta.VorbisComment{
+				Vendor: flacVendor,
+				Tags:   fd.comments,
+			},
+		})
+	}
+	if padding > 0 {
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{
+				Type:   meta.TypePadding,
+				Length: int64(padding),
+			},
+		})
+	}
+	if len(blocks) > 0 {
+		blocks[len(blocks)-1].IsLast = true
+	}
+
+	// the markers replace the comments and padding, which are the last blocks
+	if fd.markers.embed && padding > 0 && out.Seekable() {
+		pos := int64(flacSeekTablePos - 4)
+		for _, b := range blocks {
+			if fd.markerPos < 0 && (b.Type == meta.TypeVorbisComment || b.Type == meta.TypePadding) {
+				fd.markerPos = pos
+			}
+			pos += 4 + b.Length
+		}
+		fd.markerRoom = int(pos - fd.markerPos)
+	}
+
+	fd.out = out
+	fd.w = bufio.NewWriter(out.w)
+	fd.cw = &countingWriter{w: fd.w}
+	if container != nil {
+		// the frames are encoded into a buffer, from which each is written as a packet
+		fd.cw.w = &fd.frameBuf
+	}
+	si := fd.info
+	enc, err := flac.NewEncoder(fd.cw, &si, blocks...)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	fd.enc = enc
+	fd.firstFramePos = fd.cw.n
+
+	if container != nil {
+		// the native stream header is replaced by the header of the container
+		fd.frameBuf.Reset()
+		mux, err := container.newMuxer(&fd, settings, flacStreamInfoBytes(&fd.info))
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		fd.mux = mux
+	}
 
 	return &fd, nil
 }
@@ -58,100 +257,251 @@ func (d *fileDeviceFlac) Play(in <-chan *PremixData) error {
 
 // PlayWithCtx starts the wave output device playing
 func (d *fileDeviceFlac) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
-	w := bufio.NewWriter(d.f)
-	d.w = w
-	// Encode FLAC stream.
-	si := &meta.StreamInfo{
-		BlockSizeMin:  16,
-		BlockSizeMax:  65535,
-		SampleRate:    uint32(d.samplesPerSecond),
-		NChannels:     uint8(d.mix.Channels),
-		BitsPerSample: uint8(d.mix.BitsPerSample),
-	}
-	enc, err := flac.NewEncoder(w, si)
-	if err != nil {
-		return err
-	}
-	defer enc.Close()
-
 	panmixer := mixing.GetPanMixer(d.mix.Channels)
 	if panmixer == nil {
 		return errors.New("invalid pan mixer - check channel count")
 	}
 
-	var channels frame.Channels
-	switch d.mix.Channels {
-	case 1:
-		channels = frame.ChannelsMono
-	case 2:
-		channels = frame.ChannelsLR
-	case 4:
-		channels = frame.ChannelsLRLsRs
-	}
-
 	myCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	defer d.ctl.reset()
 	for {
-		select {
-		case <-myCtx.Done():
-			return myCtx.Err()
-		case row, ok := <-in:
-			if !ok {
-				return nil
-			}
-			mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
-			subframes := make([]*frame.Subframe, d.mix.Channels)
-			for i := range subframes {
-				subframe := &frame.Subframe{
-					SubHeader: frame.SubHeader{
-						Pred: frame.PredVerbatim,
-					},
-					Samples:  mixedData[i],
-					NSamples: row.SamplesLen,
-				}
-				subframes[i] = subframe
-			}
-			for _, subframe := range subframes {
-				sample := subframe.Samples[0]
-				constant := true
-				for _, s := range subframe.Samples[1:] {
-					if sample != s {
-						constant = false
-					}
-				}
-				if constant {
-					subframe.SubHeader.Pred = frame.PredConstant
-				}
-			}
-
-			fr := &frame.Frame{
-				Header: frame.Header{
-					HasFixedBlockSize: false,
-					BlockSize:         uint16(row.SamplesLen),
-					SampleRate:        uint32(d.samplesPerSecond),
-					Channels:          channels,
-					BitsPerSample:     uint8(d.mix.BitsPerSample),
-				},
-				Subframes: subframes,
-			}
-			if err := enc.WriteFrame(fr); err != nil {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		for c := range d.pending {
+			d.pending[c] = append(d.pending[c], mixedData[c]...)
+		}
+		// rows are re-blocked into frames of the block size
+		for len(d.pending[0]) >= d.level.blockSize {
+			if err := d.writeFrame(d.level.blockSize); err != nil {
 				return err
 			}
-			if d.onRowOutput != nil {
-				d.onRowOutput(KindFile, row)
-			}
+		}
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
 		}
 	}
 }
 
+// writeFrame encodes the first n pending samples of each channel as a frame
+func (d *fileDeviceFlac) writeFrame(n int) error {
+	samples := make([][]int32, len(d.pending))
+	for c, p := range d.pending {
+		samples[c] = p[:n]
+		d.pending[c] = append([]int32(nil), p[n:]...)
+	}
+	subframes, channels := d.level.encodeFrame(samples, d.mix.Format.BitsPerSample())
+
+	fr := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(n),
+			SampleRate:        uint32(d.samplesPerSecond),
+			Channels:          channels,
+			BitsPerSample:     uint8(d.mix.Format.BitsPerSample()),
+		},
+		Subframes: subframes,
+	}
+	fr.Hash(d.md5sum)
+
+	start := d.cw.n
+	if d.seekPoints > 0 {
+		d.seekFrames = append(d.seekFrames, meta.SeekPoint{
+			SampleNum: d.info.NSamples,
+			Offset:    uint64(start - d.firstFramePos),
+			NSamples:  uint16(n),
+		})
+	}
+	if err := d.enc.WriteFrame(fr); err != nil {
+		return err
+	}
+	frameSize := uint32(d.cw.n - start)
+	if d.mux != nil {
+		err := d.mux.writePacket(d.frameBuf.Bytes(), n)
+		d.frameBuf.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	if d.info.FrameSizeMin == 0 || frameSize < d.info.FrameSizeMin {
+		d.info.FrameSizeMin = frameSize
+	}
+	if frameSize > d.info.FrameSizeMax {
+		d.info.FrameSizeMax = frameSize
+	}
+	d.info.NSamples += uint64(n)
+	return nil
+}
+
 // Close closes the wave output device
 func (d *fileDeviceFlac) Close() {
+	if d.w == nil {
+		return
+	}
+	defer d.out.Close()
+	// the last frame holds the remaining samples, and may be shorter than the block size
+	if n := len(d.pending[0]); n > 0 {
+		if err := d.writeFrame(n); err != nil {
+			return
+		}
+	}
+	d.enc.Close()
+	copy(d.info.MD5sum[:], d.md5sum.Sum(nil))
+	if d.mux != nil {
+		_ = d.mux.close(d.container.header(flacStreamInfoBytes(&d.info)))
+		_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+		d.w = nil
+		return
+	}
 	d.w.Flush()
+	// the .cue file is written last, as it may take the markers that do not fit in the file
+	defer func() {
+		_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+	}()
+	if !d.out.Seekable() {
+		_ = d.writeMarkers()
+		d.w = nil
+		return
+	}
+
+	if err := d.out.SeekTo(flacStreamInfoPos); err != nil {
+		return
+	}
+	if _, err := d.w.Write(flacStreamInfoBytes(&d.info)); err != nil {
+		return
+	}
+	d.w.Flush()
+
+	if d.seekPoints > 0 {
+		if err := d.out.SeekTo(flacSeekTablePos); err != nil {
+			return
+		}
+		for _, p := range d.seekTable() {
+			if err := binary.Write(d.w, binary.BigEndian, p); err != nil {
+				return
+			}
+		}
+		d.w.Flush()
+	}
+
+	if err := d.writeMarkers(); err != nil {
+		return
+	}
 	d.w = nil
-	d.f.Close()
+}
+
+// writeMarkers rewrites the comments and padding at the end of the metadata
+// to hold the markers, if they fit in the space left by the padding.
+// Otherwise, they are written to the .cue file.
+func (d *fileDeviceFlac) writeMarkers() error {
+	markers := d.markers.embedded()
+	if len(markers) == 0 {
+		return nil
+	}
+	if d.markerPos < 0 {
+		return d.markers.fallBackToCueSheet()
+	}
+	var b bytes.Buffer
+	comments := d.comments
+	if d.chapterComments {
+		comments = append(comments[:len(comments):len(comments)], flacChapterComments(markers, d.samplesPerSecond)...)
+	}
+	if len(comments) > 0 {
+		flacWriteBlock(&b, meta.TypeVorbisComment, false, flacVorbisCommentBytes(comments))
+	}
+	if !d.chapterComments {
+		flacWriteBlock(&b, meta.TypeCueSheet, false, flacCueSheetBytes(markers, d.info.NSamples))
+	}
+	padding := d.markerRoom - b.Len() - 4
+	if padding < 0 {
+		return d.markers.fallBackToCueSheet()
+	}
+	flacWriteBlock(&b, meta.TypePadding, true, make([]byte, padding))
+
+	if err := d.out.SeekTo(d.markerPos); err != nil {
+		return err
+	}
+	if _, err := d.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+// seekTable returns the seek points for frames evenly spread through the stream.
+// Points that are not needed are left as placeholders.
+func (d *fileDeviceFlac) seekTable() []meta.SeekPoint {
+	points := flacSeekPlaceholders(d.seekPoints)[:0]
+	if d.info.NSamples == 0 {
+		return points[:d.seekPoints]
+	}
+	f := 0
+	for i := 0; i < d.seekPoints; i++ {
+		target := d.info.NSamples * uint64(i) / uint64(d.seekPoints)
+		// find the frame holding the target sample
+		for f+1 < len(d.seekFrames) && d.seekFrames[f+1].SampleNum <= target {
+			f++
+		}
+		if len(points) > 0 && points[len(points)-1].SampleNum == d.seekFrames[f].SampleNum {
+			continue
+		}
+		points = append(points, d.seekFrames[f])
+	}
+	return points[:d.seekPoints]
+}
+
+// flacSeekPlaceholders returns a seek table of n placeholder points
+func flacSeekPlaceholders(n int) []meta.SeekPoint {
+	points := make([]meta.SeekPoint, n)
+	for i := range points {
+		points[i].SampleNum = meta.PlaceholderPoint
+	}
+	return points
+}
+
+// flacStreamInfoBytes returns the encoded body of the STREAMINFO metadata block
+func flacStreamInfoBytes(si *meta.StreamInfo) []byte {
+	b := make([]byte, flacStreamInfoSize)
+	binary.BigEndian.PutUint16(b[0:], si.BlockSizeMin)
+	binary.BigEndian.PutUint16(b[2:], si.BlockSizeMax)
+	putUint24(b[4:], si.FrameSizeMin)
+	putUint24(b[7:], si.FrameSizeMax)
+	// 20 bits sample rate, 3 bits channels - 1, 5 bits bits per sample - 1, 36 bits total samples
+	packed := uint64(si.SampleRate)<<44 |
+		uint64(si.NChannels-1)<<41 |
+		uint64(si.BitsPerSample-1)<<36 |
+		si.NSamples&(1<<36-1)
+	binary.BigEndian.PutUint64(b[10:], packed)
+	copy(b[18:], si.MD5sum[:])
+	return b
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
 }
 
 func init() {
-	fileDeviceMap[".flac"] = newFileFlacDevice
+	RegisterFileFormat(FileFormat{
+		Name:        "flac",
+		Extensions:  []string{".flac"},
+		Description: "Free Lossless Audio Codec",
+		Create:      newFileFlacDevice,
+		Capabilities: Capabilities{
+			Channels:            flacChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: flacMaxSampleRate,
+			SampleFormats:       []SampleFormat{SampleFormatInt8, SampleFormatInt16, SampleFormatInt24},
+		},
+	})
 }
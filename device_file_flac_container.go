@@ -0,0 +1,94 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+const (
+	// oggFlacMappingMajor and oggFlacMappingMinor are the version of the FLAC to Ogg mapping
+	oggFlacMappingMajor = 1
+	oggFlacMappingMinor = 0
+)
+
+// oggFlacContainer writes the frames into an Ogg bitstream. The first packet holds the STREAMINFO
+// block, and the second the VORBIS_COMMENT block. Markers are not embedded.
+var oggFlacContainer = flacContainer{
+	header: oggFlacHeader,
+	newMuxer: func(d *fileDeviceFlac, settings Settings, streamInfo []byte) (containerMuxer, error) {
+		var comments bytes.Buffer
+		flacWriteBlock(&comments, meta.TypeVorbisComment, true, flacVorbisCommentBytes(d.comments))
+		return newOggMuxer(d.out, d.w, oggFlacHeader(streamInfo), comments.Bytes())
+	},
+}
+
+// oggFlacHeader returns the first packet of an Ogg FLAC bitstream
+func oggFlacHeader(streamInfo []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(0x7f)
+	b.WriteString("FLAC")
+	b.WriteByte(oggFlacMappingMajor)
+	b.WriteByte(oggFlacMappingMinor)
+	// the number of header packets after this one
+	var n [2]byte
+	binary.BigEndian.PutUint16(n[:], 1)
+	b.Write(n[:])
+	b.WriteString("fLaC")
+	flacWriteBlock(&b, meta.TypeStreamInfo, false, streamInfo)
+	return b.Bytes()
+}
+
+// matroskaFlacContainer writes the frames as the blocks of a Matroska file, whose codec header
+// holds the STREAMINFO block
+var matroskaFlacContainer = flacContainer{
+	header: matroskaFlacHeader,
+	newMuxer: func(d *fileDeviceFlac, settings Settings, streamInfo []byte) (containerMuxer, error) {
+		track := matroskaTrack{
+			codecID:      "A_FLAC",
+			codecPrivate: matroskaFlacHeader(streamInfo),
+			channels:     d.mix.Channels,
+			rate:         d.samplesPerSecond,
+			bitDepth:     d.mix.Format.BitsPerSample(),
+		}
+		return newMatroskaMuxer(d.out, d.w, track, settings.Metadata, &d.markers)
+	},
+}
+
+// matroskaFlacHeader returns the codec header of FLAC in Matroska
+func matroskaFlacHeader(streamInfo []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	flacWriteBlock(&b, meta.TypeStreamInfo, true, streamInfo)
+	return b.Bytes()
+}
+
+func newFileOggFlacDevice(settings Settings) (Device, error) {
+	level := flacDefaultCompressionLevel
+	if opts, ok := settings.Options.(*FlacOptions); ok && opts != nil {
+		level = opts.CompressionLevel
+	}
+	return newFlacDevice(settings, FlacOptions{CompressionLevel: level}, &oggFlacContainer)
+}
+
+func init() {
+	newMatroskaFlacDevice = func(settings Settings, compressionLevel int) (Device, error) {
+		return newFlacDevice(settings, FlacOptions{CompressionLevel: compressionLevel}, &matroskaFlacContainer)
+	}
+
+	RegisterFileFormat(FileFormat{
+		Name:        "oga",
+		Extensions:  []string{".oga"},
+		Description: "Ogg FLAC",
+		Create:      newFileOggFlacDevice,
+		Capabilities: Capabilities{
+			Channels:            flacChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: flacMaxSampleRate,
+			SampleFormats:       []SampleFormat{SampleFormatInt8, SampleFormatInt16, SampleFormatInt24},
+		},
+	})
+}
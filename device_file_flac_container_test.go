@@ -0,0 +1,70 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestOggFlac(t *testing.T) {
+	rows := testSignal(2, testRows, testRowLen, testSampleRate)
+	for _, bits := range []int{8, 16, 24} {
+		s := Settings{BitsPerSample: bits, Metadata: Metadata{Title: "tones"}}
+		want := testCapture(t, s, rows).Samples()
+		b := testRenderFile(t, "oga", s, rows)
+		_, packets, pages := testOggStream(t, b)
+
+		// the first packet maps the STREAMINFO block, and is alone on the first page
+		header := packets[0]
+		if !bytes.HasPrefix(header, []byte("\x7fFLAC\x01\x00")) || binary.BigEndian.Uint16(header[7:]) != 1 || string(header[9:13]) != "fLaC" {
+			t.Fatalf("%d bits: first packet %x", bits, header[:13])
+		}
+		if pages[0].packets != 1 || pages[1].packets != 1 || pages[1].granule != 0 {
+			t.Fatalf("%d bits: header pages %+v", bits, pages[:2])
+		}
+		if g := pages[len(pages)-1].granule; g != testRows*testRowLen {
+			t.Fatalf("%d bits: last granule position %d, want %d", bits, g, testRows*testRowLen)
+		}
+
+		// the packets without their mapping are a native FLAC stream
+		native := append([]byte(nil), header[9:]...)
+		for _, p := range packets[1:] {
+			native = append(native, p...)
+		}
+		st, got, sum := testDecodeFlac(t, native)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d bits: decoded samples differ", bits)
+		}
+		if !bytes.Equal(st.Info.MD5sum[:], sum) || st.Info.NSamples != testRows*testRowLen {
+			t.Fatalf("%d bits: STREAMINFO not rewritten on close", bits)
+		}
+	}
+}
+
+func TestMatroskaFlac(t *testing.T) {
+	rows := testSignal(2, testRows, testRowLen, testSampleRate)
+	for _, channels := range []int{1, 2} {
+		s := Settings{Channels: channels, Options: &MatroskaOptions{Codec: MatroskaCodecFlac, CompressionLevel: 5}}
+		want := testCapture(t, s, rows).Samples()
+		entry, blocks := testMatroskaFile(t, testRenderFile(t, "mka", s, rows), testRows*testRowLen, testSampleRate)
+		if id := string(testEbmlOne(t, entry, mkvIDCodecID).body); id != "A_FLAC" {
+			t.Fatalf("%d channels: codec %q", channels, id)
+		}
+
+		// the codec header and the blocks are a native FLAC stream
+		native := append([]byte(nil), testEbmlOne(t, entry, mkvIDCodecPrivate).body...)
+		for _, block := range blocks {
+			native = append(native, block...)
+		}
+		st, got, sum := testDecodeFlac(t, native)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d channels: decoded samples differ", channels)
+		}
+		if !bytes.Equal(st.Info.MD5sum[:], sum) || st.Info.NSamples != testRows*testRowLen {
+			t.Fatalf("%d channels: STREAMINFO not rewritten on close", channels)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+)
+
+func TestFlacStreamInfo(t *testing.T) {
+	rows := testSignal(2, testRows, testRowLen, testSampleRate)
+	for _, level := range []int{0, 5, 8} {
+		b := testRenderFile(t, "flac", Settings{Options: &FlacOptions{CompressionLevel: level, SeekPoints: 1000}}, rows)
+		st, samples, sum := testDecodeFlac(t, b)
+		level := flacCompressionLevel(level)
+
+		if want := uint64(testRows * testRowLen); st.Info.NSamples != want || uint64(len(samples[0])) != want {
+			t.Fatalf("total samples %d, decoded %d, want %d", st.Info.NSamples, len(samples[0]), want)
+		}
+		if !bytes.Equal(st.Info.MD5sum[:], sum) {
+			t.Fatalf("MD5 %x, decoded audio has %x", st.Info.MD5sum, sum)
+		}
+		if int(st.Info.BlockSizeMin) != level.blockSize || int(st.Info.BlockSizeMax) != level.blockSize {
+			t.Fatalf("block sizes %d-%d, want %d", st.Info.BlockSizeMin, st.Info.BlockSizeMax, level.blockSize)
+		}
+
+		// the seek table holds a point for every frame, which gives the frame sizes
+		full, err := flac.Parse(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		framesPos := 4 + 4 + flacStreamInfoSize
+		var points []meta.SeekPoint
+		for _, block := range full.Blocks {
+			framesPos += 4 + int(block.Length)
+			if table, ok := block.Body.(*meta.SeekTable); ok {
+				for _, p := range table.Points {
+					if p.SampleNum != meta.PlaceholderPoint {
+						points = append(points, p)
+					}
+				}
+			}
+		}
+		frames := (testRows*testRowLen + level.blockSize - 1) / level.blockSize
+		if len(points) != frames {
+			t.Fatalf("%d seek points for %d frames", len(points), frames)
+		}
+		var minSize, maxSize uint32
+		for i, p := range points {
+			end := uint64(len(b) - framesPos)
+			if i+1 < len(points) {
+				end = points[i+1].Offset
+			}
+			size := uint32(end - p.Offset)
+			if minSize == 0 || size < minSize {
+				minSize = size
+			}
+			if size > maxSize {
+				maxSize = size
+			}
+		}
+		if st.Info.FrameSizeMin != minSize || st.Info.FrameSizeMax != maxSize {
+			t.Fatalf("frame sizes %d-%d, want %d-%d", st.Info.FrameSizeMin, st.Info.FrameSizeMax, minSize, maxSize)
+		}
+	}
+}
+
+func TestFlacStreamInfoNotSeekable(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	b := testRenderStream(t, "flac", Settings{}, rows)
+	st, samples, _ := testDecodeFlac(t, b)
+	// the total is unknown, as STREAMINFO cannot be rewritten
+	if st.Info.NSamples != 0 || len(samples[0]) != 20*testRowLen {
+		t.Fatalf("total samples %d, decoded %d", st.Info.NSamples, len(samples[0]))
+	}
+	if st.Info.MD5sum != [16]byte{} {
+		t.Fatal("MD5 written to a stream that cannot seek")
+	}
+}
+
+func TestFlacMetadataBlocks(t *testing.T) {
+	rows := testSignal(2, testRows, testRowLen, testSampleRate)
+	m := Metadata{
+		Title:   "tones",
+		Artist:  "someone",
+		Comment: "a comment",
+		Tags:    map[string]string{"GENRE": "chiptune", "DATE": "2021"},
+	}
+	b := testRenderFile(t, "flac", Settings{Metadata: m}, rows)
+	stream := testParseFlac(t, b)
+	if len(stream.Blocks) != 3 {
+		t.Fatalf("%d metadata blocks after STREAMINFO, want 3", len(stream.Blocks))
+	}
+
+	vc, ok := testFlacBlock(t, stream, meta.TypeVorbisComment).(*meta.VorbisComment)
+	if !ok {
+		t.Fatal("no VORBIS_COMMENT")
+	}
+	want := [][2]string{
+		{"TITLE", "tones"},
+		{"ARTIST", "someone"},
+		{"COMMENT", "a comment"},
+		{"DATE", "2021"},
+		{"GENRE", "chiptune"},
+	}
+	if vc.Vendor != flacVendor || !reflect.DeepEqual(vc.Tags, want) {
+		t.Fatalf("vendor %q, comments %q, want %q", vc.Vendor, vc.Tags, want)
+	}
+
+	if n, ok := testFlacBlock(t, stream, meta.TypePadding).(int64); !ok || n != flacDefaultPadding {
+		t.Fatalf("padding %v, want %d", n, flacDefaultPadding)
+	}
+
+	// the default number of seek points is reserved, and filled in on Close with the frames,
+	// leaving the rest as placeholders
+	table, ok := testFlacBlock(t, stream, meta.TypeSeekTable).(*meta.SeekTable)
+	if !ok || len(table.Points) != flacDefaultSeekPoints {
+		t.Fatal("no SEEKTABLE of the default size")
+	}
+	blockSize := uint64(flacCompressionLevel(5).blockSize)
+	frames := (testRows*testRowLen + blockSize - 1) / blockSize
+	framesPos := 4 + 4 + flacStreamInfoSize
+	for _, block := range stream.Blocks {
+		framesPos += 4 + int(block.Length)
+	}
+	for i, p := range table.Points {
+		if uint64(i) >= frames {
+			if p.SampleNum != meta.PlaceholderPoint {
+				t.Fatalf("seek point %d of %d frames: %+v", i, frames, p)
+			}
+			continue
+		}
+		wantSamples := blockSize
+		if uint64(i) == frames-1 {
+			wantSamples = testRows*testRowLen - uint64(i)*blockSize
+		}
+		if p.SampleNum != uint64(i)*blockSize || uint64(p.NSamples) != wantSamples {
+			t.Fatalf("seek point %d: %+v", i, p)
+		}
+		// each point is the offset of a frame from the first
+		if pos := framesPos + int(p.Offset); pos+1 >= len(b) || b[pos] != 0xff || b[pos+1]&0xfe != 0xf8 {
+			t.Fatalf("seek point %d: no frame at offset %d", i, p.Offset)
+		}
+	}
+
+	// the blocks are left out when not wanted
+	s := Settings{Options: &FlacOptions{SeekPoints: -1, Padding: 100}}
+	stream = testParseFlac(t, testRenderFile(t, "flac", s, rows))
+	if len(stream.Blocks) != 1 || testFlacBlock(t, stream, meta.TypePadding) != int64(100) {
+		t.Fatalf("%d blocks, padding %v", len(stream.Blocks), testFlacBlock(t, stream, meta.TypePadding))
+	}
+	s.Options = &FlacOptions{Padding: -1}
+	stream = testParseFlac(t, testRenderFile(t, "flac", s, rows))
+	if len(stream.Blocks) != 1 || stream.Blocks[0].Type != meta.TypeSeekTable {
+		t.Fatalf("%d blocks, without padding or comments", len(stream.Blocks))
+	}
+}
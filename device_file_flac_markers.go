@@ -0,0 +1,106 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+const (
+	// flacCueSheetHeaderSize is the size of the CUESHEET body before the tracks
+	flacCueSheetHeaderSize = 128 + 8 + 259 + 1
+	// flacCueTrackSize is the size of each track in the CUESHEET, before its index points
+	flacCueTrackSize = 8 + 1 + 12 + 14 + 1
+	// flacCueIndexSize is the size of each track index point in the CUESHEET
+	flacCueIndexSize = 8 + 1 + 3
+	// flacMaxCueSheetSize is the size of the CUESHEET body holding the most markers
+	flacMaxCueSheetSize = flacCueSheetHeaderSize + flacCueLeadOut*flacCueTrackSize + (flacCueLeadOut-1)*flacCueIndexSize
+	// flacCueLeadOut is the track number of the lead-out track of a non-CD CUESHEET
+	flacCueLeadOut = 255
+	// flacMaxChapters is the largest chapter number of the Vorbis chapter comments
+	flacMaxChapters = 999
+)
+
+// flacWriteBlock writes a metadata block
+func flacWriteBlock(w *bytes.Buffer, typ meta.Type, isLast bool, body []byte) {
+	var hdr [4]byte
+	hdr[0] = byte(typ)
+	if isLast {
+		hdr[0] |= 0x80
+	}
+	putUint24(hdr[1:], uint32(len(body)))
+	w.Write(hdr[:])
+	w.Write(body)
+}
+
+// flacVorbisCommentBytes returns the encoded body of the VORBIS_COMMENT metadata block
+func flacVorbisCommentBytes(comments [][2]string) []byte {
+	var b bytes.Buffer
+	writeString := func(s string) {
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(s)))
+		b.Write(n[:])
+		b.WriteString(s)
+	}
+	writeString(flacVendor)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(comments)))
+	b.Write(n[:])
+	for _, c := range comments {
+		writeString(c[0] + "=" + c[1])
+	}
+	return b.Bytes()
+}
+
+// flacCueSheetBytes returns the encoded body of a non-CD CUESHEET metadata block,
+// holding a track per marker, followed by the lead-out track
+func flacCueSheetBytes(markers []marker, nSamples uint64) []byte {
+	if len(markers) > flacCueLeadOut-1 {
+		markers = markers[:flacCueLeadOut-1]
+	}
+	b := make([]byte, flacCueSheetHeaderSize, flacCueSheetHeaderSize+(len(markers)+1)*(flacCueTrackSize+flacCueIndexSize))
+	// the media catalog number, lead-in and CD flag are left empty
+	b[flacCueSheetHeaderSize-1] = byte(len(markers) + 1) // NTracks
+	writeTrack := func(offset uint64, num uint8, nIndices uint8) {
+		var t [flacCueTrackSize]byte
+		binary.BigEndian.PutUint64(t[0:], offset)
+		t[8] = num
+		// the ISRC is left empty, and the audio and pre-emphasis flags clear
+		t[flacCueTrackSize-1] = nIndices
+		b = append(b, t[:]...)
+	}
+	for i, m := range markers {
+		writeTrack(m.Frame, uint8(i+1), 1)
+		var idx [flacCueIndexSize]byte
+		// the single index point is at the start of the track
+		idx[8] = 1
+		b = append(b, idx[:]...)
+	}
+	writeTrack(nSamples, flacCueLeadOut, 0)
+	return b
+}
+
+// flacChapterComments returns the markers as Vorbis chapter comments
+// (e.g.: CHAPTER001=00:01:02.500 and CHAPTER001NAME=label)
+func flacChapterComments(markers []marker, samplesPerSecond int) [][2]string {
+	var comments [][2]string
+	for i, m := range markers {
+		if i >= flacMaxChapters {
+			break
+		}
+		ms := m.Frame * 1000 / uint64(samplesPerSecond)
+		name := fmt.Sprintf("CHAPTER%03d", i+1)
+		comments = append(comments, [2]string{
+			name,
+			fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000),
+		})
+		if m.Label != "" {
+			comments = append(comments, [2]string{name + "NAME", m.Label})
+		}
+	}
+	return comments
+}
@@ -0,0 +1,152 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+)
+
+// testEveryRow is the Userdata of a row, marking every row
+type testEveryRow int
+
+func (m testEveryRow) MarkerLabel() (string, bool) {
+	return fmt.Sprintf("row %d", m), true
+}
+
+// testFlacBlock returns the body of the only metadata block of the type, or nil if there is none
+func testFlacBlock(t *testing.T, stream *flac.Stream, typ meta.Type) interface{} {
+	t.Helper()
+	var body interface{}
+	for _, b := range stream.Blocks {
+		if b.Type == typ {
+			if body != nil {
+				t.Fatalf("%v block given twice", typ)
+			}
+			body = b.Body
+			if body == nil {
+				// PADDING has no body to parse
+				body = b.Length
+			}
+		}
+	}
+	return body
+}
+
+// testParseFlac parses the metadata blocks of a FLAC file, checking the last one is marked as such
+func testParseFlac(t *testing.T, b []byte) *flac.Stream {
+	t.Helper()
+	stream, err := flac.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range stream.Blocks {
+		if block.IsLast != (i == len(stream.Blocks)-1) {
+			t.Fatalf("block %d of %d: last %v", i, len(stream.Blocks), block.IsLast)
+		}
+	}
+	return stream
+}
+
+func TestFlacCueSheet(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	stream := testParseFlac(t, testRenderFile(t, "flac", Settings{Markers: true}, rows))
+	cs, ok := testFlacBlock(t, stream, meta.TypeCueSheet).(*meta.CueSheet)
+	if !ok {
+		t.Fatal("no CUESHEET")
+	}
+	if cs.IsCompactDisc {
+		t.Fatal("CUESHEET marked as a CD")
+	}
+	want := testMarkers(120)
+	if len(cs.Tracks) != len(want)+1 {
+		t.Fatalf("%d tracks, want %d and the lead-out", len(cs.Tracks), len(want))
+	}
+	for i, m := range want {
+		tr := cs.Tracks[i]
+		if tr.Offset != m.Frame || int(tr.Num) != i+1 || len(tr.Indicies) != 1 || tr.Indicies[0].Num != 1 || tr.Indicies[0].Offset != 0 {
+			t.Errorf("track %d: %+v", i, tr)
+		}
+	}
+	if lead := cs.Tracks[len(want)]; lead.Num != flacCueLeadOut || lead.Offset != 120*testRowLen {
+		t.Errorf("lead-out track %+v", lead)
+	}
+	// the markers took some of the padding
+	if n, ok := testFlacBlock(t, stream, meta.TypePadding).(int64); !ok || n <= 0 {
+		t.Fatalf("padding %v", n)
+	}
+}
+
+func TestFlacChapterComments(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	s := Settings{Markers: true, Metadata: Metadata{Title: "tones"}, Options: &FlacOptions{ChapterComments: true}}
+	stream := testParseFlac(t, testRenderFile(t, "flac", s, rows))
+	if testFlacBlock(t, stream, meta.TypeCueSheet) != nil {
+		t.Fatal("CUESHEET written with chapter comments")
+	}
+	vc, ok := testFlacBlock(t, stream, meta.TypeVorbisComment).(*meta.VorbisComment)
+	if !ok {
+		t.Fatal("no VORBIS_COMMENT")
+	}
+	want := [][2]string{
+		{"TITLE", "tones"},
+		{"CHAPTER001", "00:00:00.000"},
+		{"CHAPTER001NAME", "row 0"},
+		{"CHAPTER002", "00:00:00.500"},
+		{"CHAPTER002NAME", "row 50"},
+		{"CHAPTER003", "00:00:01.000"},
+		{"CHAPTER003NAME", "row 100"},
+	}
+	if !reflect.DeepEqual(vc.Tags, want) {
+		t.Fatalf("comments %q, want %q", vc.Tags, want)
+	}
+}
+
+func TestFlacMarkersFit(t *testing.T) {
+	// with the padding left to the default, a CUESHEET of as many markers as it can hold fits
+	rows := testSignal(2, 300, 147, testSampleRate)
+	for r := range rows {
+		rows[r].Userdata = testEveryRow(r)
+	}
+	stream := testParseFlac(t, testRenderFile(t, "flac", Settings{Markers: true}, rows))
+	cs, ok := testFlacBlock(t, stream, meta.TypeCueSheet).(*meta.CueSheet)
+	if !ok || len(cs.Tracks) != flacCueLeadOut {
+		t.Fatal("markers left out of the CUESHEET")
+	}
+}
+
+func TestFlacMarkersFallBack(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	for _, padding := range []int{64, -1} {
+		// the markers do not fit in the padding, so they go to a .cue file instead
+		s := testSettings(Settings{
+			Name:     fileName,
+			Filepath: filepath.Join(t.TempDir(), "song.flac"),
+			Markers:  true,
+			Options:  &FlacOptions{Padding: padding},
+		})
+		testPlay(t, s, rows)
+		b, err := os.ReadFile(s.Filepath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testFlacBlock(t, testParseFlac(t, b), meta.TypeCueSheet) != nil {
+			t.Fatalf("padding %d: CUESHEET written", padding)
+		}
+		cue, err := os.ReadFile(strings.TrimSuffix(s.Filepath, ".flac") + ".cue")
+		if err != nil {
+			t.Fatalf("padding %d: %v", padding, err)
+		}
+		if n := strings.Count(string(cue), "TRACK"); n != 3 {
+			t.Fatalf("padding %d: %d tracks in the .cue file", padding, n)
+		}
+	}
+}
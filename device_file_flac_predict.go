@@ -0,0 +1,473 @@
+// +build flac
+
+package gosound
+
+import (
+	"math"
+
+	"github.com/mewkiz/flac/frame"
+)
+
+// flacLevel is the set of encoder parameters used for a compression level
+type flacLevel struct {
+	// blockSize is the number of samples per channel in each frame
+	blockSize int
+	// stereo enables left-side, side-right and mid-side decorrelation of two channel audio
+	stereo bool
+	// maxLPCOrder is the highest order of the LPC predictors tried; 0 disables LPC
+	maxLPCOrder int
+	// maxPartOrder is the highest Rice partition order tried
+	maxPartOrder int
+	// exhaustive tries every LPC order instead of the one estimated to be best
+	exhaustive bool
+}
+
+const (
+	flacDefaultCompressionLevel = 5
+
+	flacMaxFixedOrder = 4
+	// flacMaxCoeffShift is the largest LPC coefficient shift that can be stored (as a 5-bit signed value)
+	flacMaxCoeffShift = 15
+	// flacMaxRice1Param is the largest parameter of the 4-bit Rice coding method; 15 is the escape code
+	flacMaxRice1Param = 14
+	// flacMaxRice2Param is the largest parameter of the 5-bit Rice coding method; 31 is the escape code
+	flacMaxRice2Param = 30
+)
+
+// flacLevels holds the encoder parameters for each compression level, loosely following the reference encoder
+var flacLevels = [...]flacLevel{
+	{blockSize: 1152, stereo: false, maxLPCOrder: 0, maxPartOrder: 3},
+	{blockSize: 1152, stereo: true, maxLPCOrder: 0, maxPartOrder: 3},
+	{blockSize: 1152, stereo: true, maxLPCOrder: 0, maxPartOrder: 4},
+	{blockSize: 4096, stereo: false, maxLPCOrder: 6, maxPartOrder: 4},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartOrder: 4},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartOrder: 5},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartOrder: 6},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 8, maxPartOrder: 6, exhaustive: true},
+	{blockSize: 4096, stereo: true, maxLPCOrder: 12, maxPartOrder: 6, exhaustive: true},
+}
+
+// flacCompressionLevel returns the encoder parameters for the compression level, clamped to the supported range
+func flacCompressionLevel(level int) flacLevel {
+	if level < 0 {
+		level = 0
+	} else if level >= len(flacLevels) {
+		level = len(flacLevels) - 1
+	}
+	return flacLevels[level]
+}
+
+// flacSubframe is an analyzed subframe and the number of bits it will be encoded with
+type flacSubframe struct {
+	frame.SubHeader
+	bits int
+}
+
+// encodeFrame returns the subframes and channel assignment for the channel samples,
+// choosing the combination that encodes to the fewest bits.
+// The samples are not modified; decorrelation is left to the encoder.
+func (l flacLevel) encodeFrame(samples [][]int32, bps int) ([]*frame.Subframe, frame.Channels) {
+	n := len(samples[0])
+	subframes := make([]*frame.Subframe, len(samples))
+	channels := frame.Channels(len(samples) - 1)
+
+	if len(samples) != 2 || !l.stereo {
+		for i, s := range samples {
+			sf := l.analyze(s, bps)
+			subframes[i] = &frame.Subframe{SubHeader: sf.SubHeader, Samples: s, NSamples: n}
+		}
+		return subframes, channels
+	}
+
+	left, right := samples[0], samples[1]
+	mid := make([]int32, n)
+	side := make([]int32, n)
+	for i := range left {
+		mid[i] = int32((int64(left[i]) + int64(right[i])) >> 1)
+		side[i] = left[i] - right[i]
+	}
+	// the side channel needs an extra bit
+	l0 := l.analyze(left, bps)
+	r0 := l.analyze(right, bps)
+	m0 := l.analyze(mid, bps)
+	s0 := l.analyze(side, bps+1)
+
+	first, second := l0, r0
+	channels = frame.ChannelsLR
+	best := l0.bits + r0.bits
+	if bits := l0.bits + s0.bits; bits < best {
+		first, second, channels, best = l0, s0, frame.ChannelsLeftSide, bits
+	}
+	if bits := s0.bits + r0.bits; bits < best {
+		first, second, channels, best = s0, r0, frame.ChannelsSideRight, bits
+	}
+	if bits := m0.bits + s0.bits; bits < best {
+		first, second, channels = m0, s0, frame.ChannelsMidSide
+	}
+	subframes[0] = &frame.Subframe{SubHeader: first.SubHeader, Samples: left, NSamples: n}
+	subframes[1] = &frame.Subframe{SubHeader: second.SubHeader, Samples: right, NSamples: n}
+	return subframes, channels
+}
+
+// analyze returns the smallest encoding of the samples
+func (l flacLevel) analyze(samples []int32, bps int) flacSubframe {
+	n := len(samples)
+	// subframe type and wasted bits flag, plus padding
+	headerBits := 8
+
+	constant := true
+	var or int32
+	for _, s := range samples {
+		or |= s
+		if s != samples[0] {
+			constant = false
+		}
+	}
+	if constant {
+		return flacSubframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredConstant},
+			bits:      headerBits + bps,
+		}
+	}
+
+	best := flacSubframe{
+		SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+		bits:      headerBits + n*bps,
+	}
+
+	// low bits that are zero in every sample are not stored
+	var wasted uint
+	for or&1 == 0 && wasted < uint(bps-1) {
+		or >>= 1
+		wasted++
+	}
+	if wasted > 0 {
+		shifted := make([]int32, n)
+		for i, s := range samples {
+			shifted[i] = s >> wasted
+		}
+		samples = shifted
+		bps -= int(wasted)
+		best.Wasted = wasted
+		headerBits += int(wasted)
+		best.bits = headerBits + n*bps
+	}
+
+	// fixed predictors
+	for order := 0; order <= flacMaxFixedOrder && order < n; order++ {
+		residuals := flacResiduals(samples, frame.FixedCoeffs[order], 0)
+		if residuals == nil {
+			continue
+		}
+		rice, riceBits := l.riceCoding(residuals, n, order)
+		bits := headerBits + order*bps + riceBits
+		if bits < best.bits {
+			best = flacSubframe{
+				SubHeader: frame.SubHeader{
+					Pred:                 frame.PredFixed,
+					Order:                order,
+					Wasted:               wasted,
+					ResidualCodingMethod: flacResidualCodingMethod(rice),
+					RiceSubframe:         rice,
+				},
+				bits: bits,
+			}
+		}
+	}
+
+	// LPC predictors
+	maxOrder := l.maxLPCOrder
+	if maxOrder >= n {
+		maxOrder = n - 1
+	}
+	if maxOrder < 1 {
+		return best
+	}
+	lpc, errs := flacLPCCoefficients(samples, maxOrder)
+	if lpc == nil {
+		return best
+	}
+	prec := flacCoeffPrecision(n)
+	orders := []int{flacEstimateLPCOrder(errs, n, bps, prec)}
+	if l.exhaustive {
+		orders = orders[:0]
+		for order := 1; order <= maxOrder; order++ {
+			orders = append(orders, order)
+		}
+	}
+	for _, order := range orders {
+		coeffs, shift := flacQuantizeCoefficients(lpc[order-1], prec)
+		residuals := flacResiduals(samples, coeffs, shift)
+		if residuals == nil {
+			continue
+		}
+		rice, riceBits := l.riceCoding(residuals, n, order)
+		bits := headerBits + order*bps + 4 + 5 + order*prec + riceBits
+		if bits < best.bits {
+			best = flacSubframe{
+				SubHeader: frame.SubHeader{
+					Pred:                 frame.PredFIR,
+					Order:                order,
+					Wasted:               wasted,
+					ResidualCodingMethod: flacResidualCodingMethod(rice),
+					CoeffPrec:            uint(prec),
+					CoeffShift:           shift,
+					Coeffs:               coeffs,
+					RiceSubframe:         rice,
+				},
+				bits: bits,
+			}
+		}
+	}
+	return best
+}
+
+// flacResiduals returns the prediction error of the samples after the warm-up samples,
+// computed the same way as the encoder. It returns nil if a residual does not fit in 32 bits.
+func flacResiduals(samples []int32, coeffs []int32, shift int32) []int32 {
+	order := len(coeffs)
+	residuals := make([]int32, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += int64(c) * int64(samples[i-j-1])
+		}
+		residual := int64(samples[i]) - (sum >> uint(shift))
+		if residual < math.MinInt32 || residual > math.MaxInt32 {
+			return nil
+		}
+		residuals[i-order] = int32(residual)
+	}
+	return residuals
+}
+
+// riceCoding returns the Rice partitioning with the fewest bits for the residuals of a
+// subframe of n samples, along with that number of bits (including the coding method and
+// partition order fields)
+func (l flacLevel) riceCoding(residuals []int32, n int, order int) (*frame.RiceSubframe, int) {
+	// the partition order is limited so that each partition divides the block evenly
+	// and the first partition is larger than the predictor order
+	maxPartOrder := 0
+	for maxPartOrder < l.maxPartOrder && n%(2<<maxPartOrder) == 0 && n>>(maxPartOrder+1) > order {
+		maxPartOrder++
+	}
+
+	// sums of the zigzag encoded residuals in each partition of the highest order
+	nparts := 1 << maxPartOrder
+	sums := make([]uint64, nparts)
+	pos := 0
+	for p := range sums {
+		count := n >> maxPartOrder
+		if p == 0 {
+			count -= order
+		}
+		for _, r := range residuals[pos : pos+count] {
+			sums[p] += uint64(uint32(r<<1) ^ uint32(r>>31))
+		}
+		pos += count
+	}
+
+	var best *frame.RiceSubframe
+	bestBits := math.MaxInt64
+	for partOrder := maxPartOrder; partOrder >= 0; partOrder-- {
+		rice := &frame.RiceSubframe{
+			PartOrder:  partOrder,
+			Partitions: make([]frame.RicePartition, 1<<partOrder),
+		}
+		bits := 0
+		maxParam := uint(0)
+		for p := range rice.Partitions {
+			count := n >> partOrder
+			if p == 0 {
+				count -= order
+			}
+			param, paramBits := flacRiceParam(sums[p], count)
+			rice.Partitions[p].Param = param
+			bits += paramBits
+			if param > maxParam {
+				maxParam = param
+			}
+		}
+		paramSize := 4
+		if maxParam > flacMaxRice1Param {
+			paramSize = 5
+		}
+		bits += 2 + 4 + paramSize*len(rice.Partitions)
+		if bits < bestBits {
+			best, bestBits = rice, bits
+		}
+
+		// merge pairs of partitions for the next lower order
+		if partOrder > 0 {
+			for p := range sums[:len(sums)/2] {
+				sums[p] = sums[2*p] + sums[2*p+1]
+			}
+			sums = sums[:len(sums)/2]
+		}
+	}
+	return best, bestBits
+}
+
+// flacRiceParam returns the Rice parameter for a partition with the provided
+// sum of zigzag encoded residuals, along with the estimated bits for the residuals
+func flacRiceParam(sum uint64, count int) (uint, int) {
+	if count <= 0 {
+		return 0, 0
+	}
+	var best uint
+	bestBits := uint64(math.MaxUint64)
+	for k := uint(0); k <= flacMaxRice2Param; k++ {
+		// each residual takes k bits, a stop bit and its high bits in unary
+		bits := uint64(count)*uint64(k+1) + sum>>k
+		if bits < bestBits {
+			best, bestBits = k, bits
+		}
+		if sum>>k == 0 {
+			break
+		}
+	}
+	return best, int(bestBits)
+}
+
+// flacResidualCodingMethod returns the Rice coding method able to hold the partition parameters
+func flacResidualCodingMethod(rice *frame.RiceSubframe) frame.ResidualCodingMethod {
+	for _, p := range rice.Partitions {
+		if p.Param > flacMaxRice1Param {
+			return frame.ResidualCodingMethodRice2
+		}
+	}
+	return frame.ResidualCodingMethodRice1
+}
+
+// flacLPCCoefficients returns the LPC coefficients for every order up to maxOrder,
+// indexed by order - 1, and the prediction error of each order. The samples are
+// windowed before the autocorrelation is computed.
+func flacLPCCoefficients(samples []int32, maxOrder int) ([][]float64, []float64) {
+	n := len(samples)
+	// Welch window
+	windowed := make([]float64, n)
+	half := float64(n-1) / 2
+	for i, s := range samples {
+		x := (float64(i) - half) / (half + 1)
+		windowed[i] = float64(s) * (1 - x*x)
+	}
+
+	autoc := make([]float64, maxOrder+1)
+	for lag := range autoc {
+		var sum float64
+		for i := lag; i < n; i++ {
+			sum += windowed[i] * windowed[i-lag]
+		}
+		autoc[lag] = sum
+	}
+	if autoc[0] == 0 {
+		return nil, nil
+	}
+
+	// Levinson-Durbin recursion
+	lpc := make([][]float64, maxOrder)
+	errs := make([]float64, maxOrder)
+	coeffs := make([]float64, maxOrder)
+	err := autoc[0]
+	for i := 0; i < maxOrder; i++ {
+		r := -autoc[i+1]
+		for j := 0; j < i; j++ {
+			r -= coeffs[j] * autoc[i-j]
+		}
+		r /= err
+
+		coeffs[i] = r
+		for j := 0; j < i/2; j++ {
+			tmp := coeffs[j]
+			coeffs[j] += r * coeffs[i-1-j]
+			coeffs[i-1-j] += r * tmp
+		}
+		if i%2 == 1 {
+			coeffs[i/2] += coeffs[i/2] * r
+		}
+		err *= 1 - r*r
+
+		// the predictor is the negation of the recursion's coefficients
+		lpc[i] = make([]float64, i+1)
+		for j := range lpc[i] {
+			lpc[i][j] = -coeffs[j]
+		}
+		errs[i] = err
+	}
+	return lpc, errs
+}
+
+// flacEstimateLPCOrder returns the LPC order expected to encode to the fewest bits
+func flacEstimateLPCOrder(errs []float64, n int, bps int, prec int) int {
+	best := 1
+	bestBits := math.Inf(1)
+	for i, e := range errs {
+		order := i + 1
+		residualBits := 0.0
+		if e > 0 {
+			residualBits = math.Max(0, 0.5*math.Log2(e/float64(n)))
+		}
+		bits := residualBits*float64(n-order) + float64(order*(bps+prec))
+		if bits < bestBits {
+			best, bestBits = order, bits
+		}
+	}
+	return best
+}
+
+// flacCoeffPrecision returns the LPC coefficient precision for the block size, as used by the reference encoder
+func flacCoeffPrecision(n int) int {
+	switch {
+	case n <= 192:
+		return 7
+	case n <= 384:
+		return 8
+	case n <= 576:
+		return 9
+	case n <= 1152:
+		return 10
+	case n <= 2304:
+		return 11
+	case n <= 4608:
+		return 12
+	default:
+		return 13
+	}
+}
+
+// flacQuantizeCoefficients returns the LPC coefficients quantized to prec bits, and the shift to apply to the prediction
+func flacQuantizeCoefficients(lpc []float64, prec int) ([]int32, int32) {
+	cmax := 0.0
+	for _, c := range lpc {
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+	qmax := int32(1)<<(prec-1) - 1
+	qmin := -qmax - 1
+
+	shift := int32(0)
+	if cmax > 0 {
+		_, exp := math.Frexp(cmax)
+		shift = int32(prec - 1 - exp)
+	}
+	if shift > flacMaxCoeffShift {
+		shift = flacMaxCoeffShift
+	} else if shift < 0 {
+		shift = 0
+	}
+
+	// the rounding error of each coefficient is carried into the next
+	coeffs := make([]int32, len(lpc))
+	var carry float64
+	for i, c := range lpc {
+		carry += c * float64(int32(1)<<shift)
+		q := int32(math.Round(carry))
+		if q > qmax {
+			q = qmax
+		} else if q < qmin {
+			q = qmin
+		}
+		carry -= float64(q)
+		coeffs[i] = q
+	}
+	return coeffs, shift
+}
@@ -0,0 +1,96 @@
+// +build flac
+
+package gosound
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/mewkiz/flac"
+)
+
+// testDecodeFlac decodes a FLAC stream, returning the samples of each channel and the MD5 of the decoded audio
+func testDecodeFlac(t *testing.T, b []byte) (*flac.Stream, [][]int32, []byte) {
+	t.Helper()
+	st, err := flac.New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([][]int32, st.Info.NChannels)
+	h := md5.New()
+	for {
+		f, err := st.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Hash(h)
+		for c, sf := range f.Subframes {
+			samples[c] = append(samples[c], sf.Samples...)
+		}
+	}
+	return st, samples, h.Sum(nil)
+}
+
+func TestFlacRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	signals := map[string]func(channels int) []*PremixData{
+		"tones": func(channels int) []*PremixData {
+			return testSignal(channels, testRows, testRowLen, testSampleRate)
+		},
+		"silence": func(channels int) []*PremixData {
+			return testRowsOf(channels, 20, testRowLen, func(int, int) float64 { return 0 })
+		},
+		"noise": func(channels int) []*PremixData {
+			return testRowsOf(channels, 20, testRowLen, func(int, int) float64 { return rng.Float64()*2 - 1 })
+		},
+		"full scale square": func(channels int) []*PremixData {
+			return testRowsOf(channels, 20, testRowLen, func(c int, n int) float64 {
+				if n/(50+c*7)%2 == 0 {
+					return 1
+				}
+				return -1
+			})
+		},
+	}
+	for name, signal := range signals {
+		for _, channels := range []int{1, 2} {
+			rows := signal(channels)
+			for _, bits := range []int{8, 16, 24} {
+				s := Settings{Channels: channels, BitsPerSample: bits}
+				want := testCapture(t, s, rows).Samples()
+				for level := 0; level <= 8; level++ {
+					s.Options = &FlacOptions{CompressionLevel: level}
+					b := testRenderFile(t, "flac", s, rows)
+					_, got, _ := testDecodeFlac(t, b)
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("%s, %d channels, %d bits, level %d: decoded samples differ", name, channels, bits, level)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFlacCompresses(t *testing.T) {
+	rows := testSignal(2, testRows, testRowLen, testSampleRate)
+	pcmSize := testRows * testRowLen * 2 * 2
+	prev := math.MaxInt32
+	for _, level := range []int{0, 5, 8} {
+		b := testRenderFile(t, "flac", Settings{Options: &FlacOptions{CompressionLevel: level, SeekPoints: -1, Padding: -1}}, rows)
+		if len(b) > pcmSize*3/4 {
+			t.Errorf("level %d: %d bytes is not much smaller than the %d bytes of PCM", level, len(b), pcmSize)
+		}
+		if len(b) > prev {
+			t.Errorf("level %d: %d bytes is larger than the lower level's %d bytes", level, len(b), prev)
+		}
+		prev = len(b)
+	}
+}
@@ -0,0 +1,161 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+// MatroskaCodec is the codec of the audio in a Matroska file
+type MatroskaCodec int
+
+const (
+	// MatroskaCodecPCM stores little-endian PCM, in the sample format of the stream
+	MatroskaCodecPCM = MatroskaCodec(iota)
+	// MatroskaCodecFlac stores FLAC frames, which needs FLAC support to be built in (the flac build tag),
+	// and an 8-, 16- or 24-bit integer sample format
+	MatroskaCodecFlac
+)
+
+// MatroskaOptions is the set of options for the Matroska audio file format
+type MatroskaOptions struct {
+	// Codec is the codec of the audio. When no options are provided, PCM is used.
+	Codec MatroskaCodec
+	// CompressionLevel is the FLAC compression level, from 0 (fastest) to 8 (smallest)
+	CompressionLevel int
+}
+
+// newMatroskaFlacDevice creates a device writing FLAC into a Matroska file, or is nil if FLAC support is not built in
+var newMatroskaFlacDevice func(settings Settings, compressionLevel int) (Device, error)
+
+type fileDeviceMatroska struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+
+	out *fileOutput
+	w   *bufio.Writer
+	mux *matroskaMuxer
+}
+
+func newFileMatroskaDevice(settings Settings) (Device, error) {
+	if opts, ok := settings.Options.(*MatroskaOptions); ok && opts != nil {
+		switch opts.Codec {
+		case MatroskaCodecPCM:
+		case MatroskaCodecFlac:
+			if newMatroskaFlacDevice == nil {
+				return nil, errors.New("flac support is not built in")
+			}
+			return newMatroskaFlacDevice(settings, opts.CompressionLevel)
+		default:
+			return nil, errors.New("invalid codec for matroska")
+		}
+	}
+
+	fd := fileDeviceMatroska{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	track := matroskaTrack{
+		codecID:  "A_PCM/INT/LIT",
+		channels: settings.Channels,
+		rate:     settings.SamplesPerSecond,
+		bitDepth: fd.mix.Format.BitsPerSample(),
+	}
+	if fd.mix.Format.IsFloat() {
+		track.codecID = "A_PCM/FLOAT/IEEE"
+	}
+
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(out.w)
+	mux, err := newMatroskaMuxer(out, w, track, settings.Metadata, &fd.markers)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	fd.mux = mux
+	return &fd, nil
+}
+
+// Play starts the matroska output device playing
+func (d *fileDeviceMatroska) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the matroska output device playing
+func (d *fileDeviceMatroska) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		if d.mix.Format == SampleFormatInt8 {
+			// 8-bit PCM is unsigned
+			for _, samples := range mixedData {
+				for i := range samples {
+					samples[i] ^= 0x80
+				}
+			}
+		}
+		// each row is a block
+		if err := d.mux.writePacket(encodeSamples(mixedData, d.mix.Format, binary.LittleEndian), row.SamplesLen); err != nil {
+			return err
+		}
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the matroska output device
+func (d *fileDeviceMatroska) Close() {
+	if d.w == nil {
+		return
+	}
+	_ = d.mux.close(nil)
+	_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+	d.out.Close()
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "mka",
+		Extensions:  []string{".mka"},
+		Description: "Matroska audio",
+		Create:      newFileMatroskaDevice,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
@@ -0,0 +1,145 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"errors"
+
+	"github.com/gotracker/gomixing/mixing"
+
+	"github.com/gotracker/gosound/internal/mp3"
+)
+
+// Mp3Options is the set of options for the MP3 file format
+type Mp3Options struct {
+	// Bitrate is the constant bitrate in kbit/s: 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256 or 320.
+	// When no options are provided, or the bitrate is 0, 128 kbit/s is used.
+	Bitrate int
+}
+
+type fileDeviceMp3 struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+
+	out *fileOutput
+	w   *bufio.Writer
+	enc *mp3.Encoder
+	// infoPos is the position of the frame holding the Info tag, after the ID3v2 tag
+	infoPos int64
+}
+
+func newFileMp3Device(settings Settings) (Device, error) {
+	fd := fileDeviceMp3{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	bitrate := mp3.DefaultBitrate
+	if opts, ok := settings.Options.(*Mp3Options); ok && opts != nil && opts.Bitrate != 0 {
+		bitrate = opts.Bitrate
+	}
+	if err := mp3.CheckFormat(settings.Channels, settings.SamplesPerSecond, bitrate); err != nil {
+		return nil, err
+	}
+
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(out.w)
+	if !settings.Metadata.IsEmpty() {
+		tag := id3v2Tag(settings.Metadata, 0)
+		if _, err := w.Write(tag); err != nil {
+			out.Close()
+			return nil, err
+		}
+		fd.infoPos = int64(len(tag))
+	}
+	enc, err := mp3.NewEncoder(w, settings.Channels, settings.SamplesPerSecond, bitrate)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	fd.enc = enc
+	return &fd, nil
+}
+
+// Play starts the mp3 output device playing
+func (d *fileDeviceMp3) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the mp3 output device playing
+func (d *fileDeviceMp3) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		if err := d.enc.Write(samplesToFloat(mixedData, d.mix.Format)); err != nil {
+			return err
+		}
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the mp3 output device
+func (d *fileDeviceMp3) Close() {
+	if d.w == nil {
+		return
+	}
+	defer d.out.Close()
+	_ = d.enc.Close()
+	d.w.Flush()
+	_ = d.markers.writeCueSheet("MP3", d.samplesPerSecond)
+	// the Info tag gives the length of the audio, which is only known now
+	if d.out.Seekable() {
+		if err := d.out.SeekTo(d.infoPos); err != nil {
+			return
+		}
+		if _, err := d.w.Write(d.enc.InfoFrame()); err != nil {
+			return
+		}
+		d.w.Flush()
+	}
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "mp3",
+		Extensions:  []string{".mp3"},
+		Description: "MPEG-1 Audio Layer III",
+		Create:      newFileMp3Device,
+		Capabilities: Capabilities{
+			Channels:            []int{1, 2},
+			MinSamplesPerSecond: 32000,
+			MaxSamplesPerSecond: 48000,
+			SampleRates:         mp3.SampleRates(),
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
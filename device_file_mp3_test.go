@@ -0,0 +1,137 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	gomp3 "github.com/hajimehoshi/go-mp3"
+
+	"github.com/gotracker/gosound/internal/mp3"
+)
+
+// testMp3Lag is where the audio starts in the output of go-mp3, which decodes the Info frame as
+// silence and adds the delay of its filterbank to the delay of the encoder
+const testMp3Lag = mp3.FrameSize + mp3.Delay + 529
+
+// testDecodeMp3 decodes an MP3 stream, returning the samples of each channel of the 16-bit stereo output
+func testDecodeMp3(t *testing.T, b []byte) [][]float32 {
+	t.Helper()
+	d, err := gomp3.NewDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SampleRate() != testSampleRate {
+		t.Fatalf("decoded at %d Hz", d.SampleRate())
+	}
+	pcm, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([][]float32, 2)
+	for i := 0; i+4 <= len(pcm); i += 4 {
+		out[0] = append(out[0], float32(int16(binary.LittleEndian.Uint16(pcm[i:])))/32768)
+		out[1] = append(out[1], float32(int16(binary.LittleEndian.Uint16(pcm[i+2:])))/32768)
+	}
+	return out
+}
+
+func TestMp3RoundTrip(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		rows := testSignal(channels, testRows, testRowLen, testSampleRate)
+		want := testCapture(t, Settings{Channels: channels}, rows).Float32()
+		frames := len(want[0])
+		for _, tc := range []struct {
+			bitrate int
+			minSNR  float64
+		}{
+			{96, 24},
+			{128, 25},
+			{192, 27},
+		} {
+			b := testRenderFile(t, "mp3", Settings{Channels: channels, Options: &Mp3Options{Bitrate: tc.bitrate}}, rows)
+			got := testDecodeMp3(t, b)
+			if channels == 1 {
+				got = got[:1]
+			}
+
+			// the Info tag counts the audio frames, and gives the delay and padding around the samples
+			sideInfo := 32
+			if channels == 1 {
+				sideInfo = 17
+			}
+			tag := b[4+sideInfo:]
+			if string(tag[:4]) != "Info" {
+				t.Fatalf("%d channels, %d kbit/s: no Info tag", channels, tc.bitrate)
+			}
+			audioFrames := int(binary.BigEndian.Uint32(tag[8:]))
+			if len(got[0]) != (audioFrames+1)*mp3.FrameSize {
+				t.Fatalf("%d channels, %d kbit/s: decoded %d samples from %d audio frames", channels, tc.bitrate, len(got[0]), audioFrames)
+			}
+			delays := int(tag[141])<<16 | int(tag[142])<<8 | int(tag[143])
+			if delay, padding := delays>>12, delays&0xfff; delay != mp3.Delay || delay+frames+padding != audioFrames*mp3.FrameSize {
+				t.Fatalf("%d channels, %d kbit/s: delay %d and padding %d around %d samples in %d frames", channels, tc.bitrate, delay, padding, frames, audioFrames)
+			}
+
+			if len(got[0]) < testMp3Lag+frames {
+				t.Fatalf("%d channels, %d kbit/s: decoded %d samples", channels, tc.bitrate, len(got[0]))
+			}
+			for c := range got {
+				got[c] = got[c][testMp3Lag : testMp3Lag+frames]
+			}
+			if snr := testSNR(want, got); snr < tc.minSNR {
+				t.Errorf("%d channels, %d kbit/s: SNR %.1f dB", channels, tc.bitrate, snr)
+			}
+		}
+	}
+}
+
+func TestMp3DefaultBitrate(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	want := testRenderFile(t, "mp3", Settings{Options: &Mp3Options{Bitrate: mp3.DefaultBitrate}}, rows)
+	for _, opts := range []interface{}{nil, &Mp3Options{}} {
+		if b := testRenderFile(t, "mp3", Settings{Options: opts}, rows); !bytes.Equal(b, want) {
+			t.Errorf("options %#v: not coded at %d kbit/s", opts, mp3.DefaultBitrate)
+		}
+	}
+}
+
+func TestMp3SampleRates(t *testing.T) {
+	caps, err := QueryCapabilities(Settings{Name: fileName, Format: "mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rate, want := range map[int]int{
+		22050: 32000,
+		32000: 32000,
+		40000: 44100,
+		44100: 44100,
+		47000: 48000,
+		48000: 48000,
+		96000: 48000,
+	} {
+		f := StreamFormat{Channels: 2, SamplesPerSecond: rate, BitsPerSample: 16, SampleFormat: SampleFormatInt16}
+		if caps.Supports(f) != (rate == want) {
+			t.Errorf("%d Hz: supported is %v", rate, caps.Supports(f))
+		}
+		if got, err := caps.Negotiate(f, false); err != nil || got.SamplesPerSecond != want {
+			t.Errorf("%d Hz: negotiated %d Hz, %v", rate, got.SamplesPerSecond, err)
+		}
+		if _, err := caps.Negotiate(f, true); (err == nil) != (rate == want) || (err != nil && !errors.Is(err, ErrFormatNotSupported)) {
+			t.Errorf("%d Hz: strict negotiation gave %v", rate, err)
+		}
+	}
+
+	// a rate between those of MPEG-1 is moved to the closest one, which the encoder accepts
+	var w struct{ bytes.Buffer }
+	d, err := CreateOutputDevice(Settings{Name: fileName, Format: "mp3", Writer: &w, Channels: 2, SamplesPerSecond: 40000, BitsPerSample: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if f, _ := GetStreamFormat(d); f.SamplesPerSecond != 44100 {
+		t.Fatalf("device created at %d Hz", f.SamplesPerSecond)
+	}
+}
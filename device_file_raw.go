@@ -0,0 +1,128 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+// RawOptions is the set of options for the headerless raw PCM file format
+type RawOptions struct {
+	// BigEndian writes big-endian samples, instead of little-endian
+	BigEndian bool
+	// Unsigned offsets integer samples so that silence is at the middle of the unsigned range
+	Unsigned bool
+}
+
+type fileDeviceRaw struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+	order            binary.ByteOrder
+	unsigned         bool
+
+	out *fileOutput
+	w   *bufio.Writer
+}
+
+func newFileRawDevice(settings Settings) (Device, error) {
+	fd := fileDeviceRaw{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+		order:            binary.LittleEndian,
+	}
+	if opts, ok := settings.Options.(*RawOptions); ok && opts != nil {
+		if opts.BigEndian {
+			fd.order = binary.BigEndian
+		}
+		fd.unsigned = opts.Unsigned && !fd.mix.Format.IsFloat()
+	}
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+	fd.out = out
+	fd.w = bufio.NewWriter(out.w)
+	return &fd, nil
+}
+
+// Play starts the raw output device playing
+func (d *fileDeviceRaw) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the raw output device playing
+func (d *fileDeviceRaw) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		if d.unsigned {
+			// flipping the sign bit offsets a two's complement sample by half of its range
+			signBit := int32(1) << (d.mix.Format.BitsPerSample() - 1)
+			for _, samples := range mixedData {
+				for i := range samples {
+					samples[i] ^= signBit
+				}
+			}
+		}
+		if _, err := d.w.Write(encodeSamples(mixedData, d.mix.Format, d.order)); err != nil {
+			return err
+		}
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the raw output device
+func (d *fileDeviceRaw) Close() {
+	if d.w == nil {
+		return
+	}
+	d.w.Flush()
+	fileType := "BINARY"
+	if d.order == binary.BigEndian {
+		fileType = "MOTOROLA"
+	}
+	_ = d.markers.writeCueSheet(fileType, d.samplesPerSecond)
+	d.out.Close()
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "raw",
+		Extensions:  []string{".raw", ".pcm"},
+		Description: "Headerless PCM",
+		Create:      newFileRawDevice,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
@@ -0,0 +1,39 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestRawRoundTrip(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	for _, bits := range []int{8, 16, 24, 32} {
+		s := Settings{BitsPerSample: bits}
+		want := testCapture(t, s, rows).Samples()
+		for _, opts := range []*RawOptions{nil, {BigEndian: true}, {Unsigned: true}} {
+			s.Options = opts
+			b := testRenderFile(t, "raw", s, rows)
+			if len(b) != len(want[0])*2*bits/8 {
+				t.Fatalf("%d bits, %+v: %d bytes", bits, opts, len(b))
+			}
+			var order binary.ByteOrder = binary.LittleEndian
+			if opts != nil && opts.BigEndian {
+				order = binary.BigEndian
+			}
+			got := testDecodeInts(b, 2, sampleFormatForBits(bits), order)
+			if opts != nil && opts.Unsigned {
+				// flipping the sign bit, and the bits it was extended into, undoes the offset
+				signBits := -(int32(1) << (bits - 1))
+				for _, samples := range got {
+					for i := range samples {
+						samples[i] ^= signBits
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%d bits, %+v: samples differ", bits, opts)
+			}
+		}
+	}
+}
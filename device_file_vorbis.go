@@ -0,0 +1,136 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+
+	"github.com/gotracker/gosound/internal/vorbis"
+)
+
+// VorbisOptions is the set of options for the Ogg Vorbis file format
+type VorbisOptions struct {
+	// Quality trades file size for fidelity, from 0 (smallest) to 10 (best), using a variable bitrate.
+	// When no options are provided, quality 4 is used.
+	Quality float64
+}
+
+type fileDeviceVorbis struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+
+	out *fileOutput
+	w   *bufio.Writer
+	enc *vorbis.Encoder
+}
+
+const (
+	vorbisDefaultQuality = 4
+
+	vorbisVendor = "gosound"
+)
+
+func newFileVorbisDevice(settings Settings) (Device, error) {
+	fd := fileDeviceVorbis{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	quality := float64(vorbisDefaultQuality)
+	if opts, ok := settings.Options.(*VorbisOptions); ok && opts != nil {
+		quality = opts.Quality
+	}
+	if quality < vorbis.MinQuality || quality > vorbis.MaxQuality {
+		return nil, errors.New("invalid quality for vorbis")
+	}
+
+	serial, err := newStreamSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(out.w)
+	enc, err := vorbis.NewEncoder(w, serial, settings.Channels, settings.SamplesPerSecond, quality, vorbisVendor, settings.Metadata.vorbisComments())
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	fd.enc = enc
+	return &fd, nil
+}
+
+// Play starts the vorbis output device playing
+func (d *fileDeviceVorbis) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the vorbis output device playing
+func (d *fileDeviceVorbis) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		if err := d.enc.Write(samplesToFloat(mixedData, d.mix.Format)); err != nil {
+			return err
+		}
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the vorbis output device
+func (d *fileDeviceVorbis) Close() {
+	if d.w == nil {
+		return
+	}
+	_ = d.enc.Close()
+	d.w.Flush()
+	_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+	d.out.Close()
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "ogg",
+		Extensions:  []string{".ogg"},
+		Description: "Ogg Vorbis",
+		Create:      newFileVorbisDevice,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
@@ -0,0 +1,161 @@
+package gosound
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// testDecodeVorbis decodes an Ogg Vorbis stream, returning the samples of each channel
+func testDecodeVorbis(t *testing.T, b []byte, channels int) [][]float32 {
+	t.Helper()
+	r, err := oggvorbis.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Channels() != channels || r.SampleRate() != testSampleRate {
+		t.Fatalf("%d channels at %d Hz", r.Channels(), r.SampleRate())
+	}
+	out := make([][]float32, channels)
+	buf := make([]float32, 4096*channels)
+	for {
+		n, err := r.Read(buf)
+		for i, v := range buf[:n] {
+			out[i%channels] = append(out[i%channels], v)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return out
+}
+
+const (
+	// testClickEvery and testClickAt place the bursts of noise struck by testClicks
+	testClickEvery = testSampleRate / 4
+	testClickAt    = 5000
+)
+
+// testClicks returns rows of a quiet tone struck by a decaying burst of noise every quarter second
+func testClicks(channels int, rows int) []*PremixData {
+	rng := rand.New(rand.NewSource(3))
+	return testRowsOf(channels, rows, testRowLen, func(c int, n int) float64 {
+		v := 0.02 * math.Sin(2*math.Pi*330*float64(n)/testSampleRate)
+		if p := n%testClickEvery - testClickAt; p >= 0 {
+			v += 0.5 * math.Exp(-float64(p)/500) * rng.NormFloat64()
+		}
+		return v
+	})
+}
+
+func TestVorbisRoundTrip(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		rows := testSignal(channels, testRows, testRowLen, testSampleRate)
+		want := testCapture(t, Settings{Channels: channels}, rows).Float32()
+		prevSNR := 0.0
+		for _, tc := range []struct {
+			quality float64
+			minSNR  float64
+			maxKbps float64
+		}{
+			{0, 23, 40},
+			{2, 24, 50},
+			{4, 27, 80},
+			{6, 30, 120},
+			{10, 38, 220},
+		} {
+			b := testRenderFile(t, "ogg", Settings{Channels: channels, Options: &VorbisOptions{Quality: tc.quality}}, rows)
+			got := testDecodeVorbis(t, b, channels)
+			if len(got[0]) != len(want[0]) {
+				t.Fatalf("%d channels, quality %v: decoded %d sample frames, want %d", channels, tc.quality, len(got[0]), len(want[0]))
+			}
+			snr := testSNR(want, got)
+			if snr < tc.minSNR || snr < prevSNR {
+				t.Errorf("%d channels, quality %v: SNR %.1f dB", channels, tc.quality, snr)
+			}
+			prevSNR = snr
+			kbps := float64(len(b)*8) / (float64(len(want[0])) / testSampleRate) / 1000
+			if kbps > tc.maxKbps*float64(channels) {
+				t.Errorf("%d channels, quality %v: %.0f kbps", channels, tc.quality, kbps)
+			}
+		}
+	}
+}
+
+func TestVorbisSilence(t *testing.T) {
+	rows := testRowsOf(2, 20, testRowLen, func(int, int) float64 { return 0 })
+	b := testRenderFile(t, "ogg", Settings{}, rows)
+	got := testDecodeVorbis(t, b, 2)
+	if len(got[0]) != 20*testRowLen {
+		t.Fatalf("decoded %d sample frames, want %d", len(got[0]), 20*testRowLen)
+	}
+	for c := range got {
+		for i, v := range got[c] {
+			if v != 0 {
+				t.Fatalf("channel %d, frame %d: %v decoded from silence", c, i, v)
+			}
+		}
+	}
+}
+
+func TestVorbisTransient(t *testing.T) {
+	for _, rows := range []int{testRows, testRows + 3} {
+		clicks := testClicks(2, rows)
+		want := testCapture(t, Settings{}, clicks).Float32()
+		got := testDecodeVorbis(t, testRenderFile(t, "ogg", Settings{}, clicks), 2)
+		if len(got[0]) != len(want[0]) {
+			t.Fatalf("%d rows: decoded %d sample frames, want %d", rows, len(got[0]), len(want[0]))
+		}
+		if snr := testSNR(want, got); snr < 25 {
+			t.Errorf("%d rows: SNR %.1f dB", rows, snr)
+		}
+
+		// short blocks keep the noise of each burst from spreading back over the quiet tone,
+		// where a long block would spread it over the 1024 samples before the burst
+		before := [][]float32{nil, nil}
+		gotBefore := [][]float32{nil, nil}
+		for at := testClickAt; at < len(want[0]); at += testClickEvery {
+			for c := range want {
+				before[c] = append(before[c], want[c][at-1024:at-32]...)
+				gotBefore[c] = append(gotBefore[c], got[c][at-1024:at-32]...)
+			}
+		}
+		if snr := testSNR(before, gotBefore); snr < 13 {
+			t.Errorf("%d rows: SNR %.1f dB before the bursts", rows, snr)
+		}
+	}
+}
+
+func TestVorbisCoupling(t *testing.T) {
+	mono := testSignal(1, testRows, testRowLen, testSampleRate)
+	monoSize := len(testRenderFile(t, "ogg", Settings{Channels: 1}, mono))
+	for _, tc := range []struct {
+		scale float64
+		// maxSize is the largest size allowed, relative to the mono file, where two channels
+		// coded apart take twice the size
+		maxSize float64
+	}{
+		{1, 1.25},
+		{0.8, 1.72},
+	} {
+		// the right channel is a copy of the left, so its angle from the left is small
+		rows := testRowsOf(2, testRows, testRowLen, func(c int, n int) float64 {
+			v := float64(mono[n/testRowLen].Data[0][0].Data[0][n%testRowLen])
+			if c == 1 {
+				v *= tc.scale
+			}
+			return v
+		})
+		b := testRenderFile(t, "ogg", Settings{}, rows)
+		got := testDecodeVorbis(t, b, 2)
+		if snr := testSNR(testCapture(t, Settings{}, rows).Float32(), got); snr < 27 {
+			t.Errorf("right channel scaled by %v: SNR %.1f dB", tc.scale, snr)
+		}
+		if size := float64(len(b)) / float64(monoSize); size > tc.maxSize {
+			t.Errorf("right channel scaled by %v: %.2f times the size of mono", tc.scale, size)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package gosound
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+type fileDeviceW64 struct {
+	fileDevice
+	mix              sampleMixer
+	samplesPerSecond int
+
+	out         *fileOutput
+	w           *bufio.Writer
+	sz          uint64
+	blockAlign  int
+	factPos     int64
+	dataSizePos int64
+	dataPos     int64
+}
+
+const (
+	w64FileSizePos = 16
+
+	// w64ChunkHeaderSize is the size of a chunk GUID and size, which is included in the chunk size
+	w64ChunkHeaderSize = 24
+	// w64Align is the alignment of each chunk
+	w64Align = 8
+	// w64UnknownSize is the chunk size used when the output cannot be seeked to fix up the sizes
+	w64UnknownSize = math.MaxUint64
+	// w64FactSize is the size of the fact chunk body, which holds the sample count of non-PCM formats
+	w64FactSize = 8
+)
+
+// Wave64 chunk GUIDs, which start with the matching RIFF chunk IDs
+var (
+	w64GUIDRiff = [16]byte{'r', 'i', 'f', 'f', 0x2E, 0x91, 0xCF, 0x11, 0xA5, 0xD6, 0x28, 0xDB, 0x04, 0xC1, 0x00, 0x00}
+	w64GUIDWave = [16]byte{'w', 'a', 'v', 'e', 0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+	w64GUIDFmt  = [16]byte{'f', 'm', 't', ' ', 0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+	w64GUIDFact = [16]byte{'f', 'a', 'c', 't', 0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+	w64GUIDData = [16]byte{'d', 'a', 't', 'a', 0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+)
+
+// w64Padding returns the number of bytes needed to align n to the chunk alignment
+func w64Padding(n uint64) uint64 {
+	return (w64Align - n%w64Align) % w64Align
+}
+
+// writeW64Chunk writes a chunk, padded to the chunk alignment, returning the number of bytes written
+func writeW64Chunk(w io.Writer, guid [16]byte, body []byte) (int64, error) {
+	if _, err := w.Write(guid[:]); err != nil { // ChunkGUID
+		return 0, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(w64ChunkHeaderSize+len(body))); err != nil { // ChunkSize
+		return 0, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return 0, err
+	}
+	pad := w64Padding(uint64(len(body)))
+	if _, err := w.Write(make([]byte, pad)); err != nil {
+		return 0, err
+	}
+	return int64(w64ChunkHeaderSize + uint64(len(body)) + pad), nil
+}
+
+func newFileW64Device(settings Settings) (Device, error) {
+	fd := fileDeviceW64{
+		fileDevice:       newFileDeviceBase(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	out, err := openFileOutput(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// sizes are fixed up on Close when the output is seekable
+	initialSize := uint64(0)
+	if !out.Seekable() {
+		initialSize = w64UnknownSize
+	}
+	sampleFormat := fd.mix.Format
+	fd.blockAlign = wavBlockAlign(settings.Channels, sampleFormat)
+
+	w := bufio.NewWriter(out.w)
+	// riff header
+	if _, err := w.Write(w64GUIDRiff[:]); err != nil { // ChunkGUID
+		return nil, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, initialSize); err != nil { // ChunkSize
+		return nil, err
+	}
+	if _, err := w.Write(w64GUIDWave[:]); err != nil { // Format
+		return nil, err
+	}
+	hdrLen := int64(40)
+
+	// fmt header
+	n, err := writeW64Chunk(w, w64GUIDFmt, wavFmt(settings.Channels, settings.SamplesPerSecond, sampleFormat))
+	if err != nil {
+		return nil, err
+	}
+	hdrLen += n
+
+	// fact header - required for non-PCM formats
+	fd.factPos = -1
+	if sampleFormat.IsFloat() {
+		var fact [w64FactSize]byte
+		binary.LittleEndian.PutUint64(fact[:], initialSize) // SampleLength
+		fd.factPos = hdrLen + w64ChunkHeaderSize
+		n, err := writeW64Chunk(w, w64GUIDFact, fact[:])
+		if err != nil {
+			return nil, err
+		}
+		hdrLen += n
+	}
+
+	// data header
+	if _, err := w.Write(w64GUIDData[:]); err != nil { // ChunkGUID
+		return nil, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, initialSize); err != nil { // ChunkSize
+		return nil, err
+	}
+
+	fd.out = out
+	fd.w = w
+	fd.dataSizePos = hdrLen + 16
+	fd.dataPos = hdrLen + w64ChunkHeaderSize
+
+	return &fd, nil
+}
+
+// Play starts the wave64 output device playing
+func (d *fileDeviceW64) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the wave64 output device playing
+func (d *fileDeviceW64) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		if d.mix.Format == SampleFormatInt8 {
+			// 8-bit PCM is unsigned
+			for i := range mixedData {
+				mixedData[i] ^= 0x80
+			}
+		}
+		sz, err := d.w.Write(mixedData)
+		if err != nil {
+			return err
+		}
+		d.sz += uint64(sz)
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// Close closes the wave64 output device
+func (d *fileDeviceW64) Close() {
+	if d.w == nil {
+		return
+	}
+	d.w.Flush()
+	defer d.out.Close()
+	_ = d.markers.writeCueSheet("WAVE", d.samplesPerSecond)
+	if !d.out.Seekable() {
+		d.w = nil
+		return
+	}
+	// chunks must be padded to the chunk alignment
+	pad := w64Padding(d.sz)
+	if _, err := d.w.Write(make([]byte, pad)); err != nil {
+		return
+	}
+	d.w.Flush()
+
+	if err := d.out.SeekTo(w64FileSizePos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, uint64(d.dataPos)+d.sz+pad); err != nil { // ChunkSize
+		return
+	}
+	d.w.Flush()
+	if err := d.out.SeekTo(d.dataSizePos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, w64ChunkHeaderSize+d.sz); err != nil { // ChunkSize
+		return
+	}
+	d.w.Flush()
+	if d.factPos >= 0 {
+		if err := d.out.SeekTo(d.factPos); err != nil {
+			return
+		}
+		if err := binary.Write(d.w, binary.LittleEndian, d.sz/uint64(d.blockAlign)); err != nil { // SampleLength
+			return
+		}
+		d.w.Flush()
+	}
+	d.w = nil
+}
+
+func init() {
+	RegisterFileFormat(FileFormat{
+		Name:        "w64",
+		Extensions:  []string{".w64"},
+		Description: "Sony Wave64",
+		Create:      newFileW64Device,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
+}
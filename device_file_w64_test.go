@@ -0,0 +1,88 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testW64Chunks checks the riff header of a Wave64 file, returning its chunks by the ID their GUID starts with
+func testW64Chunks(t *testing.T, b []byte) []testChunk {
+	t.Helper()
+	if len(b) < 40 || !bytes.Equal(b[0:16], w64GUIDRiff[:]) || !bytes.Equal(b[24:40], w64GUIDWave[:]) {
+		t.Fatal("no riff wave header")
+	}
+	if size := binary.LittleEndian.Uint64(b[w64FileSizePos:]); size != uint64(len(b)) {
+		t.Fatalf("riff size %d, want %d", size, len(b))
+	}
+	var chunks []testChunk
+	for pos := 40; pos < len(b); {
+		if pos%w64Align != 0 || pos+w64ChunkHeaderSize > len(b) {
+			t.Fatalf("misaligned or truncated chunk header at %d", pos)
+		}
+		size := int(binary.LittleEndian.Uint64(b[pos+16:]))
+		if size < w64ChunkHeaderSize || pos+size > len(b) {
+			t.Fatalf("chunk of %d bytes at %d overruns the file", size, pos)
+		}
+		chunks = append(chunks, testChunk{id: string(b[pos : pos+4]), body: b[pos+w64ChunkHeaderSize : pos+size]})
+		pos += size + int(w64Padding(uint64(size)))
+	}
+	return chunks
+}
+
+func TestW64RoundTrip(t *testing.T) {
+	// an odd frame count with 8-bit mono leaves the data chunk to be padded
+	rows := testSignal(1, 3, 147, testSampleRate)
+	for _, bits := range []int{8, 16, 24} {
+		s := Settings{Channels: 1, BitsPerSample: bits}
+		want := testCapture(t, s, rows).Samples()
+		chunks := testW64Chunks(t, testRenderFile(t, "w64", s, rows))
+		if body := testFindChunk(t, chunks, "fmt "); !bytes.Equal(body, wavFmt(1, testSampleRate, sampleFormatForBits(bits))) {
+			t.Fatalf("%d bits: fmt chunk %x", bits, body)
+		}
+		data := testFindChunk(t, chunks, "data")
+		if len(data) != len(want[0])*bits/8 {
+			t.Fatalf("%d bits: %d bytes of data", bits, len(data))
+		}
+		if bits == 8 {
+			// 8-bit PCM is unsigned
+			data = append([]byte(nil), data...)
+			for i := range data {
+				data[i] ^= 0x80
+			}
+		}
+		got := testDecodeInts(data, 1, sampleFormatForBits(bits), binary.LittleEndian)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d bits: samples differ", bits)
+		}
+	}
+
+	// 8-bit silence is the middle of the unsigned range
+	silence := testRowsOf(1, 3, 147, func(int, int) float64 { return 0 })
+	data := testFindChunk(t, testW64Chunks(t, testRenderFile(t, "w64", Settings{Channels: 1, BitsPerSample: 8}, silence)), "data")
+	for i, v := range data {
+		if v != 0x80 {
+			t.Fatalf("8 bits: byte %d of silence is %#x, want 0x80", i, v)
+		}
+	}
+}
+
+func TestW64Float(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	chunks := testW64Chunks(t, testRenderFile(t, "w64", Settings{SampleFormat: SampleFormatFloat32}, rows))
+	if n := binary.LittleEndian.Uint64(testFindChunk(t, chunks, "fact")); n != 20*testRowLen {
+		t.Fatalf("fact chunk holds %d sample frames, want %d", n, 20*testRowLen)
+	}
+	if n := len(testFindChunk(t, chunks, "data")); n != 20*testRowLen*2*4 {
+		t.Fatalf("%d bytes of data", n)
+	}
+}
+
+func TestW64NotSeekable(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	b := testRenderStream(t, "w64", Settings{}, rows)
+	if size := binary.LittleEndian.Uint64(b[w64FileSizePos:]); size != w64UnknownSize {
+		t.Fatalf("riff size %d written to a stream that cannot seek", size)
+	}
+}
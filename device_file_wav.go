@@ -5,98 +5,294 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
-	"os"
+	"math"
+	"time"
 
 	"github.com/gotracker/gomixing/mixing"
 )
 
+// WavOptions is the set of options for the WAV file format
+type WavOptions struct {
+	// Streaming writes streaming-friendly chunk sizes and skips the size fixups
+	// on Close, even if the output is seekable
+	Streaming bool
+	// Broadcast, when set, writes a Broadcast Wave Format bext chunk
+	Broadcast *WavBroadcast
+	// ID3 writes the metadata to an id3 chunk, in addition to the LIST/INFO chunk
+	ID3 bool
+	// Encoding is the encoding of the samples; the compressed encodings are
+	// encoded from 16-bit samples, whatever the stream's sample format
+	Encoding WavEncoding
+	// Sampler, when set, writes a smpl chunk on Close, unless replaced by a row
+	// whose Userdata implements WavSamplerSource
+	Sampler *WavSampler
+}
+
 type fileDeviceWav struct {
 	fileDevice
-	mix mixing.Mixer
+	mix sampleMixer
 
-	f  *os.File
-	w  *bufio.Writer
-	sz uint32
+	out         *fileOutput
+	w           *bufio.Writer
+	sz          uint64
+	streaming   bool
+	sampler     *WavSampler
+	enc         wavEncoder
+	junkPos     int64
+	factPos     int64
+	dataSizePos int64
+	dataPos     int64
 }
 
 const (
-	wavFileChunkSizePos     = 4
-	wavFileSubchunk2SizePos = 40
+	wavFileChunkSizePos = 4
+
+	// wavStreamingSize is the chunk size used when the output cannot be seeked to fix up the sizes
+	wavStreamingSize = 0xFFFFFFFF
+	// wavRF64Size is the 32-bit chunk size used in RF64 files, where the real size is held in the ds64 chunk
+	wavRF64Size = 0xFFFFFFFF
+
+	// wavDs64Size is the size of the ds64 chunk body, without a chunk size table
+	// a JUNK chunk of the same size is reserved at the start of the file so it can be replaced by ds64 on Close
+	wavDs64Size = 28
+
+	wavFormatPCM        = 0x0001 // = win32.WAVE_FORMAT_PCM
+	wavFormatIEEEFloat  = 0x0003 // = win32.WAVE_FORMAT_IEEE_FLOAT
+	wavFormatExtensible = 0xFFFE // = win32.WAVE_FORMAT_EXTENSIBLE
+
+	wavFmtSizePCM        = 16
+	wavFmtSizeEx         = 18
+	wavFmtSizeExtensible = 40
+	wavExtensibleCbSize  = wavFmtSizeExtensible - wavFmtSizeEx
+
+	// wavFactSize is the size of the fact chunk body, which holds the sample count of non-PCM formats
+	wavFactSize = 4
+)
+
+// wavMaxRiffSize is the largest RIFF chunk size, past which the file is upgraded to RF64 on Close.
+// It is only lowered by tests, which cannot write 4 GiB files.
+var wavMaxRiffSize uint64 = math.MaxUint32
+
+// speaker positions for the channel mask of WAVE_FORMAT_EXTENSIBLE
+const (
+	wavSpeakerFrontLeft          = 0x1
+	wavSpeakerFrontRight         = 0x2
+	wavSpeakerFrontCenter        = 0x4
+	wavSpeakerLowFrequency       = 0x8
+	wavSpeakerBackLeft           = 0x10
+	wavSpeakerBackRight          = 0x20
+	wavSpeakerBackCenter         = 0x100
+	wavSpeakerSideLeft           = 0x200
+	wavSpeakerSideRight          = 0x400
+	wavSpeakerFrontLeftRight     = wavSpeakerFrontLeft | wavSpeakerFrontRight
+	wavSpeakerBackLeftRight      = wavSpeakerBackLeft | wavSpeakerBackRight
+	wavSpeakerSideLeftRight      = wavSpeakerSideLeft | wavSpeakerSideRight
+	wavSpeakerFrontCenterLowFreq = wavSpeakerFrontCenter | wavSpeakerLowFrequency
 )
 
+// wavChannelMasks is the channel mask for each channel count, indexed by channel count - 1.
+// The 4 channel layout matches the quad layout produced by the pan mixer.
+var wavChannelMasks = [...]uint32{
+	wavSpeakerFrontCenter,
+	wavSpeakerFrontLeftRight,
+	wavSpeakerFrontLeftRight | wavSpeakerFrontCenter,
+	wavSpeakerFrontLeftRight | wavSpeakerBackLeftRight,
+	wavSpeakerFrontLeftRight | wavSpeakerFrontCenter | wavSpeakerBackLeftRight,
+	wavSpeakerFrontLeftRight | wavSpeakerFrontCenterLowFreq | wavSpeakerBackLeftRight,
+	wavSpeakerFrontLeftRight | wavSpeakerFrontCenterLowFreq | wavSpeakerBackCenter | wavSpeakerSideLeftRight,
+	wavSpeakerFrontLeftRight | wavSpeakerFrontCenterLowFreq | wavSpeakerBackLeftRight | wavSpeakerSideLeftRight,
+}
+
+// wavSubFormatPCM is KSDATAFORMAT_SUBTYPE_PCM (00000001-0000-0010-8000-00aa00389b71)
+var wavSubFormatPCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// wavSubFormatIEEEFloat is KSDATAFORMAT_SUBTYPE_IEEE_FLOAT (00000003-0000-0010-8000-00aa00389b71)
+var wavSubFormatIEEEFloat = [16]byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// wavChannelMask returns the speaker layout for the channel count
+func wavChannelMask(channels int) uint32 {
+	if channels < 1 || channels > len(wavChannelMasks) {
+		return 0
+	}
+	return wavChannelMasks[channels-1]
+}
+
+// wavNeedsExtensible returns true if the format can only be described by WAVE_FORMAT_EXTENSIBLE
+func wavNeedsExtensible(channels int, format SampleFormat) bool {
+	bitsPerSample := format.BitsPerSample()
+	return channels > 2 || (!format.IsFloat() && bitsPerSample > 16) || bitsPerSample%8 != 0
+}
+
+// wavBlockAlign returns the size of a sample frame, with each sample rounded up to whole bytes
+func wavBlockAlign(channels int, format SampleFormat) int {
+	return channels * ((format.BitsPerSample() + 7) / 8)
+}
+
+// wavFmt returns the body of the fmt chunk describing the stream
+func wavFmt(channels int, samplesPerSecond int, format SampleFormat) []byte {
+	bitsPerSample := format.BitsPerSample()
+	// the container size of each sample is rounded up to whole bytes
+	containerBits := (bitsPerSample + 7) / 8 * 8
+	blockAlign := wavBlockAlign(channels, format)
+
+	extensible := wavNeedsExtensible(channels, format)
+	audioFormat := uint16(wavFormatPCM)
+	subFormat := wavSubFormatPCM
+	fmtSize := wavFmtSizePCM
+	if format.IsFloat() {
+		// non-PCM formats carry a CbSize, even when there is no extra format information
+		audioFormat = wavFormatIEEEFloat
+		subFormat = wavSubFormatIEEEFloat
+		fmtSize = wavFmtSizeEx
+	}
+	if extensible {
+		audioFormat = wavFormatExtensible
+		fmtSize = wavFmtSizeExtensible
+	}
+
+	// = win32.WAVEFORMATEX
+	b := make([]byte, fmtSize)
+	binary.LittleEndian.PutUint16(b[0:], audioFormat)                         // AudioFormat
+	binary.LittleEndian.PutUint16(b[2:], uint16(channels))                    // NumChannels
+	binary.LittleEndian.PutUint32(b[4:], uint32(samplesPerSecond))            // SampleRate
+	binary.LittleEndian.PutUint32(b[8:], uint32(samplesPerSecond*blockAlign)) // ByteRate
+	binary.LittleEndian.PutUint16(b[12:], uint16(blockAlign))                 // BlockAlign
+	binary.LittleEndian.PutUint16(b[14:], uint16(containerBits))              // BitsPerSample
+	// the CbSize is 0 when there is no extra format information
+	if extensible {
+		// = win32.WAVEFORMATEXTENSIBLE (from the CbSize)
+		binary.LittleEndian.PutUint16(b[16:], uint16(wavExtensibleCbSize)) // CbSize
+		binary.LittleEndian.PutUint16(b[18:], uint16(bitsPerSample))       // ValidBitsPerSample
+		binary.LittleEndian.PutUint32(b[20:], wavChannelMask(channels))    // ChannelMask
+		copy(b[24:], subFormat[:])                                         // SubFormat
+	}
+	return b
+}
+
 func newFileWavDevice(settings Settings) (Device, error) {
 	fd := fileDeviceWav{
-		fileDevice: fileDevice{
-			device: device{
-				onRowOutput: settings.OnRowOutput,
-			},
-		},
-		mix: mixing.Mixer{
-			Channels:      settings.Channels,
-			BitsPerSample: settings.BitsPerSample,
-		},
+		fileDevice: newFileDeviceBase(settings),
+		mix:        newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+	}
+	opts, _ := settings.Options.(*WavOptions)
+	if opts == nil {
+		opts = &WavOptions{}
 	}
-	f, err := os.OpenFile(settings.Filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	sampleFormat := fd.mix.Format
+	fmtBody := wavFmt(settings.Channels, settings.SamplesPerSecond, sampleFormat)
+	if opts.Encoding != WavEncodingPCM {
+		var err error
+		fd.enc, fmtBody, err = newWavEncoder(opts.Encoding, settings.Channels, settings.SamplesPerSecond)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := openFileOutput(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	if f == nil {
-		return nil, errors.New("unexpected file error")
+	// sizes are fixed up on Close when the output is seekable
+	fd.streaming = !out.Seekable()
+	if opts.Streaming {
+		fd.streaming = true
+	}
+	fd.sampler = opts.Sampler
+	initialSize := uint32(0)
+	if fd.streaming {
+		initialSize = wavStreamingSize
 	}
 
-	byteRate := settings.SamplesPerSecond * settings.Channels * settings.BitsPerSample / 8
-	blockAlign := settings.Channels * settings.BitsPerSample / 8
-
-	w := bufio.NewWriter(f)
+	w := bufio.NewWriter(out.w)
 	// RIFF header
 	if _, err := w.Write([]byte{'R', 'I', 'F', 'F'}); err != nil { // ChunkID
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(0)); err != nil { // ChunkSize
+	if err := binary.Write(w, binary.LittleEndian, initialSize); err != nil { // ChunkSize
 		return nil, err
 	}
 	if _, err := w.Write([]byte{'W', 'A', 'V', 'E'}); err != nil { // Format
 		return nil, err
 	}
+	hdrLen := int64(12)
 
-	// fmt header
-	if _, err := w.Write([]byte{'f', 'm', 't', ' '}); err != nil { // Subchunk1ID
-		return nil, err
-	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(16)); err != nil { // Subchunk1Size
-		return nil, err
-	}
-	// = win32.WAVEFORMATEX (before the CbSize)
-	if err := binary.Write(w, binary.LittleEndian, uint16(0x001)); err != nil { // AudioFormat // = win32.WAVE_FORMAT_PCM
-		return nil, err
+	// JUNK header - reserves space for a ds64 chunk, should the file need to become RF64
+	fd.junkPos = -1
+	if !fd.streaming {
+		fd.junkPos = hdrLen
+		if _, err := w.Write([]byte{'J', 'U', 'N', 'K'}); err != nil { // ChunkID
+			return nil, err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint32(wavDs64Size)); err != nil { // ChunkSize
+			return nil, err
+		}
+		if _, err := w.Write(make([]byte, wavDs64Size)); err != nil {
+			return nil, err
+		}
+		hdrLen += 8 + wavDs64Size
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(settings.Channels)); err != nil { // NumChannels
+
+	// fmt header
+	n, err := writeWavChunk(w, "fmt ", fmtBody)
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(settings.SamplesPerSecond)); err != nil { // SampleRate
-		return nil, err
+	hdrLen += n
+
+	// fact header - required for non-PCM formats
+	fd.factPos = -1
+	if sampleFormat.IsFloat() || fd.enc != nil {
+		if _, err := w.Write([]byte{'f', 'a', 'c', 't'}); err != nil { // ChunkID
+			return nil, err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint32(wavFactSize)); err != nil { // ChunkSize
+			return nil, err
+		}
+		if err := binary.Write(w, binary.LittleEndian, initialSize); err != nil { // SampleLength
+			return nil, err
+		}
+		fd.factPos = hdrLen + 8
+		hdrLen += 8 + wavFactSize
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(byteRate)); err != nil { // ByteRate
-		return nil, err
+
+	// bext header
+	if opts.Broadcast != nil {
+		n, err := writeWavChunk(w, "bext", wavBext(opts.Broadcast, settings.Metadata, time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		hdrLen += n
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(blockAlign)); err != nil { // BlockAlign
+
+	// LIST header
+	n, err = writeWavChunk(w, "LIST", wavInfoList(settings.Metadata))
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint16(settings.BitsPerSample)); err != nil { // BitsPerSample
-		return nil, err
+	hdrLen += n
+
+	// id3 header
+	if opts.ID3 {
+		n, err := writeWavChunk(w, "id3 ", id3v2Tag(settings.Metadata, wavID3Padding))
+		if err != nil {
+			return nil, err
+		}
+		hdrLen += n
 	}
 
 	// data header
 	if _, err := w.Write([]byte{'d', 'a', 't', 'a'}); err != nil { // Subchunk2ID
 		return nil, err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint32(0)); err != nil { // Subchunk2Size
+	if err := binary.Write(w, binary.LittleEndian, initialSize); err != nil { // Subchunk2Size
 		return nil, err
 	}
 
-	fd.f = f
+	fd.out = out
 	fd.w = w
+	fd.dataSizePos = hdrLen + 4
+	fd.dataPos = hdrLen + 8
 
 	return &fd, nil
 }
@@ -116,48 +312,201 @@ func (d *fileDeviceWav) PlayWithCtx(ctx context.Context, in <-chan *PremixData)
 	myCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	defer d.ctl.reset()
 	for {
-		select {
-		case <-myCtx.Done():
-			return myCtx.Err()
-		case row, ok := <-in:
-			if !ok {
-				return nil
-			}
-			mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
-			sz, err := d.w.Write(mixedData)
-			if err != nil {
-				return err
-			}
-			d.sz += uint32(sz)
-			if d.onRowOutput != nil {
-				d.onRowOutput(KindFile, row)
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		d.markers.record(row, d.frames.renderedFrames())
+		if s, ok := row.Userdata.(WavSamplerSource); ok {
+			if sampler := s.WavSampler(); sampler != nil {
+				d.sampler = sampler
 			}
 		}
+		var mixedData []byte
+		if d.enc != nil {
+			mixedData = d.enc.encode(d.flattenTo16(panmixer, row))
+		} else {
+			mixedData = d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		}
+		sz, err := d.w.Write(mixedData)
+		if err != nil {
+			return err
+		}
+		d.sz += uint64(sz)
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindFile, row)
+		}
+	}
+}
+
+// flattenTo16 returns the 16-bit sample data for the row, one slice per channel
+func (d *fileDeviceWav) flattenTo16(panmixer mixing.PanMixer, row *PremixData) [][]int16 {
+	data := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+	out := make([][]int16, len(data))
+	for c, samples := range data {
+		out[c] = make([]int16, len(samples))
+		for i, v := range samples {
+			out[c][i] = sampleTo16(v, d.mix.Format)
+		}
 	}
+	return out
 }
 
 // Close closes the wave output device
 func (d *fileDeviceWav) Close() {
+	if d.enc != nil {
+		// the last block is padded with silence
+		if sz, err := d.w.Write(d.enc.flush()); err == nil {
+			d.sz += uint64(sz)
+		}
+	}
+	d.w.Flush()
+	defer d.out.Close()
+	_ = d.markers.writeCueSheet("WAVE", d.format.SamplesPerSecond)
+	// chunks must be padded to an even size
+	pad := d.sz & 1
+	if pad != 0 {
+		if err := d.w.WriteByte(0); err != nil {
+			return
+		}
+	}
+	// smpl, cue and LIST headers - the sampler details and markers follow the data
+	tail := int64(0)
+	if d.sampler != nil {
+		n, err := writeWavChunk(d.w, "smpl", wavSmpl(d.sampler, d.frames.renderedFrames(), d.format.SamplesPerSecond))
+		if err != nil {
+			return
+		}
+		tail += n
+	}
+	if markers := d.markers.embedded(); len(markers) > 0 {
+		samplesPerBlock, blockAlign := 0, 0
+		if d.enc != nil {
+			samplesPerBlock, blockAlign = d.enc.blockSize()
+		}
+		n, err := writeWavChunk(d.w, "cue ", wavCue(markers, samplesPerBlock, blockAlign))
+		if err != nil {
+			return
+		}
+		tail += n
+		n, err = writeWavChunk(d.w, "LIST", wavAdtlList(markers))
+		if err != nil {
+			return
+		}
+		tail += n
+	}
 	d.w.Flush()
-	chunkSize := 36 + d.sz
-	if _, err := d.f.Seek(wavFileChunkSizePos, 0); err != nil {
+	// the chunks after the data need no seeking, but the sizes cannot be fixed up when streaming
+	if d.streaming {
+		return
+	}
+	chunkSize := uint64(d.dataPos) - 8 + d.sz + pad + uint64(tail)
+	if chunkSize > wavMaxRiffSize && d.junkPos >= 0 {
+		d.closeRF64(chunkSize)
+		return
+	}
+	if err := d.out.SeekTo(wavFileChunkSizePos); err != nil {
 		return
 	}
 	if err := binary.Write(d.w, binary.LittleEndian, uint32(chunkSize)); err != nil { // ChunkSize
 		return
 	}
-	if _, err := d.f.Seek(wavFileSubchunk2SizePos, 0); err != nil {
+	d.w.Flush()
+	if err := d.out.SeekTo(d.dataSizePos); err != nil {
 		return
 	}
 	if err := binary.Write(d.w, binary.LittleEndian, uint32(d.sz)); err != nil { // Subchunk2Size
 		return
 	}
 	d.w.Flush()
+	if d.factPos >= 0 {
+		if err := d.out.SeekTo(d.factPos); err != nil {
+			return
+		}
+		if err := binary.Write(d.w, binary.LittleEndian, uint32(d.frames.renderedFrames())); err != nil { // SampleLength
+			return
+		}
+		d.w.Flush()
+	}
+	d.w = nil
+}
+
+// closeRF64 upgrades the file to RF64, replacing the reserved JUNK chunk with a ds64 chunk
+func (d *fileDeviceWav) closeRF64(chunkSize uint64) {
+	// RF64 header
+	if err := d.out.SeekTo(0); err != nil {
+		return
+	}
+	if _, err := d.w.Write([]byte{'R', 'F', '6', '4'}); err != nil { // ChunkID
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, uint32(wavRF64Size)); err != nil { // ChunkSize
+		return
+	}
+	d.w.Flush()
+
+	// ds64 header
+	if err := d.out.SeekTo(d.junkPos); err != nil {
+		return
+	}
+	if _, err := d.w.Write([]byte{'d', 's', '6', '4'}); err != nil { // ChunkID
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, uint32(wavDs64Size)); err != nil { // ChunkSize
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, chunkSize); err != nil { // RIFFSize
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, d.sz); err != nil { // DataSize
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, d.frames.renderedFrames()); err != nil { // SampleCount
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, uint32(0)); err != nil { // TableLength
+		return
+	}
+	d.w.Flush()
+
+	if err := d.out.SeekTo(d.dataSizePos); err != nil {
+		return
+	}
+	if err := binary.Write(d.w, binary.LittleEndian, uint32(wavRF64Size)); err != nil { // Subchunk2Size
+		return
+	}
+	d.w.Flush()
+	if d.factPos >= 0 {
+		// the sample count is held in the ds64 chunk
+		if err := d.out.SeekTo(d.factPos); err != nil {
+			return
+		}
+		if err := binary.Write(d.w, binary.LittleEndian, uint32(wavRF64Size)); err != nil { // SampleLength
+			return
+		}
+		d.w.Flush()
+	}
 	d.w = nil
-	d.f.Close()
 }
 
 func init() {
-	fileDeviceMap[".wav"] = newFileWavDevice
+	RegisterFileFormat(FileFormat{
+		Name:        "wav",
+		Extensions:  []string{".wav", ".wave"},
+		Description: "RIFF WAVE",
+		Create:      newFileWavDevice,
+		Capabilities: Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		},
+	})
 }
@@ -0,0 +1,413 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// WavEncoding is the encoding of the samples in a WAV file
+type WavEncoding int
+
+const (
+	// WavEncodingPCM writes the samples in the stream's sample format
+	WavEncodingPCM = WavEncoding(iota)
+	// WavEncodingMuLaw writes 8-bit G.711 μ-law samples
+	WavEncodingMuLaw
+	// WavEncodingALaw writes 8-bit G.711 A-law samples
+	WavEncodingALaw
+	// WavEncodingIMAADPCM writes 4-bit IMA ADPCM samples
+	WavEncodingIMAADPCM
+	// WavEncodingMSADPCM writes 4-bit Microsoft ADPCM samples
+	WavEncodingMSADPCM
+)
+
+const (
+	wavFormatMSADPCM  = 0x0002 // = win32.WAVE_FORMAT_ADPCM
+	wavFormatALaw     = 0x0006 // = win32.WAVE_FORMAT_ALAW
+	wavFormatMuLaw    = 0x0007 // = win32.WAVE_FORMAT_MULAW
+	wavFormatIMAADPCM = 0x0011 // = win32.WAVE_FORMAT_IMA_ADPCM
+
+	// wavADPCMBlockSize is the size of an ADPCM block per channel, for each multiple of 11025Hz
+	wavADPCMBlockSize = 256
+
+	wavIMAHeaderSize = 4
+	wavMSHeaderSize  = 7
+	// wavMSMinDelta is the smallest step size of the Microsoft ADPCM encoder
+	wavMSMinDelta = 16
+)
+
+// wavIMAStepTable is the step size for each IMA ADPCM step index
+var wavIMAStepTable = [89]int32{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17, 19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118, 130, 143, 157, 173, 190, 209, 230,
+	253, 279, 307, 337, 371, 408, 449, 494, 544, 598, 658, 724, 796, 876, 963,
+	1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066, 2272, 2499, 2749, 3024, 3327,
+	3660, 4026, 4428, 4871, 5358, 5894, 6484, 7132, 7845, 8630, 9493, 10442,
+	11487, 12635, 13899, 15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794,
+	32767,
+}
+
+// wavIMAIndexTable is the change to the IMA ADPCM step index for each code
+var wavIMAIndexTable = [16]int{-1, -1, -1, -1, 2, 4, 6, 8, -1, -1, -1, -1, 2, 4, 6, 8}
+
+// wavMSCoefficients are the standard Microsoft ADPCM predictor coefficient pairs
+var wavMSCoefficients = [7][2]int32{
+	{256, 0}, {512, -256}, {0, 0}, {192, 64}, {240, 0}, {460, -208}, {392, -232},
+}
+
+// wavMSAdaptationTable is the change to the Microsoft ADPCM step size for each code, in 1/256ths
+var wavMSAdaptationTable = [16]int32{230, 230, 230, 230, 307, 409, 512, 614, 768, 614, 512, 409, 307, 230, 230, 230}
+
+// wavEncoder encodes 16-bit samples for a compressed WAV encoding
+type wavEncoder interface {
+	// encode returns the encoded data for the samples, one slice per channel.
+	// Samples that do not fill a block are held until the next call.
+	encode(samples [][]int16) []byte
+	// flush returns the held samples as a final block, padded with silence
+	flush() []byte
+	// blockSize returns the number of sample frames and bytes in each block, or 0 when the
+	// encoding has no blocks
+	blockSize() (samplesPerBlock int, blockAlign int)
+}
+
+// newWavEncoder returns the encoder and the body of the fmt chunk for a compressed encoding
+func newWavEncoder(encoding WavEncoding, channels int, samplesPerSecond int) (wavEncoder, []byte, error) {
+	switch encoding {
+	case WavEncodingMuLaw:
+		return &wavG711Encoder{compand: linearToMuLaw}, wavCodecFmt(wavFormatMuLaw, channels, samplesPerSecond, channels, 1, 8, nil), nil
+	case WavEncodingALaw:
+		return &wavG711Encoder{compand: linearToALaw}, wavCodecFmt(wavFormatALaw, channels, samplesPerSecond, channels, 1, 8, nil), nil
+	}
+
+	multiple := samplesPerSecond / 11025
+	if multiple < 1 {
+		multiple = 1
+	}
+	blockAlign := wavADPCMBlockSize * channels * multiple
+	switch encoding {
+	case WavEncodingIMAADPCM:
+		// a header sample per channel, then groups of 8 samples per channel
+		samplesPerBlock := (blockAlign-wavIMAHeaderSize*channels)/(4*channels)*8 + 1
+		extra := make([]byte, 2)
+		binary.LittleEndian.PutUint16(extra, uint16(samplesPerBlock)) // SamplesPerBlock
+		enc := &wavIMAEncoder{
+			wavBlockEncoder: newWavBlockEncoder(channels, samplesPerBlock, blockAlign),
+			index:           make([]int, channels),
+		}
+		return enc, wavCodecFmt(wavFormatIMAADPCM, channels, samplesPerSecond, blockAlign, samplesPerBlock, 4, extra), nil
+	case WavEncodingMSADPCM:
+		if channels > 2 {
+			return nil, nil, errors.New("invalid channel count for microsoft adpcm")
+		}
+		// two header samples per channel, then a nibble per sample
+		samplesPerBlock := (blockAlign-wavMSHeaderSize*channels)*2/channels + 2
+		extra := make([]byte, 4+len(wavMSCoefficients)*4)
+		binary.LittleEndian.PutUint16(extra[0:], uint16(samplesPerBlock))        // SamplesPerBlock
+		binary.LittleEndian.PutUint16(extra[2:], uint16(len(wavMSCoefficients))) // NumCoef
+		for i, c := range wavMSCoefficients {
+			binary.LittleEndian.PutUint16(extra[4+i*4:], uint16(int16(c[0]))) // Coef1
+			binary.LittleEndian.PutUint16(extra[6+i*4:], uint16(int16(c[1]))) // Coef2
+		}
+		enc := &wavMSEncoder{
+			wavBlockEncoder: newWavBlockEncoder(channels, samplesPerBlock, blockAlign),
+		}
+		return enc, wavCodecFmt(wavFormatMSADPCM, channels, samplesPerSecond, blockAlign, samplesPerBlock, 4, extra), nil
+	}
+	return nil, nil, errors.New("invalid wav encoding")
+}
+
+// wavCodecFmt returns the body of the fmt chunk for a compressed encoding
+func wavCodecFmt(audioFormat uint16, channels int, samplesPerSecond int, blockAlign int, samplesPerBlock int, bitsPerSample int, extra []byte) []byte {
+	// = win32.WAVEFORMATEX
+	b := make([]byte, wavFmtSizeEx, wavFmtSizeEx+len(extra))
+	byteRate := uint64(samplesPerSecond) * uint64(blockAlign) / uint64(samplesPerBlock)
+	binary.LittleEndian.PutUint16(b[0:], audioFormat)              // AudioFormat
+	binary.LittleEndian.PutUint16(b[2:], uint16(channels))         // NumChannels
+	binary.LittleEndian.PutUint32(b[4:], uint32(samplesPerSecond)) // SampleRate
+	binary.LittleEndian.PutUint32(b[8:], uint32(byteRate))         // ByteRate
+	binary.LittleEndian.PutUint16(b[12:], uint16(blockAlign))      // BlockAlign
+	binary.LittleEndian.PutUint16(b[14:], uint16(bitsPerSample))   // BitsPerSample
+	binary.LittleEndian.PutUint16(b[16:], uint16(len(extra)))      // CbSize
+	return append(b, extra...)
+}
+
+// wavG711Encoder encodes samples as 8-bit G.711, which has no blocks
+type wavG711Encoder struct {
+	compand func(int16) byte
+}
+
+func (e *wavG711Encoder) encode(samples [][]int16) []byte {
+	out := make([]byte, 0, len(samples)*len(samples[0]))
+	for i := range samples[0] {
+		for _, s := range samples {
+			out = append(out, e.compand(s[i]))
+		}
+	}
+	return out
+}
+
+func (e *wavG711Encoder) flush() []byte {
+	return nil
+}
+
+func (e *wavG711Encoder) blockSize() (int, int) {
+	return 0, 0
+}
+
+// wavBlockEncoder holds samples until they fill a block
+type wavBlockEncoder struct {
+	samplesPerBlock int
+	blockAlign      int
+	pending         [][]int16
+}
+
+func newWavBlockEncoder(channels int, samplesPerBlock int, blockAlign int) wavBlockEncoder {
+	return wavBlockEncoder{
+		samplesPerBlock: samplesPerBlock,
+		blockAlign:      blockAlign,
+		pending:         make([][]int16, channels),
+	}
+}
+
+func (e *wavBlockEncoder) blockSize() (int, int) {
+	return e.samplesPerBlock, e.blockAlign
+}
+
+// blocks appends the samples to the pending samples, calling encodeBlock for each full block
+func (e *wavBlockEncoder) blocks(samples [][]int16, encodeBlock func([][]int16) []byte) []byte {
+	for c, s := range samples {
+		e.pending[c] = append(e.pending[c], s...)
+	}
+	var out []byte
+	for len(e.pending[0]) >= e.samplesPerBlock {
+		block := make([][]int16, len(e.pending))
+		for c, p := range e.pending {
+			block[c] = p[:e.samplesPerBlock]
+		}
+		out = append(out, encodeBlock(block)...)
+		for c, p := range e.pending {
+			e.pending[c] = append([]int16(nil), p[e.samplesPerBlock:]...)
+		}
+	}
+	return out
+}
+
+// flushBlock pads the pending samples to a full block, calling encodeBlock for it
+func (e *wavBlockEncoder) flushBlock(encodeBlock func([][]int16) []byte) []byte {
+	if len(e.pending[0]) == 0 {
+		return nil
+	}
+	for c, p := range e.pending {
+		e.pending[c] = append(p, make([]int16, e.samplesPerBlock-len(p))...)
+	}
+	return e.blocks(nil, encodeBlock)
+}
+
+// wavIMAEncoder encodes samples as IMA ADPCM
+type wavIMAEncoder struct {
+	wavBlockEncoder
+	// index is the step index of each channel, which carries over from block to block
+	index []int
+}
+
+func (e *wavIMAEncoder) encode(samples [][]int16) []byte {
+	return e.blocks(samples, e.encodeBlock)
+}
+
+func (e *wavIMAEncoder) flush() []byte {
+	return e.flushBlock(e.encodeBlock)
+}
+
+func (e *wavIMAEncoder) encodeBlock(block [][]int16) []byte {
+	channels := len(block)
+	out := make([]byte, wavIMAHeaderSize*channels, wavIMAHeaderSize*channels+(e.samplesPerBlock-1)/2*channels)
+	predictor := make([]int32, channels)
+	for c, s := range block {
+		// the first sample is held in the header as is
+		predictor[c] = int32(s[0])
+		binary.LittleEndian.PutUint16(out[c*wavIMAHeaderSize:], uint16(s[0])) // Sample
+		out[c*wavIMAHeaderSize+2] = byte(e.index[c])                          // StepIndex
+	}
+	// each channel writes 4 bytes (8 samples) in turn, with the earlier sample in the low nibble
+	for i := 1; i < e.samplesPerBlock; i += 8 {
+		for c, s := range block {
+			for j := 0; j < 8; j += 2 {
+				lo := e.encodeSample(c, &predictor[c], s[i+j])
+				hi := e.encodeSample(c, &predictor[c], s[i+j+1])
+				out = append(out, lo|hi<<4)
+			}
+		}
+	}
+	return out
+}
+
+// encodeSample returns the 4-bit code for the sample, updating the predictor and step index as the decoder will
+func (e *wavIMAEncoder) encodeSample(c int, predictor *int32, sample int16) byte {
+	step := wavIMAStepTable[e.index[c]]
+	diff := int32(sample) - *predictor
+	var code byte
+	if diff < 0 {
+		code = 8
+		diff = -diff
+	}
+	// the decoder reconstructs the difference from the bits of the code
+	delta := step >> 3
+	if diff >= step {
+		code |= 4
+		diff -= step
+		delta += step
+	}
+	if diff >= step>>1 {
+		code |= 2
+		diff -= step >> 1
+		delta += step >> 1
+	}
+	if diff >= step>>2 {
+		code |= 1
+		delta += step >> 2
+	}
+	if code&8 != 0 {
+		*predictor -= delta
+	} else {
+		*predictor += delta
+	}
+	*predictor = clampInt16(*predictor)
+	e.index[c] += wavIMAIndexTable[code]
+	if e.index[c] < 0 {
+		e.index[c] = 0
+	} else if e.index[c] >= len(wavIMAStepTable) {
+		e.index[c] = len(wavIMAStepTable) - 1
+	}
+	return code
+}
+
+// wavMSEncoder encodes samples as Microsoft ADPCM
+type wavMSEncoder struct {
+	wavBlockEncoder
+}
+
+// wavMSState is the state of a Microsoft ADPCM channel
+type wavMSState struct {
+	coef1, coef2 int32
+	delta        int32
+	// sample1 is the last decoded sample, and sample2 the one before it
+	sample1, sample2 int32
+}
+
+// predict returns the 4-bit code for the sample, updating the state as the decoder will
+func (s *wavMSState) predict(sample int16) byte {
+	predicted := (s.sample1*s.coef1 + s.sample2*s.coef2) >> 8
+	diff := int32(sample) - predicted
+	// round the difference to the nearest step
+	var code int32
+	if diff >= 0 {
+		code = (diff + s.delta/2) / s.delta
+	} else {
+		code = (diff - s.delta/2) / s.delta
+	}
+	if code > 7 {
+		code = 7
+	} else if code < -8 {
+		code = -8
+	}
+	decoded := clampInt16(predicted + code*s.delta)
+	s.sample2 = s.sample1
+	s.sample1 = decoded
+	nibble := byte(code) & 0xF
+	s.delta = wavMSAdaptationTable[nibble] * s.delta >> 8
+	if s.delta < wavMSMinDelta {
+		s.delta = wavMSMinDelta
+	}
+	return nibble
+}
+
+func (e *wavMSEncoder) encode(samples [][]int16) []byte {
+	return e.blocks(samples, e.encodeBlock)
+}
+
+func (e *wavMSEncoder) flush() []byte {
+	return e.flushBlock(e.encodeBlock)
+}
+
+func (e *wavMSEncoder) encodeBlock(block [][]int16) []byte {
+	channels := len(block)
+	states := make([]wavMSState, channels)
+	predictors := make([]int, channels)
+	for c, s := range block {
+		// the predictor with the smallest error over the block is used for the channel
+		bestErr := math.Inf(1)
+		for p := range wavMSCoefficients {
+			state := newWavMSState(p, s)
+			trial := state
+			var sum float64
+			for _, v := range s[2:] {
+				trial.predict(v)
+				d := float64(trial.sample1 - int32(v))
+				sum += d * d
+			}
+			if sum < bestErr {
+				bestErr = sum
+				predictors[c] = p
+				states[c] = state
+			}
+		}
+	}
+
+	out := make([]byte, wavMSHeaderSize*channels, e.blockAlign)
+	for c := range block {
+		out[c] = byte(predictors[c])                                                          // Predictor
+		binary.LittleEndian.PutUint16(out[channels+c*2:], uint16(int16(states[c].delta)))     // Delta
+		binary.LittleEndian.PutUint16(out[3*channels+c*2:], uint16(int16(states[c].sample1))) // Sample1
+		binary.LittleEndian.PutUint16(out[5*channels+c*2:], uint16(int16(states[c].sample2))) // Sample2
+	}
+	// the samples are interleaved, with the earlier nibble in the high bits
+	high := true
+	for i := 2; i < e.samplesPerBlock; i++ {
+		for c, s := range block {
+			nibble := states[c].predict(s[i])
+			if high {
+				out = append(out, nibble<<4)
+			} else {
+				out[len(out)-1] |= nibble
+			}
+			high = !high
+		}
+	}
+	return out
+}
+
+// newWavMSState returns the state of a channel at the start of a block, using the predictor p,
+// where the first two samples are held in the header as is
+func newWavMSState(p int, samples []int16) wavMSState {
+	// the initial step size follows the size of the first prediction error
+	predicted := (int32(samples[1])*wavMSCoefficients[p][0] + int32(samples[0])*wavMSCoefficients[p][1]) >> 8
+	delta := int32(0)
+	if len(samples) > 2 {
+		delta = (int32(samples[2]) - predicted) / 4
+		if delta < 0 {
+			delta = -delta
+		}
+	}
+	if delta < wavMSMinDelta {
+		delta = wavMSMinDelta
+	}
+	return wavMSState{
+		coef1:   wavMSCoefficients[p][0],
+		coef2:   wavMSCoefficients[p][1],
+		delta:   delta,
+		sample1: int32(samples[1]),
+		sample2: int32(samples[0]),
+	}
+}
+
+// clampInt16 limits v to the range of a 16-bit sample
+func clampInt16(v int32) int32 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testDecodeIMA decodes IMA ADPCM blocks, one slice per channel
+func testDecodeIMA(data []byte, channels int, blockAlign int, samplesPerBlock int) [][]int16 {
+	out := make([][]int16, channels)
+	for ; len(data) >= blockAlign; data = data[blockAlign:] {
+		predictor := make([]int32, channels)
+		index := make([]int, channels)
+		for c := range out {
+			predictor[c] = int32(int16(binary.LittleEndian.Uint16(data[c*wavIMAHeaderSize:])))
+			index[c] = int(data[c*wavIMAHeaderSize+2])
+			out[c] = append(out[c], int16(predictor[c]))
+		}
+		decode := func(c int, code byte) {
+			step := wavIMAStepTable[index[c]]
+			delta := step >> 3
+			if code&4 != 0 {
+				delta += step
+			}
+			if code&2 != 0 {
+				delta += step >> 1
+			}
+			if code&1 != 0 {
+				delta += step >> 2
+			}
+			if code&8 != 0 {
+				delta = -delta
+			}
+			predictor[c] = clampInt16(predictor[c] + delta)
+			index[c] += wavIMAIndexTable[code]
+			if index[c] < 0 {
+				index[c] = 0
+			} else if index[c] >= len(wavIMAStepTable) {
+				index[c] = len(wavIMAStepTable) - 1
+			}
+			out[c] = append(out[c], int16(predictor[c]))
+		}
+		pos := wavIMAHeaderSize * channels
+		for i := 1; i < samplesPerBlock; i += 8 {
+			for c := range out {
+				for _, b := range data[pos : pos+4] {
+					decode(c, b&0xF)
+					decode(c, b>>4)
+				}
+				pos += 4
+			}
+		}
+	}
+	return out
+}
+
+// testDecodeMS decodes Microsoft ADPCM blocks, one slice per channel
+func testDecodeMS(data []byte, channels int, blockAlign int, samplesPerBlock int) [][]int16 {
+	out := make([][]int16, channels)
+	for ; len(data) >= blockAlign; data = data[blockAlign:] {
+		states := make([]wavMSState, channels)
+		for c := range states {
+			p := wavMSCoefficients[data[c]]
+			states[c] = wavMSState{
+				coef1:   p[0],
+				coef2:   p[1],
+				delta:   int32(int16(binary.LittleEndian.Uint16(data[channels+c*2:]))),
+				sample1: int32(int16(binary.LittleEndian.Uint16(data[3*channels+c*2:]))),
+				sample2: int32(int16(binary.LittleEndian.Uint16(data[5*channels+c*2:]))),
+			}
+			out[c] = append(out[c], int16(states[c].sample2), int16(states[c].sample1))
+		}
+		c := 0
+		for _, b := range data[wavMSHeaderSize*channels : wavMSHeaderSize*channels+(samplesPerBlock-2)*channels/2] {
+			for _, nibble := range []byte{b >> 4, b & 0xF} {
+				s := &states[c]
+				code := int32(nibble)
+				if code >= 8 {
+					code -= 16
+				}
+				predicted := (s.sample1*s.coef1 + s.sample2*s.coef2) >> 8
+				s.sample2 = s.sample1
+				s.sample1 = clampInt16(predicted + code*s.delta)
+				s.delta = wavMSAdaptationTable[nibble] * s.delta >> 8
+				if s.delta < wavMSMinDelta {
+					s.delta = wavMSMinDelta
+				}
+				out[c] = append(out[c], int16(s.sample1))
+				c = (c + 1) % channels
+			}
+		}
+	}
+	return out
+}
+
+func TestWavADPCM(t *testing.T) {
+	rows := testMarked(testSignal(2, testRows, testRowLen, testSampleRate))
+	for _, tc := range []struct {
+		name     string
+		encoding WavEncoding
+		format   uint16
+		decode   func([]byte, int, int, int) [][]int16
+	}{
+		{"IMA ADPCM", WavEncodingIMAADPCM, wavFormatIMAADPCM, testDecodeIMA},
+		{"Microsoft ADPCM", WavEncodingMSADPCM, wavFormatMSADPCM, testDecodeMS},
+	} {
+		for _, channels := range []int{1, 2} {
+			s := Settings{Channels: channels, Markers: true}
+			capture := testCapture(t, s, rows)
+			want := capture.Float32()
+			frames := len(want[0])
+			s.Options = &WavOptions{Encoding: tc.encoding}
+			chunks := testRiffChunks(t, testRenderFile(t, "wav", s, rows))
+
+			fmtBody := testFindChunk(t, chunks, "fmt ")
+			if f := binary.LittleEndian.Uint16(fmtBody[0:]); f != tc.format {
+				t.Fatalf("%s: format %#x, want %#x", tc.name, f, tc.format)
+			}
+			blockAlign := int(binary.LittleEndian.Uint16(fmtBody[12:]))
+			samplesPerBlock := int(binary.LittleEndian.Uint16(fmtBody[wavFmtSizeEx:]))
+			if blockAlign != wavADPCMBlockSize*channels*4 {
+				t.Errorf("%s, %d channels: block align %d", tc.name, channels, blockAlign)
+			}
+			if n := binary.LittleEndian.Uint32(testFindChunk(t, chunks, "fact")); int(n) != frames {
+				t.Errorf("%s, %d channels: fact chunk holds %d sample frames, want %d", tc.name, channels, n, frames)
+			}
+
+			data := testFindChunk(t, chunks, "data")
+			blocks := (frames + samplesPerBlock - 1) / samplesPerBlock
+			if len(data) != blocks*blockAlign {
+				t.Fatalf("%s, %d channels: %d bytes of data, want %d blocks of %d", tc.name, channels, len(data), blocks, blockAlign)
+			}
+			decoded := tc.decode(data, channels, blockAlign, samplesPerBlock)
+			got := make([][]float32, channels)
+			for c, samples := range decoded {
+				if len(samples) != blocks*samplesPerBlock {
+					t.Fatalf("%s, %d channels: decoded %d samples", tc.name, channels, len(samples))
+				}
+				for _, v := range samples[:frames] {
+					got[c] = append(got[c], float32(v)/32768)
+				}
+			}
+			if snr := testSNR(want, got); snr < 30 {
+				t.Errorf("%s, %d channels: SNR %.1f dB", tc.name, channels, snr)
+			}
+
+			// each cue point refers to the block holding its frame
+			cue := testFindChunk(t, chunks, "cue ")
+			if n := binary.LittleEndian.Uint32(cue); n != 4 {
+				t.Fatalf("%s: %d cue points, want 4", tc.name, n)
+			}
+			for i := 0; i < 4; i++ {
+				p := cue[4+i*wavCuePointSize:]
+				position := binary.LittleEndian.Uint32(p[4:])
+				blockStart := binary.LittleEndian.Uint32(p[16:])
+				offset := binary.LittleEndian.Uint32(p[20:])
+				if position != uint32(i*50*testRowLen) || blockStart%uint32(blockAlign) != 0 || int(offset) >= samplesPerBlock ||
+					blockStart/uint32(blockAlign)*uint32(samplesPerBlock)+offset != position {
+					t.Errorf("%s: cue point at %d has block start %d, offset %d", tc.name, position, blockStart, offset)
+				}
+			}
+			if got := testWavMarkers(t, chunks); !reflect.DeepEqual(got, testMarkers(testRows)) {
+				t.Errorf("%s: markers %+v", tc.name, got)
+			}
+		}
+	}
+}
+
+func TestWavG711(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	want := testCapture(t, Settings{}, rows).Float32()
+	for _, tc := range []struct {
+		name     string
+		encoding WavEncoding
+		format   uint16
+		expand   func(byte) int16
+	}{
+		{"μ-law", WavEncodingMuLaw, wavFormatMuLaw, testMuLawToLinear},
+		{"A-law", WavEncodingALaw, wavFormatALaw, testALawToLinear},
+	} {
+		chunks := testRiffChunks(t, testRenderFile(t, "wav", Settings{Options: &WavOptions{Encoding: tc.encoding}}, rows))
+		if f := binary.LittleEndian.Uint16(testFindChunk(t, chunks, "fmt ")); f != tc.format {
+			t.Fatalf("%s: format %#x, want %#x", tc.name, f, tc.format)
+		}
+		if n := binary.LittleEndian.Uint32(testFindChunk(t, chunks, "fact")); int(n) != len(want[0]) {
+			t.Errorf("%s: fact chunk holds %d sample frames", tc.name, n)
+		}
+		data := testFindChunk(t, chunks, "data")
+		if len(data) != 2*len(want[0]) {
+			t.Fatalf("%s: %d bytes of data", tc.name, len(data))
+		}
+		got := make([][]float32, 2)
+		for i, v := range data {
+			got[i%2] = append(got[i%2], float32(tc.expand(v))/32768)
+		}
+		if snr := testSNR(want, got); snr < 30 {
+			t.Errorf("%s: SNR %.1f dB", tc.name, snr)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// WavBroadcast is the content of a Broadcast Wave Format bext chunk
+type WavBroadcast struct {
+	// Description is a free-form description of the audio (up to 256 characters);
+	// when empty, Metadata.Comment is used
+	Description string
+	// Originator is the name of the originator (up to 32 characters)
+	Originator string
+	// OriginatorReference is a unique reference assigned by the originator (up to 32 characters)
+	OriginatorReference string
+	// OriginationTime is the time the audio was created; when zero, the time the file is created is used
+	OriginationTime time.Time
+	// TimeReference is the position of the first sample, in samples since midnight
+	TimeReference uint64
+}
+
+const (
+	wavSoftware = "gosound"
+
+	wavBextVersion = 1
+	// wavBextSize is the size of the bext chunk body, without a coding history
+	wavBextSize = 602
+	// wavID3Padding is the padding left in the id3 chunk so tags can be edited later
+	wavID3Padding = 1024
+)
+
+// wavInfoIDs maps the well-known tag names to their LIST/INFO chunk IDs
+var wavInfoIDs = map[string]string{
+	"GENRE":       "IGNR",
+	"DATE":        "ICRD",
+	"COPYRIGHT":   "ICOP",
+	"ENGINEER":    "IENG",
+	"KEYWORDS":    "IKEY",
+	"SUBJECT":     "ISBJ",
+	"TRACKNUMBER": "ITRK",
+}
+
+// writeWavChunk writes a chunk, padded to an even size, returning the number of bytes written
+func writeWavChunk(w io.Writer, id string, body []byte) (int64, error) {
+	if _, err := w.Write([]byte(id)); err != nil { // ChunkID
+		return 0, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(body))); err != nil { // ChunkSize
+		return 0, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return 0, err
+	}
+	n := int64(8 + len(body))
+	if len(body)&1 != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// wavInfoList returns the body of a LIST chunk of type INFO holding the metadata.
+// Tags with neither a well-known name nor an INFO ID (e.g.: "IMED") as their name
+// are not written.
+func wavInfoList(m Metadata) []byte {
+	var b bytes.Buffer
+	b.WriteString("INFO")
+	writeInfo := func(id string, value string) {
+		if value == "" {
+			return
+		}
+		// values are NUL terminated, and padded to an even size
+		_, _ = writeWavChunk(&b, id, append([]byte(value), 0))
+	}
+	writeInfo("INAM", m.Title)
+	writeInfo("IART", m.Artist)
+	writeInfo("IPRD", m.Album)
+	writeInfo("ICMT", m.Comment)
+	for _, name := range m.tagNames() {
+		id, ok := wavInfoIDs[name]
+		if !ok && len(name) == 4 && strings.HasPrefix(name, "I") && strings.ToUpper(name) == name {
+			id, ok = name, true
+		}
+		if ok {
+			writeInfo(id, m.Tags[name])
+		}
+	}
+	writeInfo("ISFT", wavSoftware)
+	return b.Bytes()
+}
+
+// wavBext returns the body of a bext chunk
+func wavBext(bc *WavBroadcast, m Metadata, now time.Time) []byte {
+	b := make([]byte, wavBextSize)
+	description := bc.Description
+	if description == "" {
+		description = m.Comment
+	}
+	t := bc.OriginationTime
+	if t.IsZero() {
+		t = now
+	}
+	copy(b[0:256], description)                                       // Description
+	copy(b[256:288], bc.Originator)                                   // Originator
+	copy(b[288:320], bc.OriginatorReference)                          // OriginatorReference
+	copy(b[320:330], t.Format("2006-01-02"))                          // OriginationDate
+	copy(b[330:338], t.Format("15:04:05"))                            // OriginationTime
+	binary.LittleEndian.PutUint64(b[338:346], bc.TimeReference)       // TimeReferenceLow, TimeReferenceHigh
+	binary.LittleEndian.PutUint16(b[346:348], uint16(wavBextVersion)) // Version
+	// UMID, loudness and reserved fields are left empty
+	return b
+}
+
+// wavCuePointSize is the size of each point in the cue chunk
+const wavCuePointSize = 24
+
+// wavCue returns the body of a cue chunk holding a point per marker, identified by its index + 1.
+// When the data is encoded in blocks of samplesPerBlock sample frames and blockAlign bytes, each
+// point refers to the block holding its frame; otherwise samplesPerBlock is 0.
+// Markers beyond the reach of a 32-bit sample offset are not written.
+func wavCue(markers []marker, samplesPerBlock int, blockAlign int) []byte {
+	b := make([]byte, 4, 4+len(markers)*wavCuePointSize)
+	count := 0
+	for i, m := range markers {
+		if m.Frame > math.MaxUint32 {
+			break
+		}
+		// BlockStart is 0 for uncompressed data, where the offset is from the start of the data
+		blockStart, offset := uint64(0), m.Frame
+		if samplesPerBlock > 0 {
+			block := m.Frame / uint64(samplesPerBlock)
+			blockStart, offset = block*uint64(blockAlign), m.Frame%uint64(samplesPerBlock)
+			if blockStart > math.MaxUint32 {
+				break
+			}
+		}
+		var p [wavCuePointSize]byte
+		binary.LittleEndian.PutUint32(p[0:], uint32(i+1))     // ID
+		binary.LittleEndian.PutUint32(p[4:], uint32(m.Frame)) // Position
+		copy(p[8:12], "data")                                 // DataChunkID
+		// ChunkStart is 0, as there is a single data chunk
+		binary.LittleEndian.PutUint32(p[16:], uint32(blockStart)) // BlockStart
+		binary.LittleEndian.PutUint32(p[20:], uint32(offset))     // SampleOffset
+		b = append(b, p[:]...)
+		count++
+	}
+	binary.LittleEndian.PutUint32(b[0:], uint32(count)) // NumCuePoints
+	return b
+}
+
+// wavAdtlList returns the body of a LIST chunk of type adtl holding the labels of the cue points
+func wavAdtlList(markers []marker) []byte {
+	var b bytes.Buffer
+	b.WriteString("adtl")
+	for i, m := range markers {
+		if m.Frame > math.MaxUint32 {
+			break
+		}
+		if m.Label == "" {
+			continue
+		}
+		body := make([]byte, 4, 4+len(m.Label)+1)
+		binary.LittleEndian.PutUint32(body, uint32(i+1)) // CuePointID
+		body = append(body, m.Label...)
+		_, _ = writeWavChunk(&b, "labl", append(body, 0))
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,150 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSynchsafe returns the value of a 28-bit synchsafe integer
+func testSynchsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// testWavInfoFile renders a WAV file with metadata, a bext chunk and an id3 chunk, returning its chunks
+func testWavInfoFile(t *testing.T) []testChunk {
+	t.Helper()
+	rows := testSignal(2, 5, testRowLen, testSampleRate)
+	when := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	s := Settings{
+		Metadata: Metadata{
+			Title:   "tones",
+			Artist:  "someone ♪",
+			Album:   "album",
+			Comment: "a comment",
+			// MOOD has neither a well-known name nor an INFO ID, so it is left out of the INFO list
+			Tags: map[string]string{"GENRE": "chiptune", "IMED": "disk", "MOOD": "calm"},
+		},
+		Options: &WavOptions{
+			ID3:       true,
+			Broadcast: &WavBroadcast{Originator: "gosound tests", OriginationTime: when, TimeReference: 1 << 33},
+		},
+	}
+	chunks := testRiffChunks(t, testRenderFile(t, "wav", s, rows))
+	var ids []string
+	for _, c := range chunks {
+		ids = append(ids, c.id)
+	}
+	if want := []string{"JUNK", "fmt ", "bext", "LIST", "id3 ", "data"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("chunks %q, want %q", ids, want)
+	}
+	return chunks
+}
+
+func TestWavInfoList(t *testing.T) {
+	chunks := testWavInfoFile(t)
+	list := testFindChunk(t, chunks, "LIST")
+	if string(list[:4]) != "INFO" {
+		t.Fatalf("LIST chunk of type %q", list[:4])
+	}
+	var got [][2]string
+	for pos := 4; pos < len(list); {
+		size := int(binary.LittleEndian.Uint32(list[pos+4:]))
+		value := list[pos+8 : pos+8+size]
+		if value[size-1] != 0 {
+			t.Fatalf("%q value %q not NUL terminated", list[pos:pos+4], value)
+		}
+		got = append(got, [2]string{string(list[pos : pos+4]), string(value[:size-1])})
+		pos += 8 + size + size&1
+	}
+	want := [][2]string{
+		{"INAM", "tones"},
+		{"IART", "someone ♪"},
+		{"IPRD", "album"},
+		{"ICMT", "a comment"},
+		{"IGNR", "chiptune"},
+		{"IMED", "disk"},
+		{"ISFT", wavSoftware},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("INFO %q, want %q", got, want)
+	}
+}
+
+func TestWavBext(t *testing.T) {
+	chunks := testWavInfoFile(t)
+	b := testFindChunk(t, chunks, "bext")
+	if len(b) != wavBextSize {
+		t.Fatalf("bext chunk of %d bytes", len(b))
+	}
+	field := func(from, to int) string {
+		return string(bytes.TrimRight(b[from:to], "\x00"))
+	}
+	// the comment stands in for the description
+	if got := field(0, 256); got != "a comment" {
+		t.Errorf("description %q", got)
+	}
+	if got := field(256, 288); got != "gosound tests" {
+		t.Errorf("originator %q", got)
+	}
+	if got := field(288, 320); got != "" {
+		t.Errorf("originator reference %q", got)
+	}
+	if date, clock := field(320, 330), field(330, 338); date != "2021-03-04" || clock != "05:06:07" {
+		t.Errorf("origination %q %q", date, clock)
+	}
+	if ref := binary.LittleEndian.Uint64(b[338:]); ref != 1<<33 {
+		t.Errorf("time reference %d", ref)
+	}
+	if v := binary.LittleEndian.Uint16(b[346:]); v != wavBextVersion {
+		t.Errorf("version %d", v)
+	}
+}
+
+func TestWavID3(t *testing.T) {
+	chunks := testWavInfoFile(t)
+	tag := testFindChunk(t, chunks, "id3 ")
+	if string(tag[:3]) != "ID3" || tag[3] != 3 || tag[4] != 0 || tag[5] != 0 {
+		t.Fatalf("ID3 header %x", tag[:6])
+	}
+	if size := testSynchsafe(tag[6:]); size != len(tag)-id3v2HeaderSize {
+		t.Fatalf("ID3 tag size %d, want %d", size, len(tag)-id3v2HeaderSize)
+	}
+	var got [][2]string
+	pos := id3v2HeaderSize
+	for pos < len(tag) && tag[pos] != 0 {
+		size := int(binary.BigEndian.Uint32(tag[pos+4:]))
+		got = append(got, [2]string{string(tag[pos : pos+4]), string(tag[pos+10 : pos+10+size])})
+		pos += 10 + size
+	}
+	// the frames are followed by the padding
+	if padding := tag[pos:]; len(padding) != wavID3Padding || !bytes.Equal(padding, make([]byte, wavID3Padding)) {
+		t.Fatalf("%d bytes of padding after the frames", len(padding))
+	}
+	want := [][2]string{
+		{"TIT2", "\x00tones"},
+		// text outside of Latin-1 is written as UTF-16, with a byte order mark
+		{"TPE1", "\x01\xff\xfes\x00o\x00m\x00e\x00o\x00n\x00e\x00 \x00\x6a\x26"},
+		{"TALB", "\x00album"},
+		{"COMM", "\x00eng\x00a comment"},
+		{"TCON", "\x00chiptune"},
+		{"TXXX", "\x00IMED\x00disk"},
+		{"TXXX", "\x00MOOD\x00calm"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ID3 frames %q, want %q", got, want)
+	}
+}
+
+func TestWavInfoOptions(t *testing.T) {
+	rows := testSignal(2, 5, testRowLen, testSampleRate)
+	s := Settings{Metadata: Metadata{Title: "tones"}}
+	// without the options, only the INFO list is written
+	for _, c := range testRiffChunks(t, testRenderFile(t, "wav", s, rows)) {
+		if c.id == "bext" || c.id == "id3 " {
+			t.Fatalf("%q chunk written without its option", c.id)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package gosound
+
+import "encoding/binary"
+
+// WavLoopType is the playback direction of a sampler loop
+type WavLoopType int
+
+const (
+	// WavLoopNone writes no loop
+	WavLoopNone = WavLoopType(iota)
+	// WavLoopForward loops from the start to the end
+	WavLoopForward
+	// WavLoopPingPong alternates between looping forward and backward
+	WavLoopPingPong
+	// WavLoopBackward loops from the end to the start
+	WavLoopBackward
+)
+
+// WavSampler is the content of a smpl chunk, which tells samplers how to play the file
+type WavSampler struct {
+	// UnityNote is the MIDI note that plays the audio at its original pitch; when 0, 60 (middle C)
+	// is used, and WavUnityNoteC1 requests note 0 (C-1)
+	UnityNote int
+	// LoopType is the playback direction of the loop
+	LoopType WavLoopType
+	// LoopStart is the first sample frame of the loop
+	LoopStart uint64
+	// LoopEnd is the sample frame after the end of the loop; when 0, the loop ends with the audio
+	LoopEnd uint64
+}
+
+// WavUnityNoteC1 is the WavSampler.UnityNote requesting MIDI note 0 (C-1), as 0 selects middle C
+const WavUnityNoteC1 = -1
+
+// NewWavSampler returns sampler details without a loop, with middle C as the unity note
+func NewWavSampler() *WavSampler {
+	return &WavSampler{UnityNote: wavDefaultUnityNote}
+}
+
+// WavSamplerSource is implemented by PremixData.Userdata to supply the smpl chunk;
+// the sampler details of the last row that supplies them are written on Close
+type WavSamplerSource interface {
+	WavSampler() *WavSampler
+}
+
+const (
+	wavSmplSize     = 36
+	wavSmplLoopSize = 24
+
+	wavDefaultUnityNote = 60
+)
+
+// wavSmpl returns the body of a smpl chunk for audio of the provided length, in sample frames
+func wavSmpl(s *WavSampler, frames uint64, samplesPerSecond int) []byte {
+	unityNote := s.UnityNote
+	switch {
+	case unityNote == 0:
+		unityNote = wavDefaultUnityNote
+	case unityNote < 0:
+		unityNote = 0
+	}
+	b := make([]byte, wavSmplSize, wavSmplSize+wavSmplLoopSize)
+	// the manufacturer and product are left empty
+	binary.LittleEndian.PutUint32(b[8:], uint32(1000000000/samplesPerSecond)) // SamplePeriod
+	binary.LittleEndian.PutUint32(b[12:], uint32(unityNote))                  // MIDIUnityNote
+	// the pitch fraction and SMPTE offset are left empty
+
+	end := s.LoopEnd
+	if end == 0 || end > frames {
+		end = frames
+	}
+	if s.LoopType == WavLoopNone || s.LoopStart >= end {
+		return b
+	}
+	binary.LittleEndian.PutUint32(b[28:], 1) // NumSampleLoops
+	loop := make([]byte, wavSmplLoopSize)
+	// the loop is not tied to a cue point
+	binary.LittleEndian.PutUint32(loop[4:], uint32(s.LoopType-WavLoopForward)) // Type
+	binary.LittleEndian.PutUint32(loop[8:], uint32(s.LoopStart))               // Start
+	binary.LittleEndian.PutUint32(loop[12:], uint32(end-1))                    // End (inclusive)
+	// the loop has no fraction, and plays forever
+	return append(b, loop...)
+}
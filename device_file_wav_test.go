@@ -0,0 +1,275 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"reflect"
+	"testing"
+)
+
+// testChunk is a chunk of a RIFF file
+type testChunk struct {
+	id   string
+	body []byte
+}
+
+// testRiffChunks checks the RIFF header of a WAV file, returning its chunks
+func testRiffChunks(t *testing.T, b []byte) []testChunk {
+	t.Helper()
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		t.Fatal("no RIFF WAVE header")
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("RIFF size %d, want %d", size, len(b)-8)
+	}
+	var chunks []testChunk
+	for pos := 12; pos < len(b); {
+		if pos+8 > len(b) {
+			t.Fatalf("truncated chunk header at %d", pos)
+		}
+		id := string(b[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(b[pos+4:]))
+		if pos+8+size > len(b) {
+			t.Fatalf("%q chunk of %d bytes overruns the file", id, size)
+		}
+		chunks = append(chunks, testChunk{id: id, body: b[pos+8 : pos+8+size]})
+		pos += 8 + size + size&1
+	}
+	return chunks
+}
+
+// testFindChunk returns the body of the first chunk with the ID
+func testFindChunk(t *testing.T, chunks []testChunk, id string) []byte {
+	t.Helper()
+	for _, c := range chunks {
+		if c.id == id {
+			return c.body
+		}
+	}
+	t.Fatalf("no %q chunk", id)
+	return nil
+}
+
+func TestWavSmpl(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	frames := uint32(20 * testRowLen)
+	for _, tc := range []struct {
+		name    string
+		sampler *WavSampler
+		note    uint32
+		loop    bool
+	}{
+		{"default", NewWavSampler(), 60, false},
+		// a sampler built as a literal gets the default note too
+		{"literal", &WavSampler{LoopType: WavLoopForward, LoopStart: 100}, 60, true},
+		{"lowest note", &WavSampler{UnityNote: WavUnityNoteC1}, 0, false},
+		{"loop", &WavSampler{UnityNote: 72, LoopType: WavLoopForward, LoopStart: 100}, 72, true},
+	} {
+		b := testRenderFile(t, "wav", Settings{Options: &WavOptions{Sampler: tc.sampler}}, rows)
+		smpl := testFindChunk(t, testRiffChunks(t, b), "smpl")
+		if note := binary.LittleEndian.Uint32(smpl[12:]); note != tc.note {
+			t.Errorf("%s: unity note %d, want %d", tc.name, note, tc.note)
+		}
+		loops := binary.LittleEndian.Uint32(smpl[28:])
+		if !tc.loop {
+			if loops != 0 || len(smpl) != wavSmplSize {
+				t.Errorf("%s: %d loops written", tc.name, loops)
+			}
+			continue
+		}
+		if loops != 1 || len(smpl) != wavSmplSize+wavSmplLoopSize {
+			t.Fatalf("%s: %d loops written", tc.name, loops)
+		}
+		loop := smpl[wavSmplSize:]
+		if start, end := binary.LittleEndian.Uint32(loop[8:]), binary.LittleEndian.Uint32(loop[12:]); start != 100 || end != frames-1 {
+			t.Errorf("%s: loop %d-%d, want %d-%d", tc.name, start, end, 100, frames-1)
+		}
+	}
+}
+
+func TestWavRoundTrip(t *testing.T) {
+	rows := testMarked(testSignal(2, 101, testRowLen, testSampleRate))
+	for _, s := range []Settings{
+		{Channels: 1, BitsPerSample: 16},
+		{Channels: 2, BitsPerSample: 16},
+		{Channels: 2, BitsPerSample: 24},
+		{Channels: 4, BitsPerSample: 16},
+	} {
+		s.Markers = true
+		want := testCapture(t, s, rows).Samples()
+		chunks := testRiffChunks(t, testRenderFile(t, "wav", s, rows))
+		if chunks[0].id != "JUNK" || len(chunks[0].body) != wavDs64Size {
+			t.Fatalf("%+v: no JUNK chunk reserved for ds64", s)
+		}
+		format := sampleFormatForBits(s.BitsPerSample)
+		if body := testFindChunk(t, chunks, "fmt "); !bytes.Equal(body, wavFmt(s.Channels, testSampleRate, format)) {
+			t.Fatalf("%+v: fmt chunk %x", s, body)
+		}
+		got := testDecodeInts(testFindChunk(t, chunks, "data"), s.Channels, format, binary.LittleEndian)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%+v: samples differ", s)
+		}
+
+		// uncompressed cue points are offsets from the start of the data
+		cue := testFindChunk(t, chunks, "cue ")
+		if n := binary.LittleEndian.Uint32(cue); n != 3 {
+			t.Fatalf("%+v: %d cue points, want 3", s, n)
+		}
+		for i := 0; i < 3; i++ {
+			p := cue[4+i*wavCuePointSize:]
+			position := binary.LittleEndian.Uint32(p[4:])
+			if position != uint32(i*50*testRowLen) || binary.LittleEndian.Uint32(p[16:]) != 0 || binary.LittleEndian.Uint32(p[20:]) != position {
+				t.Errorf("%+v: cue point %x", s, p[:wavCuePointSize])
+			}
+		}
+	}
+}
+
+func TestWavFmt(t *testing.T) {
+	rows := testSignal(2, 5, testRowLen, testSampleRate)
+	for _, tc := range []struct {
+		channels  int
+		format    SampleFormat
+		tag       uint16
+		container uint16
+		mask      uint32
+		subFormat [16]byte
+	}{
+		// mono and stereo up to 16 bits, and float, have no extensible header
+		{1, SampleFormatInt16, wavFormatPCM, 16, 0, [16]byte{}},
+		{2, SampleFormatInt8, wavFormatPCM, 8, 0, [16]byte{}},
+		{2, SampleFormatFloat32, wavFormatIEEEFloat, 32, 0, [16]byte{}},
+		// more than 16 bits, or more than 2 channels, need one
+		{2, SampleFormatInt24, wavFormatExtensible, 24, 0x3, wavSubFormatPCM},
+		{2, SampleFormatInt32, wavFormatExtensible, 32, 0x3, wavSubFormatPCM},
+		{4, SampleFormatInt16, wavFormatExtensible, 16, 0x33, wavSubFormatPCM},
+		{4, SampleFormatFloat32, wavFormatExtensible, 32, 0x33, wavSubFormatIEEEFloat},
+		{1, SampleFormatInt24, wavFormatExtensible, 24, 0x4, wavSubFormatPCM},
+	} {
+		s := Settings{Channels: tc.channels, SampleFormat: tc.format}
+		b := testFindChunk(t, testRiffChunks(t, testRenderFile(t, "wav", s, rows)), "fmt ")
+		if len(b) < 16 {
+			t.Fatalf("%d channels of %v: fmt chunk of %d bytes", tc.channels, tc.format, len(b))
+		}
+		blockAlign := tc.channels * int(tc.container) / 8
+		if tag := binary.LittleEndian.Uint16(b); tag != tc.tag ||
+			int(binary.LittleEndian.Uint16(b[2:])) != tc.channels ||
+			binary.LittleEndian.Uint32(b[4:]) != testSampleRate ||
+			int(binary.LittleEndian.Uint32(b[8:])) != testSampleRate*blockAlign ||
+			int(binary.LittleEndian.Uint16(b[12:])) != blockAlign ||
+			binary.LittleEndian.Uint16(b[14:]) != tc.container {
+			t.Fatalf("%d channels of %v: fmt chunk %x", tc.channels, tc.format, b)
+		}
+		switch tc.tag {
+		case wavFormatPCM:
+			if len(b) != 16 {
+				t.Fatalf("%d channels of %v: PCM fmt chunk of %d bytes", tc.channels, tc.format, len(b))
+			}
+		case wavFormatIEEEFloat:
+			if len(b) != 18 || binary.LittleEndian.Uint16(b[16:]) != 0 {
+				t.Fatalf("%d channels of %v: float fmt chunk %x", tc.channels, tc.format, b)
+			}
+		case wavFormatExtensible:
+			if len(b) != 40 || binary.LittleEndian.Uint16(b[16:]) != 22 {
+				t.Fatalf("%d channels of %v: extensible fmt chunk of %d bytes", tc.channels, tc.format, len(b))
+			}
+			if valid := binary.LittleEndian.Uint16(b[18:]); int(valid) != tc.format.BitsPerSample() {
+				t.Errorf("%d channels of %v: %d valid bits", tc.channels, tc.format, valid)
+			}
+			if mask := binary.LittleEndian.Uint32(b[20:]); mask != tc.mask {
+				t.Errorf("%d channels of %v: channel mask %#x, want %#x", tc.channels, tc.format, mask, tc.mask)
+			}
+			if !bytes.Equal(b[24:], tc.subFormat[:]) {
+				t.Errorf("%d channels of %v: sub-format %x", tc.channels, tc.format, b[24:])
+			}
+		}
+	}
+
+	// every channel count the mixer may support has a speaker for each channel
+	for c := 1; c <= len(wavChannelMasks); c++ {
+		if n := bits.OnesCount32(wavChannelMask(c)); n != c {
+			t.Errorf("%d channels: channel mask %#x of %d speakers", c, wavChannelMask(c), n)
+		}
+	}
+}
+
+func TestWavFloat(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	chunks := testRiffChunks(t, testRenderFile(t, "wav", Settings{SampleFormat: SampleFormatFloat32}, rows))
+	if n := binary.LittleEndian.Uint32(testFindChunk(t, chunks, "fact")); n != 20*testRowLen {
+		t.Fatalf("fact chunk holds %d sample frames, want %d", n, 20*testRowLen)
+	}
+	if n := len(testFindChunk(t, chunks, "data")); n != 20*testRowLen*2*4 {
+		t.Fatalf("%d bytes of data", n)
+	}
+}
+
+func TestWavNotSeekable(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	b := testRenderStream(t, "wav", Settings{}, rows)
+	if size := binary.LittleEndian.Uint32(b[wavFileChunkSizePos:]); size != wavStreamingSize {
+		t.Fatalf("RIFF size %d written to a stream that cannot seek", size)
+	}
+}
+
+func TestWavRF64(t *testing.T) {
+	defer func(size uint64) { wavMaxRiffSize = size }(wavMaxRiffSize)
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	s := Settings{SampleFormat: SampleFormatFloat32}
+	frames := uint64(20 * testRowLen)
+	dataSize := frames * 2 * 4
+	riffSize := uint64(len(testRenderFile(t, "wav", s, rows)) - 8)
+
+	// a file of the largest size allowed stays RIFF
+	wavMaxRiffSize = riffSize
+	chunks := testRiffChunks(t, testRenderFile(t, "wav", s, rows))
+	if chunks[0].id != "JUNK" {
+		t.Fatalf("%q chunk in place of JUNK", chunks[0].id)
+	}
+
+	wavMaxRiffSize = riffSize - 1
+	b := testRenderFile(t, "wav", s, rows)
+	if string(b[0:4]) != "RF64" || binary.LittleEndian.Uint32(b[4:]) != wavRF64Size || string(b[8:12]) != "WAVE" {
+		t.Fatalf("RF64 header %x", b[:12])
+	}
+	if string(b[12:16]) != "ds64" || binary.LittleEndian.Uint32(b[16:]) != wavDs64Size {
+		t.Fatalf("ds64 header %x", b[12:20])
+	}
+	ds64 := b[20 : 20+wavDs64Size]
+	if size := binary.LittleEndian.Uint64(ds64[0:]); size != riffSize || size != uint64(len(b)-8) {
+		t.Errorf("ds64 RIFF size %d, want %d", size, riffSize)
+	}
+	if size := binary.LittleEndian.Uint64(ds64[8:]); size != dataSize {
+		t.Errorf("ds64 data size %d, want %d", size, dataSize)
+	}
+	if n := binary.LittleEndian.Uint64(ds64[16:]); n != frames {
+		t.Errorf("ds64 sample count %d, want %d", n, frames)
+	}
+	if n := binary.LittleEndian.Uint32(ds64[24:]); n != 0 {
+		t.Errorf("ds64 table of %d entries", n)
+	}
+
+	// the sizes in the other chunks are left to the ds64 chunk
+	seen := map[string]bool{}
+	for pos := 20 + wavDs64Size; pos < len(b); {
+		id := string(b[pos : pos+4])
+		size := uint64(binary.LittleEndian.Uint32(b[pos+4:]))
+		switch id {
+		case "data":
+			if size != wavRF64Size {
+				t.Errorf("data size %d", size)
+			}
+			size = dataSize
+		case "fact":
+			if n := binary.LittleEndian.Uint32(b[pos+8:]); n != wavRF64Size {
+				t.Errorf("fact chunk holds %d sample frames", n)
+			}
+		}
+		seen[id] = true
+		pos += 8 + int(size) + int(size&1)
+	}
+	if !seen["fmt "] || !seen["fact"] || !seen["data"] {
+		t.Fatalf("chunks %v", seen)
+	}
+}
@@ -0,0 +1,172 @@
+package gosound
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+const memoryName = "memory"
+
+// Capture is an interface to devices that keep the audio sent to them
+type Capture interface {
+	// Bytes returns the flattened PCM data, as it would be written to a file
+	Bytes() []byte
+	// Samples returns the flattened sample data, one slice per channel
+	Samples() [][]int32
+	// Float32 returns the flattened sample data normalized to [-1, 1], one slice per channel
+	Float32() [][]float32
+	// Premix returns the premix buffers received, in order
+	Premix() []*PremixData
+	// Reset discards all captured data
+	Reset()
+}
+
+// GetCapture returns the captured audio of the passed in device, if it keeps any
+func GetCapture(d Device) (Capture, bool) {
+	c, ok := d.(Capture)
+	return c, ok
+}
+
+type memoryDevice struct {
+	device
+	mix sampleMixer
+
+	mu      sync.Mutex
+	data    []byte
+	samples [][]int32
+	premix  []*PremixData
+}
+
+func (d *memoryDevice) GetKind() Kind {
+	return KindVirtual
+}
+
+func newMemoryDevice(settings Settings) (Device, error) {
+	d := memoryDevice{
+		device:  newDevice(settings),
+		mix:     newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samples: make([][]int32, settings.Channels),
+	}
+	return &d, nil
+}
+
+// Name returns the device name
+func (d *memoryDevice) Name() string {
+	return memoryName
+}
+
+// Play starts the memory output device capturing
+func (d *memoryDevice) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the memory output device capturing
+func (d *memoryDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		// the row is mixed once; the bytes are encoded from the samples as Flatten would (8-bit left signed)
+		mixedInts := d.mix.FlattenToInts(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		mixedData := encodeSamples(mixedInts, d.mix.Format, binary.LittleEndian)
+
+		d.mu.Lock()
+		d.data = append(d.data, mixedData...)
+		for c := range d.samples {
+			d.samples[c] = append(d.samples[c], mixedInts[c]...)
+		}
+		d.premix = append(d.premix, row)
+		d.mu.Unlock()
+
+		d.frames.addRendered(row.SamplesLen)
+		d.frames.addPlayed(row.SamplesLen)
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindVirtual, row)
+		}
+	}
+}
+
+// Bytes returns the flattened PCM data, as it would be written to a file
+func (d *memoryDevice) Bytes() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.data...)
+}
+
+// Samples returns the flattened sample data, one slice per channel
+func (d *memoryDevice) Samples() [][]int32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([][]int32, len(d.samples))
+	for c, s := range d.samples {
+		out[c] = append([]int32(nil), s...)
+	}
+	return out
+}
+
+// Float32 returns the flattened sample data normalized to [-1, 1], one slice per channel
+func (d *memoryDevice) Float32() [][]float32 {
+	scale := 1 / math.Ldexp(1, d.mix.Format.BitsPerSample()-1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([][]float32, len(d.samples))
+	for c, s := range d.samples {
+		out[c] = make([]float32, len(s))
+		for i, v := range s {
+			out[c][i] = float32(float64(v) * scale)
+		}
+	}
+	return out
+}
+
+// Premix returns the premix buffers received, in order
+func (d *memoryDevice) Premix() []*PremixData {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*PremixData(nil), d.premix...)
+}
+
+// Reset discards all captured data
+func (d *memoryDevice) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data = nil
+	for c := range d.samples {
+		d.samples[c] = nil
+	}
+	d.premix = nil
+}
+
+// Close closes the memory output device
+func (d *memoryDevice) Close() {
+}
+
+func init() {
+	Register(memoryName, KindVirtual, newMemoryDevice,
+		WithDescription("In-memory capture"),
+		WithCapabilities(Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		}))
+}
@@ -0,0 +1,60 @@
+package gosound
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+func TestMemoryCapture(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	for _, format := range []SampleFormat{SampleFormatInt8, SampleFormatInt16, SampleFormatInt24, SampleFormatInt32, SampleFormatFloat32} {
+		c := testCapture(t, Settings{SampleFormat: format}, rows)
+
+		// the bytes are those the mixer flattens the rows to
+		mix := newSampleMixer(2, format)
+		var want []byte
+		for _, row := range rows {
+			want = append(want, mix.Flatten(mixing.GetPanMixer(2), row.SamplesLen, row.Data, row.MixerVolume)...)
+		}
+		if !bytes.Equal(c.Bytes(), want) {
+			t.Fatalf("%v: bytes differ from the flattened mix", format)
+		}
+
+		samples := c.Samples()
+		if len(samples) != 2 || len(samples[0]) != 20*testRowLen || len(samples[1]) != 20*testRowLen {
+			t.Fatalf("%v: samples of %d channels", format, len(samples))
+		}
+		scale := math.Ldexp(1, format.BitsPerSample()-1)
+		floats := c.Float32()
+		var peak float32
+		for ch := range samples {
+			for i, v := range samples[ch] {
+				if f := floats[ch][i]; f != float32(float64(v)/scale) || f < -1 || f > 1 {
+					t.Fatalf("%v: sample %d of channel %d is %d, as a float %v", format, i, ch, v, f)
+				}
+				peak = float32(math.Max(float64(peak), math.Abs(float64(floats[ch][i]))))
+			}
+		}
+		if peak < 0.1 {
+			t.Fatalf("%v: peak of %v", format, peak)
+		}
+
+		premix := c.Premix()
+		if len(premix) != len(rows) {
+			t.Fatalf("%v: %d premix buffers, want %d", format, len(premix), len(rows))
+		}
+		for i := range rows {
+			if premix[i] != rows[i] {
+				t.Fatalf("%v: premix buffer %d out of order", format, i)
+			}
+		}
+
+		c.Reset()
+		if len(c.Bytes()) != 0 || len(c.Samples()[0]) != 0 || len(c.Float32()[1]) != 0 || len(c.Premix()) != 0 {
+			t.Fatalf("%v: data kept after Reset", format)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package gosound
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotracker/gomixing/mixing"
+)
+
+const nullName = "null"
+
+// nullMaxLag is how far behind real time the null device may fall (e.g.: while paused) before it stops catching up
+const nullMaxLag = 100 * time.Millisecond
+
+// NullOptions is the set of options for the null device
+type NullOptions struct {
+	// Realtime paces the consumption of audio to match the sample rate
+	Realtime bool
+}
+
+// ConsumptionCounter is an interface to devices that count the audio they have consumed
+type ConsumptionCounter interface {
+	FramesConsumed() uint64
+	RowsConsumed() uint64
+}
+
+type nullDevice struct {
+	device
+	mix              sampleMixer
+	samplesPerSecond int
+	realtime         bool
+	rowsConsumed     uint64
+}
+
+func (d *nullDevice) GetKind() Kind {
+	return KindVirtual
+}
+
+func newNullDevice(settings Settings) (Device, error) {
+	d := nullDevice{
+		device:           newDevice(settings),
+		mix:              newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+		samplesPerSecond: settings.SamplesPerSecond,
+	}
+	if opts, ok := settings.Options.(*NullOptions); ok && opts != nil {
+		d.realtime = opts.Realtime
+	}
+	if d.realtime && d.samplesPerSecond <= 0 {
+		return nil, errors.New("null device requires a sample rate for realtime pacing")
+	}
+	return &d, nil
+}
+
+// Name returns the device name
+func (d *nullDevice) Name() string {
+	return nullName
+}
+
+// Play starts the null output device consuming
+func (d *nullDevice) Play(in <-chan *PremixData) error {
+	return d.PlayWithCtx(context.Background(), in)
+}
+
+// PlayWithCtx starts the null output device consuming
+func (d *nullDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) error {
+	panmixer := mixing.GetPanMixer(d.mix.Channels)
+	if panmixer == nil {
+		return errors.New("invalid pan mixer - check channel count")
+	}
+
+	myCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var next time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	defer d.ctl.reset()
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+		// the mixed data is discarded, but the mix still happens so the cost is realistic
+		_ = d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		d.frames.addRendered(row.SamplesLen)
+		atomic.AddUint64(&d.rowsConsumed, 1)
+
+		if d.realtime {
+			now := time.Now()
+			if next.Before(now.Add(-nullMaxLag)) {
+				next = now
+			}
+			next = next.Add(framesToDuration(uint64(row.SamplesLen), d.samplesPerSecond))
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(next))
+			select {
+			case <-myCtx.Done():
+				return myCtx.Err()
+			case <-timer.C:
+			}
+		}
+		// the row is output once it has been paced, so the callback keeps time with the audio
+		if d.onRowOutput != nil {
+			d.onRowOutput(KindVirtual, row)
+		}
+		d.frames.addPlayed(row.SamplesLen)
+	}
+}
+
+// FramesConsumed returns the number of frames consumed by the device
+func (d *nullDevice) FramesConsumed() uint64 {
+	return d.frames.renderedFrames()
+}
+
+// RowsConsumed returns the number of premix buffers consumed by the device
+func (d *nullDevice) RowsConsumed() uint64 {
+	return atomic.LoadUint64(&d.rowsConsumed)
+}
+
+// Close closes the null output device
+func (d *nullDevice) Close() {
+}
+
+func init() {
+	Register(nullName, KindVirtual, newNullDevice,
+		WithDescription("Null output (discards audio)"),
+		WithDefaultPriority(0),
+		WithCapabilities(Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: math.MaxInt32,
+			SampleFormats:       allSampleFormats(),
+		}))
+}
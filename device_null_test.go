@@ -0,0 +1,71 @@
+package gosound
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNullCounters(t *testing.T) {
+	rows := testSignal(2, 10, testRowLen, testSampleRate)
+	d, err := CreateOutputDevice(testSettings(Settings{Name: nullName}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Play(testRowChan(rows)); err != nil {
+		t.Fatal(err)
+	}
+	c, ok := d.(ConsumptionCounter)
+	if !ok {
+		t.Fatal("no consumption counters")
+	}
+	if f, r := c.FramesConsumed(), c.RowsConsumed(); f != 10*testRowLen || r != 10 {
+		t.Fatalf("consumed %d frames in %d rows, want %d in 10", f, r, 10*testRowLen)
+	}
+}
+
+func TestNullRealtime(t *testing.T) {
+	// each row is 10ms long
+	const rowCount = 10
+	rows := testSignal(2, rowCount, testRowLen, testSampleRate)
+	var (
+		d       Device
+		err     error
+		start   time.Time
+		elapsed []time.Duration
+		played  []uint64
+	)
+	d, err = CreateOutputDevice(testSettings(Settings{
+		Name:    nullName,
+		Options: &NullOptions{Realtime: true},
+		OnRowOutput: func(kind Kind, row *PremixData) {
+			elapsed = append(elapsed, time.Since(start))
+			p, _ := GetPosition(d)
+			played = append(played, p.Played)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	start = time.Now()
+	if err := d.Play(testRowChan(rows)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := time.Since(start), framesToDuration(rowCount*testRowLen, testSampleRate); got < want {
+		t.Fatalf("played %v of audio in %v", want, got)
+	}
+	if len(elapsed) != rowCount {
+		t.Fatalf("%d rows output, want %d", len(elapsed), rowCount)
+	}
+	for i := range elapsed {
+		// a row is output once its time has passed, before its frames are counted as played
+		if want := framesToDuration(uint64((i+1)*testRowLen), testSampleRate); elapsed[i] < want {
+			t.Errorf("row %d output after %v, before its end at %v", i, elapsed[i], want)
+		}
+		if want := uint64(i * testRowLen); played[i] != want {
+			t.Errorf("row %d output with %d frames played, want %d", i, played[i], want)
+		}
+	}
+}
@@ -13,10 +13,20 @@ import (
 
 const pulseaudioName = "pulseaudio"
 
+// pulseaudioFormats maps each sample format to its PulseAudio sample format
+var pulseaudioFormats = map[SampleFormat]pulseaudio.Format{
+	SampleFormatInt8:    pulseaudio.FormatUint8,
+	SampleFormatInt16:   pulseaudio.FormatInt16LE,
+	SampleFormatInt24:   pulseaudio.FormatInt24LE,
+	SampleFormatInt32:   pulseaudio.FormatInt32LE,
+	SampleFormatFloat32: pulseaudio.FormatFloat32LE,
+}
+
 type pulseaudioDevice struct {
 	device
-	mix mixing.Mixer
-	pa  *pulseaudio.Client
+	mix  sampleMixer
+	pa   *pulseaudio.Client
+	rows *rowScheduler
 }
 
 func (d *pulseaudioDevice) GetKind() Kind {
@@ -25,24 +35,29 @@ func (d *pulseaudioDevice) GetKind() Kind {
 
 func newPulseAudioDevice(settings Settings) (Device, error) {
 	d := pulseaudioDevice{
-		device: device{
-			onRowOutput: settings.OnRowOutput,
-		},
-		mix: mixing.Mixer{
-			Channels:      settings.Channels,
-			BitsPerSample: settings.BitsPerSample,
-		},
+		device: newDevice(settings),
+		mix:    newSampleMixer(settings.Channels, settings.streamFormat().SampleFormat),
+	}
+
+	format, ok := pulseaudioFormats[d.mix.Format]
+	if !ok {
+		return nil, errors.Wrap(ErrFormatNotSupported, d.mix.Format.String())
 	}
 
-	play, err := pulseaudio.New("Music", settings.SamplesPerSecond, settings.Channels, settings.BitsPerSample)
+	play, err := pulseaudio.New("Music", settings.SamplesPerSecond, settings.Channels, format)
 	if err != nil {
 		return nil, err
 	}
 
 	d.pa = play
+	d.rows = newRowScheduler(KindSoundCard, d.onRowOutput, d.Position, settings.SamplesPerSecond)
 	return &d, nil
 }
 
+func probePulseAudio() error {
+	return pulseaudio.Probe("Music")
+}
+
 // Name returns the device name
 func (d *pulseaudioDevice) Name() string {
 	return pulseaudioName
@@ -63,21 +78,80 @@ func (d *pulseaudioDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixDat
 	myCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	for {
+	defer d.ctl.reset()
+	// a Stop also ends a wait for the server to ask for more data, which lasts as long as the stream is paused
+	_, stopped := d.ctl.state()
+	go func() {
 		select {
+		case <-stopped:
+			cancel()
 		case <-myCtx.Done():
-			return myCtx.Err()
-		case row, ok := <-in:
-			if !ok {
+		}
+	}()
+	go d.rows.Run(myCtx)
+	for {
+		row, err := d.ctl.nextRow(myCtx, in)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			d.rows.Drain(myCtx)
+			return nil
+		}
+		mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+		d.rows.Schedule(d.frames.renderedFrames(), row)
+		if err := d.pa.Output(myCtx, mixedData); err != nil {
+			if ctx.Err() == nil && myCtx.Err() != nil {
+				// stopped
 				return nil
 			}
-			mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
-			d.pa.Output(mixedData)
-			if d.onRowOutput != nil {
-				d.onRowOutput(KindSoundCard, row)
-			}
+			return err
 		}
+		d.frames.addRendered(row.SamplesLen)
+	}
+}
+
+// Position returns the playback position of the stream, based on the server timing information
+func (d *pulseaudioDevice) Position() Position {
+	t, err := d.pa.Timing()
+	if err != nil {
+		return d.device.Position()
+	}
+	return Position{
+		Rendered: t.Rendered,
+		Played:   t.Played,
+		Latency:  t.Latency,
+	}
+}
+
+// Pause corks the playback stream
+func (d *pulseaudioDevice) Pause() error {
+	if err := d.device.Pause(); err != nil {
+		return err
+	}
+	d.pa.Pause()
+	return nil
+}
+
+// Resume uncorks the playback stream
+func (d *pulseaudioDevice) Resume() error {
+	d.pa.Resume()
+	return d.device.Resume()
+}
+
+// Flush discards the audio queued on the playback stream
+func (d *pulseaudioDevice) Flush() error {
+	d.rows.Discard()
+	return d.pa.Flush()
+}
+
+// Stop ends playback and discards the audio queued on the playback stream
+func (d *pulseaudioDevice) Stop() error {
+	if err := d.device.Stop(); err != nil {
+		return err
 	}
+	d.rows.Discard()
+	return d.pa.Flush()
 }
 
 // Close closes the wave output device
@@ -88,8 +162,14 @@ func (d *pulseaudioDevice) Close() {
 }
 
 func init() {
-	Map[pulseaudioName] = deviceDetails{
-		create: newPulseAudioDevice,
-		Kind:   KindSoundCard,
-	}
+	Register(pulseaudioName, KindSoundCard, newPulseAudioDevice,
+		WithDescription("PulseAudio sound server"),
+		WithProbe(probePulseAudio),
+		WithDefaultPriority(100),
+		WithCapabilities(Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 1,
+			MaxSamplesPerSecond: pulseaudio.MaxSampleRate,
+			SampleFormats:       allSampleFormats(),
+		}))
 }
@@ -17,6 +17,7 @@ type winmmDevice struct {
 	device
 	mix     mixing.Mixer
 	waveout *winmm.WaveOut
+	rows    *rowScheduler
 }
 
 func (d *winmmDevice) GetKind() Kind {
@@ -25,9 +26,7 @@ func (d *winmmDevice) GetKind() Kind {
 
 func newWinMMDevice(settings Settings) (Device, error) {
 	d := winmmDevice{
-		device: device{
-			onRowOutput: settings.OnRowOutput,
-		},
+		device: newDevice(settings),
 		mix: mixing.Mixer{
 			Channels:      settings.Channels,
 			BitsPerSample: settings.BitsPerSample,
@@ -41,9 +40,22 @@ func newWinMMDevice(settings Settings) (Device, error) {
 	if d.waveout == nil {
 		return nil, errors.New("could not create winmm device")
 	}
+	d.rows = newRowScheduler(KindSoundCard, d.onRowOutput, d.Position, settings.SamplesPerSecond)
 	return &d, nil
 }
 
+func probeWinMM() error {
+	waveout, err := winmm.New(2, 44100, 16)
+	if err != nil {
+		return err
+	}
+	if waveout == nil {
+		return errors.New("could not create winmm device")
+	}
+	waveout.Close()
+	return nil
+}
+
 // Name returns the device name
 func (d *winmmDevice) Name() string {
 	return winmmName
@@ -70,24 +82,27 @@ func (d *winmmDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) er
 
 	out := make(chan RowWave, 3)
 
+	rowsCtx, rowsCancel := context.WithCancel(ctx)
+	defer rowsCancel()
+	go d.rows.Run(rowsCtx)
+
+	defer d.ctl.reset()
 	go func() {
 		defer cancel()
 		defer close(out)
 		for {
-			select {
-			case <-myCtx.Done():
+			row, err := d.ctl.nextRow(myCtx, in)
+			if err != nil || row == nil {
 				return
-			case row, ok := <-in:
-				if !ok {
-					return
-				}
-				mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
-				rowWave := RowWave{
-					Wave: d.waveout.Write(mixedData),
-					Row:  row,
-				}
-				out <- rowWave
 			}
+			mixedData := d.mix.Flatten(panmixer, row.SamplesLen, row.Data, row.MixerVolume)
+			d.rows.Schedule(d.frames.renderedFrames(), row)
+			rowWave := RowWave{
+				Wave: d.waveout.Write(mixedData),
+				Row:  row,
+			}
+			d.frames.addRendered(row.SamplesLen)
+			out <- rowWave
 		}
 	}()
 
@@ -98,18 +113,28 @@ func (d *winmmDevice) PlayWithCtx(ctx context.Context, in <-chan *PremixData) er
 		case rowWave, ok := <-out:
 			if !ok {
 				// done!
+				d.rows.Drain(rowsCtx)
 				return nil
 			}
-			if d.onRowOutput != nil {
-				d.onRowOutput(KindSoundCard, rowWave.Row)
-			}
 			for !d.waveout.IsHeaderFinished(rowWave.Wave) {
 				time.Sleep(time.Microsecond * 1)
 			}
+			d.frames.addPlayed(rowWave.Row.SamplesLen)
+			d.rows.Kick()
 		}
 	}
 }
 
+// Pause is not supported, as the buffers queued on the device cannot be held
+func (d *winmmDevice) Pause() error {
+	return ErrTransportNotSupported
+}
+
+// Flush is not supported, as the buffers queued on the device cannot be discarded
+func (d *winmmDevice) Flush() error {
+	return ErrTransportNotSupported
+}
+
 // Close closes the wave output device
 func (d *winmmDevice) Close() {
 	if d.waveout != nil {
@@ -118,8 +143,14 @@ func (d *winmmDevice) Close() {
 }
 
 func init() {
-	Map[winmmName] = deviceDetails{
-		create: newWinMMDevice,
-		Kind:   KindSoundCard,
-	}
+	Register(winmmName, KindSoundCard, newWinMMDevice,
+		WithDescription("Windows Multimedia (WinMM) wave output"),
+		WithProbe(probeWinMM),
+		WithDefaultPriority(100),
+		WithCapabilities(Capabilities{
+			Channels:            mixerChannels(),
+			MinSamplesPerSecond: 8000,
+			MaxSamplesPerSecond: 192000,
+			SampleFormats:       []SampleFormat{SampleFormatInt8, SampleFormatInt16},
+		}))
 }
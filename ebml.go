@@ -0,0 +1,149 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// EBML and Matroska element IDs, including their length markers
+const (
+	ebmlIDHeader             = 0x1a45dfa3
+	ebmlIDVersion            = 0x4286
+	ebmlIDReadVersion        = 0x42f7
+	ebmlIDMaxIDLength        = 0x42f2
+	ebmlIDMaxSizeLength      = 0x42f3
+	ebmlIDDocType            = 0x4282
+	ebmlIDDocTypeVersion     = 0x4287
+	ebmlIDDocTypeReadVersion = 0x4285
+	ebmlIDVoid               = 0xec
+
+	mkvIDSegment            = 0x18538067
+	mkvIDSeekHead           = 0x114d9b74
+	mkvIDSeek               = 0x4dbb
+	mkvIDSeekID             = 0x53ab
+	mkvIDSeekPosition       = 0x53ac
+	mkvIDInfo               = 0x1549a966
+	mkvIDTimecodeScale      = 0x2ad7b1
+	mkvIDDuration           = 0x4489
+	mkvIDMuxingApp          = 0x4d80
+	mkvIDWritingApp         = 0x5741
+	mkvIDTitle              = 0x7ba9
+	mkvIDTracks             = 0x1654ae6b
+	mkvIDTrackEntry         = 0xae
+	mkvIDTrackNumber        = 0xd7
+	mkvIDTrackUID           = 0x73c5
+	mkvIDTrackType          = 0x83
+	mkvIDFlagLacing         = 0x9c
+	mkvIDCodecID            = 0x86
+	mkvIDCodecPrivate       = 0x63a2
+	mkvIDAudio              = 0xe1
+	mkvIDSamplingFrequency  = 0xb5
+	mkvIDChannels           = 0x9f
+	mkvIDBitDepth           = 0x6264
+	mkvIDCluster            = 0x1f43b675
+	mkvIDTimecode           = 0xe7
+	mkvIDSimpleBlock        = 0xa3
+	mkvIDCues               = 0x1c53bb6b
+	mkvIDCuePoint           = 0xbb
+	mkvIDCueTime            = 0xb3
+	mkvIDCueTrackPositions  = 0xb7
+	mkvIDCueTrack           = 0xf7
+	mkvIDCueClusterPosition = 0xf1
+	mkvIDTags               = 0x1254c367
+	mkvIDTag                = 0x7373
+	mkvIDTargets            = 0x63c0
+	mkvIDSimpleTag          = 0x67c8
+	mkvIDTagName            = 0x45a3
+	mkvIDTagString          = 0x4487
+	mkvIDChapters           = 0x1043a770
+	mkvIDEditionEntry       = 0x45b9
+	mkvIDChapterAtom        = 0xb6
+	mkvIDChapterUID         = 0x73c4
+	mkvIDChapterTimeStart   = 0x91
+	mkvIDChapterDisplay     = 0x80
+	mkvIDChapString         = 0x85
+	mkvIDChapLanguage       = 0x437c
+)
+
+const (
+	// ebmlMaxSizeLength is the size of the widest element size, which is used for sizes rewritten later
+	ebmlMaxSizeLength = 8
+	// ebmlUnknownSize is the element size of a master element whose size is not known
+	ebmlUnknownSize = 1<<(7*ebmlMaxSizeLength) - 1
+)
+
+// ebmlWriteID writes an element ID, whose length is given by its marker
+func ebmlWriteID(b *bytes.Buffer, id uint32) {
+	n := 1
+	for id>>(8*n) != 0 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		b.WriteByte(byte(id >> (8 * i)))
+	}
+}
+
+// ebmlWriteSize writes an element size in width bytes, or in as few bytes as it fits when width is 0
+func ebmlWriteSize(b *bytes.Buffer, size uint64, width int) {
+	if width == 0 {
+		width = 1
+		// the value with every bit set is reserved for unknown sizes
+		for size >= 1<<(7*width)-1 {
+			width++
+		}
+	}
+	v := size | 1<<(7*width)
+	for i := width - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
+
+// ebmlWriteElement writes an element holding the body
+func ebmlWriteElement(b *bytes.Buffer, id uint32, body []byte) {
+	ebmlWriteID(b, id)
+	ebmlWriteSize(b, uint64(len(body)), 0)
+	b.Write(body)
+}
+
+// ebmlWriteUint writes an unsigned integer element, in as few bytes as it fits
+func ebmlWriteUint(b *bytes.Buffer, id uint32, v uint64) {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+	var body [8]byte
+	binary.BigEndian.PutUint64(body[:], v)
+	ebmlWriteElement(b, id, body[8-n:])
+}
+
+// ebmlWriteFixedUint writes an unsigned integer element in 8 bytes, so it can be rewritten in place
+func ebmlWriteFixedUint(b *bytes.Buffer, id uint32, v uint64) {
+	var body [8]byte
+	binary.BigEndian.PutUint64(body[:], v)
+	ebmlWriteElement(b, id, body[:])
+}
+
+// ebmlWriteFloat writes a 64-bit floating point element
+func ebmlWriteFloat(b *bytes.Buffer, id uint32, v float64) {
+	var body [8]byte
+	binary.BigEndian.PutUint64(body[:], math.Float64bits(v))
+	ebmlWriteElement(b, id, body[:])
+}
+
+// ebmlWriteString writes a string element
+func ebmlWriteString(b *bytes.Buffer, id uint32, s string) {
+	ebmlWriteElement(b, id, []byte(s))
+}
+
+// ebmlWriteVoid writes a Void element filling size bytes, which must be at least 2
+func ebmlWriteVoid(b *bytes.Buffer, size int) {
+	// the size of the void is one byte, unless the body does not fit in it
+	width := 1
+	if size-2 >= 1<<7-1 {
+		width = ebmlMaxSizeLength
+	}
+	ebmlWriteID(b, ebmlIDVoid)
+	ebmlWriteSize(b, uint64(size-1-width), width)
+	b.Write(make([]byte, size-1-width))
+}
@@ -0,0 +1,200 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotracker/gomixing/mixing"
+	"github.com/gotracker/gomixing/volume"
+)
+
+const (
+	testSampleRate = 44100
+	testRowLen     = 441
+	testRows       = 200
+)
+
+// testSignal returns rows of harmonics with a little noise, different on each channel
+func testSignal(channels int, rows int, rowLen int, rate int) []*PremixData {
+	rng := rand.New(rand.NewSource(1))
+	return testRowsOf(channels, rows, rowLen, func(c int, n int) float64 {
+		t := float64(n) / float64(rate)
+		f0 := 220 * float64(c+1)
+		var v float64
+		for h := 1; h <= 6; h++ {
+			v += 0.3 / float64(h) * math.Sin(2*math.Pi*f0*float64(h)*t+float64(h))
+		}
+		v *= 0.6 + 0.4*math.Sin(2*math.Pi*1.5*t)
+		return v + 0.01*rng.NormFloat64()
+	})
+}
+
+// testRowsOf returns rows of the samples given by f, for each channel and frame
+func testRowsOf(channels int, rows int, rowLen int, f func(c int, n int) float64) []*PremixData {
+	out := make([]*PremixData, rows)
+	for r := range out {
+		buf := make(mixing.MixBuffer, channels)
+		for c := range buf {
+			buf[c] = make(volume.Matrix, rowLen)
+		}
+		for i := 0; i < rowLen; i++ {
+			for c := range buf {
+				buf[c][i] = volume.Volume(f(c, r*rowLen+i))
+			}
+		}
+		out[r] = &PremixData{
+			SamplesLen:  rowLen,
+			Data:        []mixing.ChannelData{{{Data: buf, Volume: 1, SamplesLen: rowLen}}},
+			MixerVolume: 1,
+			Userdata:    r,
+		}
+	}
+	return out
+}
+
+// testMarker is the Userdata of a row, marking every 50th row
+type testMarker int
+
+func (m testMarker) MarkerLabel() (string, bool) {
+	return fmt.Sprintf("row %d", m), m%50 == 0
+}
+
+// testMarked returns the rows with a testMarker as their Userdata
+func testMarked(rows []*PremixData) []*PremixData {
+	out := make([]*PremixData, len(rows))
+	for r, row := range rows {
+		marked := *row
+		marked.Userdata = testMarker(r)
+		out[r] = &marked
+	}
+	return out
+}
+
+func testRowChan(rows []*PremixData) <-chan *PremixData {
+	ch := make(chan *PremixData, len(rows))
+	for _, r := range rows {
+		ch <- r
+	}
+	close(ch)
+	return ch
+}
+
+// testSettings fills in the stream format of the test signal
+func testSettings(s Settings) Settings {
+	if s.Channels == 0 {
+		s.Channels = 2
+	}
+	if s.SamplesPerSecond == 0 {
+		s.SamplesPerSecond = testSampleRate
+	}
+	if s.BitsPerSample == 0 && s.SampleFormat == SampleFormatDefault {
+		s.BitsPerSample = 16
+	}
+	s.StrictFormat = true
+	return s
+}
+
+// testPlay creates the device and plays the rows through it
+func testPlay(t *testing.T, s Settings, rows []*PremixData) {
+	t.Helper()
+	d, err := CreateOutputDevice(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Play(testRowChan(rows)); err != nil {
+		d.Close()
+		t.Fatal(err)
+	}
+	d.Close()
+}
+
+// testRenderFile renders the rows to a file in the format, returning its contents
+func testRenderFile(t *testing.T, format string, s Settings, rows []*PremixData) []byte {
+	t.Helper()
+	s = testSettings(s)
+	s.Name = fileName
+	s.Format = format
+	s.Filepath = filepath.Join(t.TempDir(), "out."+format)
+	testPlay(t, s, rows)
+	b, err := os.ReadFile(s.Filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testRenderStream renders the rows in the format to a writer that cannot seek
+func testRenderStream(t *testing.T, format string, s Settings, rows []*PremixData) []byte {
+	t.Helper()
+	var w struct{ bytes.Buffer }
+	s = testSettings(s)
+	s.Name = fileName
+	s.Format = format
+	s.Writer = &w
+	testPlay(t, s, rows)
+	return w.Bytes()
+}
+
+// testCapture plays the rows through the memory device, with the same stream format
+func testCapture(t *testing.T, s Settings, rows []*PremixData) Capture {
+	t.Helper()
+	s = testSettings(s)
+	s.Name = memoryName
+	s.Options = nil
+	d, err := CreateOutputDevice(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Play(testRowChan(rows)); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := GetCapture(d)
+	return c
+}
+
+// testDecodeInts decodes interleaved integer samples, one slice per channel
+func testDecodeInts(b []byte, channels int, format SampleFormat, order binary.ByteOrder) [][]int32 {
+	sampleSize := format.BitsPerSample() / 8
+	out := make([][]int32, channels)
+	for pos := 0; pos+sampleSize*channels <= len(b); {
+		for c := range out {
+			var v int32
+			switch format {
+			case SampleFormatInt8:
+				v = int32(int8(b[pos]))
+			case SampleFormatInt16:
+				v = int32(int16(order.Uint16(b[pos:])))
+			case SampleFormatInt24:
+				if order == binary.BigEndian {
+					v = int32(b[pos])<<24>>8 | int32(b[pos+1])<<8 | int32(b[pos+2])
+				} else {
+					v = int32(b[pos+2])<<24>>8 | int32(b[pos+1])<<8 | int32(b[pos])
+				}
+			case SampleFormatInt32:
+				v = int32(order.Uint32(b[pos:]))
+			}
+			out[c] = append(out[c], v)
+			pos += sampleSize
+		}
+	}
+	return out
+}
+
+// testSNR returns the signal to noise ratio of the decoded samples against the reference, in dB
+func testSNR(ref [][]float32, got [][]float32) float64 {
+	var sig, noise float64
+	for c := range ref {
+		for i, v := range ref[c] {
+			d := float64(got[c][i] - v)
+			sig += float64(v) * float64(v)
+			noise += d * d
+		}
+	}
+	return 10 * math.Log10(sig/noise)
+}
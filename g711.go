@@ -0,0 +1,72 @@
+package gosound
+
+// G.711 companding, after the Sun Microsystems reference implementation
+
+const (
+	// muLawBias is the bias added to 14-bit magnitudes before μ-law encoding
+	muLawBias = 0x21
+	// muLawClip is the largest 14-bit magnitude that can be μ-law encoded
+	muLawClip = 8159
+)
+
+// g711Segment returns the segment of the companding curve holding v, where
+// first is the end of the first segment, or 8 if v is beyond the last segment
+func g711Segment(v int32, first int32) int32 {
+	end := first
+	for seg := int32(0); seg < 8; seg++ {
+		if v <= end {
+			return seg
+		}
+		end = end<<1 | 1
+	}
+	return 8
+}
+
+// linearToMuLaw encodes a 16-bit sample as 8-bit μ-law
+func linearToMuLaw(sample int16) byte {
+	v := int32(sample) >> 2
+	mask := int32(0xFF)
+	if v < 0 {
+		v = -v
+		mask = 0x7F
+	}
+	if v > muLawClip {
+		v = muLawClip
+	}
+	v += muLawBias
+	seg := g711Segment(v, 0x3F)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	return byte((seg<<4 | (v>>(seg+1))&0xF) ^ mask)
+}
+
+// linearToALaw encodes a 16-bit sample as 8-bit A-law
+func linearToALaw(sample int16) byte {
+	v := int32(sample) >> 3
+	mask := int32(0xD5)
+	if v < 0 {
+		v = -v - 1
+		mask = 0x55
+	}
+	seg := g711Segment(v, 0x1F)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (v >> 1) & 0xF
+	} else {
+		aval |= (v >> seg) & 0xF
+	}
+	return byte(aval ^ mask)
+}
+
+// sampleTo16 scales a sample, as produced by sampleMixer.FlattenToInts, to 16 bits
+func sampleTo16(v int32, format SampleFormat) int16 {
+	bits := format.BitsPerSample()
+	if bits > 16 {
+		return int16(v >> (bits - 16))
+	}
+	return int16(v << (16 - bits))
+}
@@ -0,0 +1,59 @@
+package gosound
+
+import (
+	"math"
+	"testing"
+)
+
+// testMuLawToLinear decodes an 8-bit μ-law sample, after the Sun Microsystems reference implementation
+func testMuLawToLinear(u byte) int16 {
+	u = ^u
+	t := (int32(u&0xF)<<3 + muLawBias<<2) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(muLawBias<<2 - t)
+	}
+	return int16(t - muLawBias<<2)
+}
+
+// testALawToLinear decodes an 8-bit A-law sample, after the Sun Microsystems reference implementation
+func testALawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int32(a&0xF) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (seg - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func TestG711(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		compand func(int16) byte
+		expand  func(byte) int16
+	}{
+		{"μ-law", linearToMuLaw, testMuLawToLinear},
+		{"A-law", linearToALaw, testALawToLinear},
+	} {
+		prev := int16(math.MinInt16)
+		for v := math.MinInt16; v <= math.MaxInt16; v++ {
+			got := tc.expand(tc.compand(int16(v)))
+			// the step of each segment doubles, so the error grows with the magnitude
+			diff := math.Abs(float64(int(got) - v))
+			if limit := math.Abs(float64(v))/16 + 16; diff > limit {
+				t.Fatalf("%s: %d decodes as %d", tc.name, v, got)
+			}
+			if got < prev {
+				t.Fatalf("%s: %d decodes as %d, below the %d of the sample before", tc.name, v, got, prev)
+			}
+			prev = got
+		}
+	}
+}
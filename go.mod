@@ -4,16 +4,19 @@ go 1.18
 
 require (
 	github.com/gotracker/gomixing v1.1.2
+	github.com/hajimehoshi/go-mp3 v0.3.4
 	github.com/heucuva/go-directsound v1.0.0
 	github.com/heucuva/go-win32 v1.0.0
 	github.com/heucuva/go-winmm v1.0.0
+	github.com/jfreymuth/oggvorbis v1.0.5
 	github.com/jfreymuth/pulse v0.1.0
-	github.com/mewkiz/flac v1.0.7
+	github.com/mewkiz/flac v1.0.12
 	github.com/pkg/errors v0.9.1
-	golang.org/x/sys v0.0.0-20220503163025-988cb79eb6c6
+	golang.org/x/sys v0.5.0
 )
 
 require (
 	github.com/icza/bitio v1.1.0 // indirect
-	github.com/mewkiz/pkg v0.0.0-20211102230744-16a6ce8f1b77 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
+	github.com/mewkiz/pkg v0.0.0-20230226050401-4010bf0fec14 // indirect
 )
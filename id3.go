@@ -0,0 +1,115 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+const (
+	id3v2HeaderSize = 10
+
+	id3EncodingLatin1 = 0x00
+	id3EncodingUTF16  = 0x01
+)
+
+// id3v2TextFrames maps the well-known tag names to their ID3v2.3 text frames
+var id3v2TextFrames = map[string]string{
+	"GENRE":       "TCON",
+	"DATE":        "TYER",
+	"YEAR":        "TYER",
+	"COPYRIGHT":   "TCOP",
+	"COMPOSER":    "TCOM",
+	"TRACKNUMBER": "TRCK",
+	"ENCODER":     "TSSE",
+}
+
+// id3v2Tag returns an ID3v2.3 tag holding the metadata, followed by padding bytes
+func id3v2Tag(m Metadata, padding int) []byte {
+	var frames bytes.Buffer
+	writeText := func(id string, value string) {
+		if value != "" {
+			id3v2WriteFrame(&frames, id, id3Text(value))
+		}
+	}
+	writeText("TIT2", m.Title)
+	writeText("TPE1", m.Artist)
+	writeText("TALB", m.Album)
+	if m.Comment != "" {
+		// encoding, language, empty short description, comment
+		text := id3Text("", m.Comment)
+		body := append([]byte{text[0], 'e', 'n', 'g'}, text[1:]...)
+		id3v2WriteFrame(&frames, "COMM", body)
+	}
+	for _, name := range m.tagNames() {
+		value := m.Tags[name]
+		if id, ok := id3v2TextFrames[name]; ok {
+			writeText(id, value)
+			continue
+		}
+		// user defined text: encoding, description, value
+		id3v2WriteFrame(&frames, "TXXX", id3Text(name, value))
+	}
+
+	size := frames.Len() + padding
+	tag := make([]byte, id3v2HeaderSize, id3v2HeaderSize+size)
+	copy(tag, "ID3")
+	tag[3] = 3 // version 2.3.0
+	tag[4] = 0
+	tag[5] = 0 // flags
+	putSynchsafe(tag[6:], uint32(size))
+	tag = append(tag, frames.Bytes()...)
+	return append(tag, make([]byte, padding)...)
+}
+
+// id3v2WriteFrame writes an ID3v2.3 frame
+func id3v2WriteFrame(w *bytes.Buffer, id string, body []byte) {
+	var hdr [10]byte
+	copy(hdr[:4], id)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(body)))
+	w.Write(hdr[:])
+	w.Write(body)
+}
+
+// id3Text returns the text encoding byte followed by the encoded values,
+// separated by terminators. Latin-1 is used when possible, otherwise UTF-16
+// with a byte order mark.
+func id3Text(values ...string) []byte {
+	enc := byte(id3EncodingLatin1)
+	for _, v := range values {
+		for _, r := range v {
+			if r > 0xFF {
+				enc = id3EncodingUTF16
+			}
+		}
+	}
+	out := []byte{enc}
+	for i, v := range values {
+		if i > 0 {
+			if enc == id3EncodingUTF16 {
+				out = append(out, 0, 0)
+			} else {
+				out = append(out, 0)
+			}
+		}
+		if enc == id3EncodingLatin1 {
+			for _, r := range v {
+				out = append(out, byte(r))
+			}
+			continue
+		}
+		out = append(out, 0xFF, 0xFE)
+		for _, u := range utf16.Encode([]rune(v)) {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+// putSynchsafe stores v as a 28-bit synchsafe integer
+func putSynchsafe(b []byte, v uint32) {
+	b[0] = byte(v>>21) & 0x7F
+	b[1] = byte(v>>14) & 0x7F
+	b[2] = byte(v>>7) & 0x7F
+	b[3] = byte(v) & 0x7F
+}
@@ -0,0 +1,123 @@
+package mp3
+
+import "math"
+
+const (
+	subbands    = 32
+	granuleSize = 576
+	// slots is the number of subband samples of each subband in a granule
+	slots = granuleSize / subbands
+)
+
+var (
+	// window is the full analysis window
+	window [512]float64
+	// matrix holds the cosines of the analysis filterbank
+	matrix [subbands][64]float64
+	// mdctTable holds the cosines of the MDCT, with the window applied
+	mdctTable [slots][2 * slots]float64
+	// aliasCS and aliasCA are the butterfly coefficients of the alias reduction
+	aliasCS, aliasCA [8]float64
+)
+
+func init() {
+	for i := range window {
+		switch {
+		case i <= 256:
+			window[i] = analysisWindow[i]
+		case i%64 == 0:
+			window[i] = analysisWindow[512-i]
+		default:
+			window[i] = -analysisWindow[512-i]
+		}
+	}
+	for i := range matrix {
+		for k := range matrix[i] {
+			matrix[i][k] = math.Cos(float64((2*i+1)*(k-16)) * math.Pi / 64)
+		}
+	}
+	for m := range mdctTable {
+		for k := range mdctTable[m] {
+			w := math.Sin(math.Pi / 36 * (float64(k) + 0.5))
+			mdctTable[m][k] = w * math.Cos(math.Pi/72*float64((2*k+1+slots)*(2*m+1))) * mdctScale
+		}
+	}
+	for i, c := range aliasCoefficients {
+		sq := math.Sqrt(1 + c*c)
+		aliasCS[i] = 1 / sq
+		aliasCA[i] = c / sq
+	}
+}
+
+// mdctScale scales the MDCT, so the decoder restores the level of the audio
+const mdctScale = 1.0 / 9
+
+// filterbank splits the audio of a channel into the spectral values of each granule
+type filterbank struct {
+	// x holds the latest samples, newest first
+	x [512]float64
+	// prev holds the subband samples of the previous granule
+	prev [slots][subbands]float64
+}
+
+// analyze returns the 32 subband samples of the next 32 samples of audio
+func (f *filterbank) analyze(samples []float64, out *[subbands]float64) {
+	copy(f.x[subbands:], f.x[:512-subbands])
+	for i, s := range samples[:subbands] {
+		f.x[subbands-1-i] = s
+	}
+	var y [64]float64
+	for k := range y {
+		for j := k; j < 512; j += 64 {
+			y[k] += window[j] * f.x[j]
+		}
+	}
+	for i := range out {
+		var s float64
+		for k, v := range y {
+			s += matrix[i][k] * v
+		}
+		out[i] = s
+	}
+}
+
+// granule returns the spectral values of the next granule of audio, ordered by subband
+func (f *filterbank) granule(samples []float64) [granuleSize]float64 {
+	var cur [slots][subbands]float64
+	for t := range cur {
+		f.analyze(samples[t*subbands:], &cur[t])
+		// the decoder inverts the odd subbands at odd slots, so they are inverted here to match
+		if t%2 == 1 {
+			for sb := 1; sb < subbands; sb += 2 {
+				cur[t][sb] = -cur[t][sb]
+			}
+		}
+	}
+
+	var xr [granuleSize]float64
+	var z [2 * slots]float64
+	for sb := 0; sb < subbands; sb++ {
+		for t := 0; t < slots; t++ {
+			z[t] = f.prev[t][sb]
+			z[t+slots] = cur[t][sb]
+		}
+		for m := 0; m < slots; m++ {
+			var s float64
+			for k, v := range z {
+				s += mdctTable[m][k] * v
+			}
+			xr[sb*slots+m] = s
+		}
+	}
+	f.prev = cur
+
+	// alias reduction, which the decoder undoes
+	for sb := 1; sb < subbands; sb++ {
+		for i := range aliasCS {
+			a, b := xr[sb*slots-1-i], xr[sb*slots+i]
+			xr[sb*slots-1-i] = a*aliasCS[i] + b*aliasCA[i]
+			xr[sb*slots+i] = b*aliasCS[i] - a*aliasCA[i]
+		}
+	}
+	return xr
+}
@@ -0,0 +1,247 @@
+package mp3
+
+import "math"
+
+// bitWriter packs values into bytes, most significant bit first
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+// write writes the low n bits of v
+func (b *bitWriter) write(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		if b.bits%8 == 0 {
+			b.buf = append(b.buf, 0)
+		}
+		if v>>(i-1)&1 != 0 {
+			b.buf[len(b.buf)-1] |= 0x80 >> (b.bits % 8)
+		}
+		b.bits++
+	}
+}
+
+const (
+	// maxValue is the largest quantized value that can be coded, with 13 linbits
+	maxValue = 15 + 1<<13 - 1
+	// maxPart23Length is the most bits the side information can hold for a granule of a channel
+	maxPart23Length = 1<<12 - 1
+)
+
+// granuleInfo is the coding of a granule of a channel
+type granuleInfo struct {
+	// ix holds the quantized magnitudes, and negative the signs of the spectral values
+	ix       [granuleSize]int
+	negative [granuleSize]bool
+
+	part23Length int
+	bigValues    int
+	globalGain   int
+	tableSelect  [3]int
+	region0Count int
+	region1Count int
+	count1Table  int
+	// count1 is the number of quadruples of values no larger than one
+	count1 int
+}
+
+// quantize quantizes the magnitudes, raised to the power 3/4, with the global gain
+func (gi *granuleInfo) quantize(xr34 []float64, globalGain int) bool {
+	gi.globalGain = globalGain
+	scale := math.Pow(2, -0.1875*float64(globalGain-210))
+	for i, v := range xr34 {
+		q := v*scale + 0.4054
+		if q > maxValue {
+			return false
+		}
+		gi.ix[i] = int(q)
+	}
+	return true
+}
+
+// count chooses the regions and tables of the quantized values, returning the bits they need
+func (gi *granuleInfo) count(bounds *[23]int) int {
+	// trailing zeros are not coded, and values no larger than one are coded in quadruples
+	i := granuleSize
+	for i > 1 && gi.ix[i-1] == 0 && gi.ix[i-2] == 0 {
+		i -= 2
+	}
+	gi.count1 = 0
+	for i > 3 && gi.ix[i-1] <= 1 && gi.ix[i-2] <= 1 && gi.ix[i-3] <= 1 && gi.ix[i-4] <= 1 {
+		gi.count1++
+		i -= 4
+	}
+	gi.bigValues = i / 2
+
+	bitsA, bitsB := 0, 0
+	for q := i; q < i+4*gi.count1; q += 4 {
+		v := gi.ix[q]<<3 | gi.ix[q+1]<<2 | gi.ix[q+2]<<1 | gi.ix[q+3]
+		bitsA += int(quadLengthsA[v])
+		bitsB += int(quadLengthsB[v])
+		for _, x := range gi.ix[q : q+4] {
+			bitsA += x
+			bitsB += x
+		}
+	}
+	bits := bitsA
+	gi.count1Table = 0
+	if bitsB < bitsA {
+		bits = bitsB
+		gi.count1Table = 1
+	}
+
+	gi.region0Count, gi.region1Count = 0, 0
+	if i > 0 {
+		bands := 0
+		for bounds[bands] < i {
+			bands++
+		}
+		split := regionSplits[bands]
+		gi.region0Count, gi.region1Count = split[0], split[1]
+	}
+	r1, r2 := gi.regionBounds(bounds)
+	gi.tableSelect[0], bits = chooseTable(gi.ix[:r1], bits)
+	gi.tableSelect[1], bits = chooseTable(gi.ix[r1:r2], bits)
+	gi.tableSelect[2], bits = chooseTable(gi.ix[r2:i], bits)
+	gi.part23Length = bits
+	return bits
+}
+
+// regionBounds returns where the second and third regions of big values start
+func (gi *granuleInfo) regionBounds(bounds *[23]int) (int, int) {
+	end := gi.bigValues * 2
+	r1 := bounds[gi.region0Count+1]
+	r2 := bounds[gi.region0Count+gi.region1Count+2]
+	if r1 > end {
+		r1 = end
+	}
+	if r2 > end {
+		r2 = end
+	}
+	return r1, r2
+}
+
+// chooseTable returns the table that codes the pairs of values in the fewest bits,
+// adding them to the bits
+func chooseTable(ix []int, bits int) (int, int) {
+	largest := 0
+	for _, v := range ix {
+		if v > largest {
+			largest = v
+		}
+	}
+	if largest == 0 {
+		return 0, bits
+	}
+
+	best, bestBits := 0, math.MaxInt32
+	try := func(t int) {
+		if n := pairBits(&huffTables[t], ix); n < bestBits {
+			best, bestBits = t, n
+		}
+	}
+	for t := range huffTables {
+		if h := &huffTables[t]; h.xlen > largest && h.linbits == 0 {
+			try(t)
+		}
+	}
+	if largest >= 15 {
+		// the smallest escape of each of the two tables with escapes
+		for _, first := range []int{16, 24} {
+			for t := first; t < first+8; t++ {
+				if 15+1<<huffTables[t].linbits-1 >= largest {
+					try(t)
+					break
+				}
+			}
+		}
+	}
+	return best, bits + bestBits
+}
+
+// pairBits returns the bits needed to code the pairs of values with the table
+func pairBits(h *huffTable, ix []int) int {
+	bits := 0
+	for i := 0; i+1 < len(ix); i += 2 {
+		x, y := ix[i], ix[i+1]
+		if x > 14 && h.linbits > 0 {
+			x = 15
+			bits += int(h.linbits)
+		}
+		if y > 14 && h.linbits > 0 {
+			y = 15
+			bits += int(h.linbits)
+		}
+		bits += int(h.lengths[x*h.xlen+y])
+		if x != 0 {
+			bits++
+		}
+		if y != 0 {
+			bits++
+		}
+	}
+	return bits
+}
+
+// write writes the Huffman coded values
+func (gi *granuleInfo) write(b *bitWriter, bounds *[23]int) {
+	r1, r2 := gi.regionBounds(bounds)
+	end := gi.bigValues * 2
+	for i := 0; i < end; i += 2 {
+		t := gi.tableSelect[2]
+		if i < r1 {
+			t = gi.tableSelect[0]
+		} else if i < r2 {
+			t = gi.tableSelect[1]
+		}
+		if t == 0 {
+			continue
+		}
+		h := &huffTables[t]
+		cx, cy := gi.ix[i], gi.ix[i+1]
+		if h.linbits > 0 {
+			if cx > 14 {
+				cx = 15
+			}
+			if cy > 14 {
+				cy = 15
+			}
+		}
+		idx := cx*h.xlen + cy
+		b.write(uint32(h.codes[idx]), uint(h.lengths[idx]))
+		gi.writeValue(b, h, i, cx)
+		gi.writeValue(b, h, i+1, cy)
+	}
+
+	codes, lengths := quadCodesA, quadLengthsA
+	if gi.count1Table == 1 {
+		codes, lengths = quadCodesB, quadLengthsB
+	}
+	for q := end; q < end+4*gi.count1; q += 4 {
+		v := gi.ix[q]<<3 | gi.ix[q+1]<<2 | gi.ix[q+2]<<1 | gi.ix[q+3]
+		b.write(uint32(codes[v]), uint(lengths[v]))
+		for i := q; i < q+4; i++ {
+			if gi.ix[i] != 0 {
+				b.writeBool(gi.negative[i])
+			}
+		}
+	}
+}
+
+// writeValue writes the escape bits and the sign of the value at i, which was coded as c
+func (gi *granuleInfo) writeValue(b *bitWriter, h *huffTable, i int, c int) {
+	if c == 15 && h.linbits > 0 {
+		b.write(uint32(gi.ix[i]-15), h.linbits)
+	}
+	if c != 0 {
+		b.writeBool(gi.negative[i])
+	}
+}
+
+func (b *bitWriter) writeBool(v bool) {
+	if v {
+		b.write(1, 1)
+	} else {
+		b.write(0, 1)
+	}
+}
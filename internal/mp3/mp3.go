@@ -0,0 +1,340 @@
+// Package mp3 encodes audio as an MPEG-1 Layer III bitstream at a constant bitrate
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// FrameSize is the number of samples of each channel in a frame
+	FrameSize = 2 * granuleSize
+
+	// Delay is the number of samples by which the encoder delays the audio,
+	// not counting the delay of the decoder
+	Delay = 528
+	// decoderDelay is the delay of the decoder's filterbank
+	decoderDelay = 529
+
+	// DefaultBitrate is a bitrate suitable for most stereo music, in kbit/s
+	DefaultBitrate = 128
+
+	// encoderName is the encoder named in the Info tag
+	encoderName = "gosound"
+
+	// infoSize is the size of the Info tag, with its LAME extension
+	infoSize = 120 + 36
+)
+
+// Encoder encodes audio as an MPEG-1 Layer III bitstream. Each granule is quantized with a
+// single global gain, chosen to fit the bitrate, using long blocks only.
+type Encoder struct {
+	w        io.Writer
+	channels int
+
+	rateIndex    int
+	bitrateIndex int
+	bounds       *[23]int
+	// cutoff is the spectral line above which nothing is coded
+	cutoff int
+
+	filters []filterbank
+	// buf holds the samples of each channel not yet encoded
+	buf [][]float64
+	// slack accumulates the remainder of the frame size, adding a padding byte when it overflows
+	slack int
+
+	samples uint64
+	frames  uint32
+	bytes   uint32
+	crc     uint16
+}
+
+// NewEncoder returns an encoder writing to w, at the bitrate in kbit/s.
+// A placeholder for the Info tag is written straight away, as the first frame.
+func NewEncoder(w io.Writer, channels int, sampleRate int, bitrate int) (*Encoder, error) {
+	if err := CheckFormat(channels, sampleRate, bitrate); err != nil {
+		return nil, err
+	}
+	e := &Encoder{
+		w:            w,
+		channels:     channels,
+		rateIndex:    indexOf(sampleRates[:], sampleRate),
+		bitrateIndex: indexOf(bitrates[1:], bitrate) + 1,
+		filters:      make([]filterbank, channels),
+		buf:          make([][]float64, channels),
+	}
+	e.bounds = &bandBounds[e.rateIndex]
+	e.cutoff = int(math.Min(1, lowpass(bitrate/channels)/float64(sampleRate/2)) * granuleSize)
+
+	if _, err := w.Write(e.InfoFrame()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CheckFormat returns an error if the channels, sample rate or bitrate in kbit/s cannot be encoded
+func CheckFormat(channels int, sampleRate int, bitrate int) error {
+	switch {
+	case channels < 1 || channels > 2:
+		return errors.New("invalid channel count for mp3")
+	case indexOf(sampleRates[:], sampleRate) < 0:
+		return errors.New("invalid sample rate for mp3")
+	case indexOf(bitrates[1:], bitrate) < 0:
+		return errors.New("invalid bitrate for mp3")
+	}
+	return nil
+}
+
+// SampleRates returns the supported sample rates
+func SampleRates() []int {
+	return append([]int(nil), sampleRates[:]...)
+}
+
+func indexOf(values []int, v int) int {
+	for i, x := range values {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// lowpass returns the frequency above which nothing is coded, for the bitrate of each channel
+func lowpass(bitrate int) float64 {
+	switch {
+	case bitrate >= 128:
+		return 20000
+	case bitrate >= 96:
+		return 17500
+	case bitrate >= 64:
+		return 15500
+	case bitrate >= 48:
+		return 12500
+	case bitrate >= 32:
+		return 9000
+	}
+	return 6000
+}
+
+// Write encodes the samples of each channel, which are scaled to [-1, 1]
+func (e *Encoder) Write(samples [][]float32) error {
+	for ch, s := range samples[:e.channels] {
+		for _, v := range s {
+			e.buf[ch] = append(e.buf[ch], float64(v))
+		}
+	}
+	e.samples += uint64(len(samples[0]))
+	return e.encodeFrames()
+}
+
+// Close encodes the rest of the samples, padded with silence to a whole frame
+// after passing through the delays of the encoder and decoder
+func (e *Encoder) Close() error {
+	frames := (e.samples + Delay + decoderDelay + FrameSize - 1) / FrameSize
+	pad := int(frames-uint64(e.frames))*FrameSize - len(e.buf[0])
+	for ch := range e.buf {
+		e.buf[ch] = append(e.buf[ch], make([]float64, pad)...)
+	}
+	return e.encodeFrames()
+}
+
+// encodeFrames encodes every whole frame of samples held
+func (e *Encoder) encodeFrames() error {
+	for len(e.buf[0]) >= FrameSize {
+		if err := e.encodeFrame(); err != nil {
+			return err
+		}
+		for ch := range e.buf {
+			e.buf[ch] = append(e.buf[ch][:0], e.buf[ch][FrameSize:]...)
+		}
+	}
+	return nil
+}
+
+// frameLength returns the size in bytes of a frame at the bitrate, without padding
+func (e *Encoder) frameLength(bitrateIndex int) int {
+	return 144 * 1000 * bitrates[bitrateIndex] / sampleRates[e.rateIndex]
+}
+
+// sideInfoLength returns the size of the side information in bytes
+func (e *Encoder) sideInfoLength() int {
+	if e.channels == 1 {
+		return 17
+	}
+	return 32
+}
+
+// encodeFrame encodes the first frame of samples held
+func (e *Encoder) encodeFrame() error {
+	padding := 0
+	e.slack += 144 * 1000 * bitrates[e.bitrateIndex] % sampleRates[e.rateIndex]
+	if e.slack >= sampleRates[e.rateIndex] {
+		e.slack -= sampleRates[e.rateIndex]
+		padding = 1
+	}
+	size := e.frameLength(e.bitrateIndex) + padding
+	available := (size - 4 - e.sideInfoLength()) * 8
+
+	var info [2][2]granuleInfo
+	var main bitWriter
+	for gr := 0; gr < 2; gr++ {
+		for ch := 0; ch < e.channels; ch++ {
+			gi := &info[gr][ch]
+			xr := e.filters[ch].granule(e.buf[ch][gr*granuleSize:])
+			// the bits left are shared by the granules and channels still to be coded
+			budget := available / ((2-gr)*e.channels - ch)
+			if budget > maxPart23Length {
+				budget = maxPart23Length
+			}
+			e.quantize(gi, xr, budget)
+			gi.write(&main, e.bounds)
+			available -= gi.part23Length
+		}
+	}
+
+	frame := make([]byte, size)
+	var header bitWriter
+	e.writeHeader(&header, e.bitrateIndex, padding)
+	e.writeSideInfo(&header, &info)
+	copy(frame, header.buf)
+	copy(frame[len(header.buf):], main.buf)
+
+	e.frames++
+	e.bytes += uint32(size)
+	e.crc = crc16(e.crc, frame)
+	_, err := e.w.Write(frame)
+	return err
+}
+
+// quantize chooses the smallest global gain, and so the finest quantization, whose values fit the budget
+func (e *Encoder) quantize(gi *granuleInfo, xr [granuleSize]float64, budget int) {
+	var xr34 [granuleSize]float64
+	for i, v := range xr[:e.cutoff] {
+		gi.negative[i] = v < 0
+		xr34[i] = math.Pow(math.Abs(v), 0.75)
+	}
+
+	lo, hi := 0, 255
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if gi.quantize(xr34[:], mid) && gi.count(e.bounds) <= budget {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	gi.quantize(xr34[:], lo)
+	gi.count(e.bounds)
+}
+
+// writeHeader writes the frame header
+func (e *Encoder) writeHeader(b *bitWriter, bitrateIndex int, padding int) {
+	b.write(0x1fff, 13) // sync, MPEG-1
+	b.write(1, 2)       // layer III
+	b.write(1, 1)       // no CRC
+	b.write(uint32(bitrateIndex), 4)
+	b.write(uint32(e.rateIndex), 2)
+	b.write(uint32(padding), 1)
+	b.write(0, 1) // private
+	if e.channels == 1 {
+		b.write(3, 2) // single channel
+	} else {
+		b.write(0, 2) // stereo
+	}
+	b.write(0, 2) // mode extension
+	b.write(0, 1) // copyright
+	b.write(0, 1) // original
+	b.write(0, 2) // emphasis
+}
+
+// writeSideInfo writes the side information of the granules
+func (e *Encoder) writeSideInfo(b *bitWriter, info *[2][2]granuleInfo) {
+	b.write(0, 9) // main data begin, as the bit reservoir is not used
+	if e.channels == 1 {
+		b.write(0, 5) // private
+	} else {
+		b.write(0, 3) // private
+	}
+	b.write(0, uint(4*e.channels)) // scalefactor selection
+	for gr := 0; gr < 2; gr++ {
+		for ch := 0; ch < e.channels; ch++ {
+			gi := &info[gr][ch]
+			b.write(uint32(gi.part23Length), 12)
+			b.write(uint32(gi.bigValues), 9)
+			b.write(uint32(gi.globalGain), 8)
+			b.write(0, 4) // scalefactor compression, as every scalefactor is zero
+			b.write(0, 1) // long blocks
+			for _, t := range gi.tableSelect {
+				b.write(uint32(t), 5)
+			}
+			b.write(uint32(gi.region0Count), 4)
+			b.write(uint32(gi.region1Count), 3)
+			b.write(0, 1) // preemphasis
+			b.write(0, 1) // scalefactor scale
+			b.write(uint32(gi.count1Table), 1)
+		}
+	}
+}
+
+// InfoFrame returns the frame holding the Info tag, which gives the number of frames and the
+// padding of the audio written so far. It is silent when decoded.
+func (e *Encoder) InfoFrame() []byte {
+	// the frame is at the bitrate of the audio if the tag fits, as every other frame is
+	bitrateIndex := e.bitrateIndex
+	for e.frameLength(bitrateIndex) < 4+e.sideInfoLength()+infoSize && bitrateIndex < len(bitrates)-1 {
+		bitrateIndex++
+	}
+	frame := make([]byte, e.frameLength(bitrateIndex))
+	var header bitWriter
+	e.writeHeader(&header, bitrateIndex, 0)
+	copy(frame, header.buf)
+
+	tag := frame[4+e.sideInfoLength():]
+	copy(tag, "Info")
+	if e.frames == 0 {
+		// nothing is known before the audio is written
+		return frame
+	}
+	bytes := e.bytes + uint32(len(frame))
+	binary.BigEndian.PutUint32(tag[4:], 0x0f) // frames, bytes, table of contents and quality
+	binary.BigEndian.PutUint32(tag[8:], e.frames)
+	binary.BigEndian.PutUint32(tag[12:], bytes)
+	for i := 0; i < 100; i++ {
+		// the bitrate is constant, so the table of contents is linear
+		tag[16+i] = byte(i * 256 / 100)
+	}
+	binary.BigEndian.PutUint32(tag[116:], 0) // quality
+
+	// LAME extension
+	lame := tag[120:]
+	copy(lame, encoderName)
+	lame[9] = 1 // revision 0, constant bitrate
+	lame[10] = byte(math.Min(255, float64(e.cutoff*sampleRates[e.rateIndex]/2/granuleSize/100)))
+	lame[20] = byte(math.Min(255, float64(bitrates[e.bitrateIndex])))
+	padding := uint32(e.frames)*FrameSize - Delay - uint32(e.samples)
+	delays := uint32(Delay)<<12 | padding&0xfff
+	lame[21], lame[22], lame[23] = byte(delays>>16), byte(delays>>8), byte(delays)
+	binary.BigEndian.PutUint32(lame[28:], bytes)
+	binary.BigEndian.PutUint16(lame[32:], e.crc)
+	crcPos := len(frame) - len(lame) + 34
+	binary.BigEndian.PutUint16(lame[34:], crc16(0, frame[:crcPos]))
+	return frame
+}
+
+// crc16 updates the CRC-16 used by the LAME extension with the data
+func crc16(crc uint16, data []byte) uint16 {
+	for _, c := range data {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,458 @@
+package mp3
+
+// bitrates are the MPEG-1 Layer III bitrates in kbit/s, by bitrate index
+var bitrates = [...]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+
+// sampleRates are the MPEG-1 sample rates, by sample rate index
+var sampleRates = [...]int{44100, 48000, 32000}
+
+// bandBounds are the boundaries of the long block scalefactor bands, by sample rate index
+var bandBounds = [...][23]int{
+	{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 52, 62, 74, 90, 110, 134, 162, 196, 238, 288, 342, 418, 576},
+	{0, 4, 8, 12, 16, 20, 24, 30, 36, 42, 50, 60, 72, 88, 106, 128, 156, 190, 230, 276, 330, 384, 576},
+	{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 54, 66, 82, 102, 126, 156, 194, 240, 296, 364, 448, 550, 576},
+}
+
+// regionSplits holds the region0_count and region1_count used for a big values region
+// covering the given number of scalefactor bands
+var regionSplits = [...][2]int{
+	{0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 1}, {1, 1}, {1, 1},
+	{1, 2}, {2, 2}, {2, 3}, {2, 3}, {3, 4}, {3, 4}, {3, 4}, {4, 5},
+	{4, 5}, {4, 6}, {5, 6}, {5, 6}, {5, 7}, {6, 7}, {6, 7},
+}
+
+// aliasCoefficients are the coefficients of the alias reduction butterflies
+var aliasCoefficients = [8]float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037}
+
+// analysisWindow holds the first half of the coefficients of the analysis window, up to its centre.
+// The second half mirrors the first, negated except at multiples of 64.
+var analysisWindow = [257]float64{
+	0.000000000, -0.000000477, -0.000000477, -0.000000477, -0.000000477, -0.000000477, -0.000000477, -0.000000954,
+	-0.000000954, -0.000000954, -0.000000954, -0.000001431, -0.000001431, -0.000001907, -0.000001907, -0.000002384,
+	-0.000002384, -0.000002861, -0.000003338, -0.000003338, -0.000003815, -0.000004292, -0.000004768, -0.000005245,
+	-0.000006199, -0.000006676, -0.000007629, -0.000008106, -0.000009060, -0.000010014, -0.000011444, -0.000012398,
+	-0.000013828, -0.000014782, -0.000016689, -0.000018120, -0.000019550, -0.000021458, -0.000023365, -0.000025272,
+	-0.000027657, -0.000030041, -0.000032425, -0.000034809, -0.000037670, -0.000040531, -0.000043392, -0.000046253,
+	-0.000049591, -0.000052929, -0.000055790, -0.000059605, -0.000062943, -0.000066280, -0.000070095, -0.000073433,
+	-0.000076771, -0.000080585, -0.000083923, -0.000087261, -0.000090599, -0.000093460, -0.000096321, -0.000099182,
+	0.000101566, 0.000103951, 0.000105858, 0.000107288, 0.000108242, 0.000108719, 0.000108719, 0.000108242,
+	0.000106812, 0.000105381, 0.000102520, 0.000099182, 0.000095367, 0.000090122, 0.000084400, 0.000077724,
+	0.000069618, 0.000060558, 0.000050545, 0.000039577, 0.000027180, 0.000013828, -0.000000954, -0.000017166,
+	-0.000034332, -0.000052929, -0.000072956, -0.000093937, -0.000116348, -0.000140190, -0.000165462, -0.000191212,
+	-0.000218868, -0.000247478, -0.000277042, -0.000307560, -0.000339031, -0.000371456, -0.000404358, -0.000438213,
+	-0.000472546, -0.000507355, -0.000542164, -0.000576973, -0.000611782, -0.000646591, -0.000680923, -0.000714302,
+	-0.000747204, -0.000779152, -0.000809669, -0.000838757, -0.000866413, -0.000891685, -0.000915051, -0.000935555,
+	-0.000954151, -0.000968933, -0.000980854, -0.000989437, -0.000994205, -0.000995159, -0.000991821, -0.000983715,
+	0.000971317, 0.000953674, 0.000930786, 0.000902653, 0.000868797, 0.000829220, 0.000783920, 0.000731945,
+	0.000674248, 0.000610352, 0.000539303, 0.000462532, 0.000378609, 0.000288486, 0.000191689, 0.000088215,
+	-0.000021458, -0.000137329, -0.000259876, -0.000388145, -0.000522137, -0.000661850, -0.000806808, -0.000956535,
+	-0.001111031, -0.001269817, -0.001432419, -0.001597881, -0.001766682, -0.001937389, -0.002110004, -0.002283096,
+	-0.002457142, -0.002630711, -0.002803326, -0.002974033, -0.003141880, -0.003306866, -0.003467083, -0.003622532,
+	-0.003771782, -0.003914356, -0.004048824, -0.004174709, -0.004290581, -0.004395962, -0.004489899, -0.004570484,
+	-0.004638195, -0.004691124, -0.004728317, -0.004748821, -0.004752159, -0.004737377, -0.004703045, -0.004649162,
+	-0.004573822, -0.004477024, -0.004357815, -0.004215240, -0.004049301, -0.003858566, -0.003643036, -0.003401756,
+	0.003134727, 0.002841473, 0.002521515, 0.002174854, 0.001800537, 0.001399517, 0.000971317, 0.000515938,
+	0.000033379, -0.000475883, -0.001011848, -0.001573563, -0.002161503, -0.002774239, -0.003411293, -0.004072189,
+	-0.004756451, -0.005462170, -0.006189346, -0.006937027, -0.007703304, -0.008487225, -0.009287834, -0.010103703,
+	-0.010933399, -0.011775017, -0.012627602, -0.013489246, -0.014358521, -0.015233517, -0.016112804, -0.016994476,
+	-0.017876148, -0.018756866, -0.019634247, -0.020506859, -0.021372318, -0.022228718, -0.023074150, -0.023907185,
+	-0.024725437, -0.025527000, -0.026310921, -0.027073860, -0.027815342, -0.028532982, -0.029224873, -0.029890060,
+	-0.030526638, -0.031132698, -0.031706810, -0.032248020, -0.032754898, -0.033225536, -0.033659935, -0.034055710,
+	-0.034412861, -0.034730434, -0.035007000, -0.035242081, -0.035435200, -0.035586357, -0.035694122, -0.035758972,
+	0.035780907,
+}
+
+// huffTable is a Huffman table for pairs of values, each below xlen, with larger values
+// escaped by linbits extra bits
+type huffTable struct {
+	xlen    int
+	linbits uint
+	codes   []uint16
+	lengths []uint8
+}
+
+// huffTables are the big values tables, by table number. Tables 0, 4 and 14 are not used.
+var huffTables = [32]huffTable{
+	1:  {2, 0, huffCodes1, huffLengths1},
+	2:  {3, 0, huffCodes2, huffLengths2},
+	3:  {3, 0, huffCodes3, huffLengths3},
+	5:  {4, 0, huffCodes5, huffLengths5},
+	6:  {4, 0, huffCodes6, huffLengths6},
+	7:  {6, 0, huffCodes7, huffLengths7},
+	8:  {6, 0, huffCodes8, huffLengths8},
+	9:  {6, 0, huffCodes9, huffLengths9},
+	10: {8, 0, huffCodes10, huffLengths10},
+	11: {8, 0, huffCodes11, huffLengths11},
+	12: {8, 0, huffCodes12, huffLengths12},
+	13: {16, 0, huffCodes13, huffLengths13},
+	15: {16, 0, huffCodes15, huffLengths15},
+	16: {16, 1, huffCodes16, huffLengths16},
+	17: {16, 2, huffCodes16, huffLengths16},
+	18: {16, 3, huffCodes16, huffLengths16},
+	19: {16, 4, huffCodes16, huffLengths16},
+	20: {16, 6, huffCodes16, huffLengths16},
+	21: {16, 8, huffCodes16, huffLengths16},
+	22: {16, 10, huffCodes16, huffLengths16},
+	23: {16, 13, huffCodes16, huffLengths16},
+	24: {16, 4, huffCodes24, huffLengths24},
+	25: {16, 5, huffCodes24, huffLengths24},
+	26: {16, 6, huffCodes24, huffLengths24},
+	27: {16, 7, huffCodes24, huffLengths24},
+	28: {16, 8, huffCodes24, huffLengths24},
+	29: {16, 9, huffCodes24, huffLengths24},
+	30: {16, 11, huffCodes24, huffLengths24},
+	31: {16, 13, huffCodes24, huffLengths24},
+}
+
+// The Huffman tables hold the code and code length of each pair of values x, y at x*xlen + y
+var huffCodes1 = []uint16{
+	1, 1,
+	1, 0,
+}
+
+var huffLengths1 = []uint8{
+	1, 3,
+	2, 3,
+}
+
+var huffCodes2 = []uint16{
+	1, 2, 1,
+	3, 1, 1,
+	3, 2, 0,
+}
+
+var huffLengths2 = []uint8{
+	1, 3, 6,
+	3, 3, 5,
+	5, 5, 6,
+}
+
+var huffCodes3 = []uint16{
+	3, 2, 1,
+	1, 1, 1,
+	3, 2, 0,
+}
+
+var huffLengths3 = []uint8{
+	2, 2, 6,
+	3, 2, 5,
+	5, 5, 6,
+}
+
+var huffCodes5 = []uint16{
+	1, 2, 6, 5,
+	3, 1, 4, 4,
+	7, 5, 7, 1,
+	6, 1, 1, 0,
+}
+
+var huffLengths5 = []uint8{
+	1, 3, 6, 7,
+	3, 3, 6, 7,
+	6, 6, 7, 8,
+	7, 6, 7, 8,
+}
+
+var huffCodes6 = []uint16{
+	7, 3, 5, 1,
+	6, 2, 3, 2,
+	5, 4, 4, 1,
+	3, 3, 2, 0,
+}
+
+var huffLengths6 = []uint8{
+	3, 3, 5, 7,
+	3, 2, 4, 5,
+	4, 4, 5, 6,
+	6, 5, 6, 7,
+}
+
+var huffCodes7 = []uint16{
+	1, 2, 10, 19, 16, 10,
+	3, 3, 7, 10, 5, 3,
+	11, 4, 13, 17, 8, 4,
+	12, 11, 18, 15, 11, 2,
+	7, 6, 9, 14, 3, 1,
+	6, 4, 5, 3, 2, 0,
+}
+
+var huffLengths7 = []uint8{
+	1, 3, 6, 8, 8, 9,
+	3, 4, 6, 7, 7, 8,
+	6, 5, 7, 8, 8, 9,
+	7, 7, 8, 9, 9, 9,
+	7, 7, 8, 9, 9, 10,
+	8, 8, 9, 10, 10, 10,
+}
+
+var huffCodes8 = []uint16{
+	3, 4, 6, 18, 12, 5,
+	5, 1, 2, 16, 9, 3,
+	7, 3, 5, 14, 7, 3,
+	19, 17, 15, 13, 10, 4,
+	13, 5, 8, 11, 5, 1,
+	12, 4, 4, 1, 1, 0,
+}
+
+var huffLengths8 = []uint8{
+	2, 3, 6, 8, 8, 9,
+	3, 2, 4, 8, 8, 8,
+	6, 4, 6, 8, 8, 9,
+	8, 8, 8, 9, 9, 10,
+	8, 7, 8, 9, 10, 10,
+	9, 8, 9, 9, 11, 11,
+}
+
+var huffCodes9 = []uint16{
+	7, 5, 9, 14, 15, 7,
+	6, 4, 5, 5, 6, 7,
+	7, 6, 8, 8, 8, 5,
+	15, 6, 9, 10, 5, 1,
+	11, 7, 9, 6, 4, 1,
+	14, 4, 6, 2, 6, 0,
+}
+
+var huffLengths9 = []uint8{
+	3, 3, 5, 6, 8, 9,
+	3, 3, 4, 5, 6, 8,
+	4, 4, 5, 6, 7, 8,
+	6, 5, 6, 7, 7, 8,
+	7, 6, 7, 7, 8, 9,
+	8, 7, 8, 8, 9, 9,
+}
+
+var huffCodes10 = []uint16{
+	1, 2, 10, 23, 35, 30, 12, 17,
+	3, 3, 8, 12, 18, 21, 12, 7,
+	11, 9, 15, 21, 32, 40, 19, 6,
+	14, 13, 22, 34, 46, 23, 18, 7,
+	20, 19, 33, 47, 27, 22, 9, 3,
+	31, 22, 41, 26, 21, 20, 5, 3,
+	14, 13, 10, 11, 16, 6, 5, 1,
+	9, 8, 7, 8, 4, 4, 2, 0,
+}
+
+var huffLengths10 = []uint8{
+	1, 3, 6, 8, 9, 9, 9, 10,
+	3, 4, 6, 7, 8, 9, 8, 8,
+	6, 6, 7, 8, 9, 10, 9, 9,
+	7, 7, 8, 9, 10, 10, 9, 10,
+	8, 8, 9, 10, 10, 10, 10, 10,
+	9, 9, 10, 10, 11, 11, 10, 11,
+	8, 8, 9, 10, 10, 10, 11, 11,
+	9, 8, 9, 10, 10, 11, 11, 11,
+}
+
+var huffCodes11 = []uint16{
+	3, 4, 10, 24, 34, 33, 21, 15,
+	5, 3, 4, 10, 32, 17, 11, 10,
+	11, 7, 13, 18, 30, 31, 20, 5,
+	25, 11, 19, 59, 27, 18, 12, 5,
+	35, 33, 31, 58, 30, 16, 7, 5,
+	28, 26, 32, 19, 17, 15, 8, 14,
+	14, 12, 9, 13, 14, 9, 4, 1,
+	11, 4, 6, 6, 6, 3, 2, 0,
+}
+
+var huffLengths11 = []uint8{
+	2, 3, 5, 7, 8, 9, 8, 9,
+	3, 3, 4, 6, 8, 8, 7, 8,
+	5, 5, 6, 7, 8, 9, 8, 8,
+	7, 6, 7, 9, 8, 10, 8, 9,
+	8, 8, 8, 9, 9, 10, 9, 10,
+	8, 8, 9, 10, 10, 11, 10, 11,
+	8, 7, 7, 8, 9, 10, 10, 10,
+	8, 7, 8, 9, 10, 10, 10, 10,
+}
+
+var huffCodes12 = []uint16{
+	9, 6, 16, 33, 41, 39, 38, 26,
+	7, 5, 6, 9, 23, 16, 26, 11,
+	17, 7, 11, 14, 21, 30, 10, 7,
+	17, 10, 15, 12, 18, 28, 14, 5,
+	32, 13, 22, 19, 18, 16, 9, 5,
+	40, 17, 31, 29, 17, 13, 4, 2,
+	27, 12, 11, 15, 10, 7, 4, 1,
+	27, 12, 8, 12, 6, 3, 1, 0,
+}
+
+var huffLengths12 = []uint8{
+	4, 3, 5, 7, 8, 9, 9, 9,
+	3, 3, 4, 5, 7, 7, 8, 8,
+	5, 4, 5, 6, 7, 8, 7, 8,
+	6, 5, 6, 6, 7, 8, 8, 8,
+	7, 6, 7, 7, 8, 8, 8, 9,
+	8, 7, 8, 8, 8, 9, 8, 9,
+	8, 7, 7, 8, 8, 9, 9, 10,
+	9, 8, 8, 9, 9, 9, 9, 10,
+}
+
+var huffCodes13 = []uint16{
+	1, 5, 14, 21, 34, 51, 46, 71, 42, 52, 68, 52, 67, 44, 43, 19,
+	3, 4, 12, 19, 31, 26, 44, 33, 31, 24, 32, 24, 31, 35, 22, 14,
+	15, 13, 23, 36, 59, 49, 77, 65, 29, 40, 30, 40, 27, 33, 42, 16,
+	22, 20, 37, 61, 56, 79, 73, 64, 43, 76, 56, 37, 26, 31, 25, 14,
+	35, 16, 60, 57, 97, 75, 114, 91, 54, 73, 55, 41, 48, 53, 23, 24,
+	58, 27, 50, 96, 76, 70, 93, 84, 77, 58, 79, 29, 74, 49, 41, 17,
+	47, 45, 78, 74, 115, 94, 90, 79, 69, 83, 71, 50, 59, 38, 36, 15,
+	72, 34, 56, 95, 92, 85, 91, 90, 86, 73, 77, 65, 51, 44, 43, 42,
+	43, 20, 30, 44, 55, 78, 72, 87, 78, 61, 46, 54, 37, 30, 20, 16,
+	53, 25, 41, 37, 44, 59, 54, 81, 66, 76, 57, 54, 37, 18, 39, 11,
+	35, 33, 31, 57, 42, 82, 72, 80, 47, 58, 55, 21, 22, 26, 38, 22,
+	53, 25, 23, 38, 70, 60, 51, 36, 55, 26, 34, 23, 27, 14, 9, 7,
+	34, 32, 28, 39, 49, 75, 30, 52, 48, 40, 52, 28, 18, 17, 9, 5,
+	45, 21, 34, 64, 56, 50, 49, 45, 31, 19, 12, 15, 10, 7, 6, 3,
+	48, 23, 20, 39, 36, 35, 53, 21, 16, 23, 13, 10, 6, 1, 4, 2,
+	16, 15, 17, 27, 25, 20, 29, 11, 17, 12, 16, 8, 1, 1, 0, 1,
+}
+
+var huffLengths13 = []uint8{
+	1, 4, 6, 7, 8, 9, 9, 10, 9, 10, 11, 11, 12, 12, 13, 13,
+	3, 4, 6, 7, 8, 8, 9, 9, 9, 9, 10, 10, 11, 12, 12, 12,
+	6, 6, 7, 8, 9, 9, 10, 10, 9, 10, 10, 11, 11, 12, 13, 13,
+	7, 7, 8, 9, 9, 10, 10, 10, 10, 11, 11, 11, 11, 12, 13, 13,
+	8, 7, 9, 9, 10, 10, 11, 11, 10, 11, 11, 12, 12, 13, 13, 14,
+	9, 8, 9, 10, 10, 10, 11, 11, 11, 11, 12, 11, 13, 13, 14, 14,
+	9, 9, 10, 10, 11, 11, 11, 11, 11, 12, 12, 12, 13, 13, 14, 14,
+	10, 9, 10, 11, 11, 11, 12, 12, 12, 12, 13, 13, 13, 14, 16, 16,
+	9, 8, 9, 10, 10, 11, 11, 12, 12, 12, 12, 13, 13, 14, 15, 15,
+	10, 9, 10, 10, 11, 11, 11, 13, 12, 13, 13, 14, 14, 14, 16, 15,
+	10, 10, 10, 11, 11, 12, 12, 13, 12, 13, 14, 13, 14, 15, 16, 17,
+	11, 10, 10, 11, 12, 12, 12, 12, 13, 13, 13, 14, 15, 15, 15, 16,
+	11, 11, 11, 12, 12, 13, 12, 13, 14, 14, 15, 15, 15, 16, 16, 16,
+	12, 11, 12, 13, 13, 13, 14, 14, 14, 14, 14, 15, 16, 15, 16, 16,
+	13, 12, 12, 13, 13, 13, 15, 14, 14, 17, 15, 15, 15, 17, 16, 16,
+	12, 12, 13, 14, 14, 14, 15, 14, 15, 15, 16, 16, 19, 18, 19, 16,
+}
+
+var huffCodes15 = []uint16{
+	7, 12, 18, 53, 47, 76, 124, 108, 89, 123, 108, 119, 107, 81, 122, 63,
+	13, 5, 16, 27, 46, 36, 61, 51, 42, 70, 52, 83, 65, 41, 59, 36,
+	19, 17, 15, 24, 41, 34, 59, 48, 40, 64, 50, 78, 62, 80, 56, 33,
+	29, 28, 25, 43, 39, 63, 55, 93, 76, 59, 93, 72, 54, 75, 50, 29,
+	52, 22, 42, 40, 67, 57, 95, 79, 72, 57, 89, 69, 49, 66, 46, 27,
+	77, 37, 35, 66, 58, 52, 91, 74, 62, 48, 79, 63, 90, 62, 40, 38,
+	125, 32, 60, 56, 50, 92, 78, 65, 55, 87, 71, 51, 73, 51, 70, 30,
+	109, 53, 49, 94, 88, 75, 66, 122, 91, 73, 56, 42, 64, 44, 21, 25,
+	90, 43, 41, 77, 73, 63, 56, 92, 77, 66, 47, 67, 48, 53, 36, 20,
+	71, 34, 67, 60, 58, 49, 88, 76, 67, 106, 71, 54, 38, 39, 23, 15,
+	109, 53, 51, 47, 90, 82, 58, 57, 48, 72, 57, 41, 23, 27, 62, 9,
+	86, 42, 40, 37, 70, 64, 52, 43, 70, 55, 42, 25, 29, 18, 11, 11,
+	118, 68, 30, 55, 50, 46, 74, 65, 49, 39, 24, 16, 22, 13, 14, 7,
+	91, 44, 39, 38, 34, 63, 52, 45, 31, 52, 28, 19, 14, 8, 9, 3,
+	123, 60, 58, 53, 47, 43, 32, 22, 37, 24, 17, 12, 15, 10, 2, 1,
+	71, 37, 34, 30, 28, 20, 17, 26, 21, 16, 10, 6, 8, 6, 2, 0,
+}
+
+var huffLengths15 = []uint8{
+	3, 4, 5, 7, 7, 8, 9, 9, 9, 10, 10, 11, 11, 11, 12, 13,
+	4, 3, 5, 6, 7, 7, 8, 8, 8, 9, 9, 10, 10, 10, 11, 11,
+	5, 5, 5, 6, 7, 7, 8, 8, 8, 9, 9, 10, 10, 11, 11, 11,
+	6, 6, 6, 7, 7, 8, 8, 9, 9, 9, 10, 10, 10, 11, 11, 11,
+	7, 6, 7, 7, 8, 8, 9, 9, 9, 9, 10, 10, 10, 11, 11, 11,
+	8, 7, 7, 8, 8, 8, 9, 9, 9, 9, 10, 10, 11, 11, 11, 12,
+	9, 7, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 11, 11, 12, 12,
+	9, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 10, 11, 11, 11, 12,
+	9, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 11, 11, 12, 12, 12,
+	9, 8, 9, 9, 9, 9, 10, 10, 10, 11, 11, 11, 11, 12, 12, 12,
+	10, 9, 9, 9, 10, 10, 10, 10, 10, 11, 11, 11, 11, 12, 13, 12,
+	10, 9, 9, 9, 10, 10, 10, 10, 11, 11, 11, 11, 12, 12, 12, 13,
+	11, 10, 9, 10, 10, 10, 11, 11, 11, 11, 11, 11, 12, 12, 13, 13,
+	11, 10, 10, 10, 10, 11, 11, 11, 11, 12, 12, 12, 12, 12, 13, 13,
+	12, 11, 11, 11, 11, 11, 11, 11, 12, 12, 12, 12, 13, 13, 12, 13,
+	12, 11, 11, 11, 11, 11, 11, 12, 12, 12, 12, 12, 13, 13, 13, 13,
+}
+
+var huffCodes16 = []uint16{
+	1, 5, 14, 44, 74, 63, 110, 93, 172, 149, 138, 242, 225, 195, 376, 17,
+	3, 4, 12, 20, 35, 62, 53, 47, 83, 75, 68, 119, 201, 107, 207, 9,
+	15, 13, 23, 38, 67, 58, 103, 90, 161, 72, 127, 117, 110, 209, 206, 16,
+	45, 21, 39, 69, 64, 114, 99, 87, 158, 140, 252, 212, 199, 387, 365, 26,
+	75, 36, 68, 65, 115, 101, 179, 164, 155, 264, 246, 226, 395, 382, 362, 9,
+	66, 30, 59, 56, 102, 185, 173, 265, 142, 253, 232, 400, 388, 378, 445, 16,
+	111, 54, 52, 100, 184, 178, 160, 133, 257, 244, 228, 217, 385, 366, 715, 10,
+	98, 48, 91, 88, 165, 157, 148, 261, 248, 407, 397, 372, 380, 889, 884, 8,
+	85, 84, 81, 159, 156, 143, 260, 249, 427, 401, 392, 383, 727, 713, 708, 7,
+	154, 76, 73, 141, 131, 256, 245, 426, 406, 394, 384, 735, 359, 710, 352, 11,
+	139, 129, 67, 125, 247, 233, 229, 219, 393, 743, 737, 720, 885, 882, 439, 4,
+	243, 120, 118, 115, 227, 223, 396, 746, 742, 736, 721, 712, 706, 223, 436, 6,
+	202, 224, 222, 218, 216, 389, 386, 381, 364, 888, 443, 707, 440, 437, 1728, 4,
+	747, 211, 210, 208, 370, 379, 734, 723, 714, 1735, 883, 877, 876, 3459, 865, 2,
+	377, 369, 102, 187, 726, 722, 358, 711, 709, 866, 1734, 871, 3458, 870, 434, 0,
+	12, 10, 7, 11, 10, 17, 11, 9, 13, 12, 10, 7, 5, 3, 1, 3,
+}
+
+var huffLengths16 = []uint8{
+	1, 4, 6, 8, 9, 9, 10, 10, 11, 11, 11, 12, 12, 12, 13, 9,
+	3, 4, 6, 7, 8, 9, 9, 9, 10, 10, 10, 11, 12, 11, 12, 8,
+	6, 6, 7, 8, 9, 9, 10, 10, 11, 10, 11, 11, 11, 12, 12, 9,
+	8, 7, 8, 9, 9, 10, 10, 10, 11, 11, 12, 12, 12, 13, 13, 10,
+	9, 8, 9, 9, 10, 10, 11, 11, 11, 12, 12, 12, 13, 13, 13, 9,
+	9, 8, 9, 9, 10, 11, 11, 12, 11, 12, 12, 13, 13, 13, 14, 10,
+	10, 9, 9, 10, 11, 11, 11, 11, 12, 12, 12, 12, 13, 13, 14, 10,
+	10, 9, 10, 10, 11, 11, 11, 12, 12, 13, 13, 13, 13, 15, 15, 10,
+	10, 10, 10, 11, 11, 11, 12, 12, 13, 13, 13, 13, 14, 14, 14, 10,
+	11, 10, 10, 11, 11, 12, 12, 13, 13, 13, 13, 14, 13, 14, 13, 11,
+	11, 11, 10, 11, 12, 12, 12, 12, 13, 14, 14, 14, 15, 15, 14, 10,
+	12, 11, 11, 11, 12, 12, 13, 14, 14, 14, 14, 14, 14, 13, 14, 11,
+	12, 12, 12, 12, 12, 13, 13, 13, 13, 15, 14, 14, 14, 14, 16, 11,
+	14, 12, 12, 12, 13, 13, 14, 14, 14, 16, 15, 15, 15, 17, 15, 11,
+	13, 13, 11, 12, 14, 14, 13, 14, 14, 15, 16, 15, 17, 15, 14, 11,
+	9, 8, 8, 9, 9, 10, 10, 10, 11, 11, 11, 11, 11, 11, 11, 8,
+}
+
+var huffCodes24 = []uint16{
+	15, 13, 46, 80, 146, 262, 248, 434, 426, 669, 653, 649, 621, 517, 1032, 88,
+	14, 12, 21, 38, 71, 130, 122, 216, 209, 198, 327, 345, 319, 297, 279, 42,
+	47, 22, 41, 74, 68, 128, 120, 221, 207, 194, 182, 340, 315, 295, 541, 18,
+	81, 39, 75, 70, 134, 125, 116, 220, 204, 190, 178, 325, 311, 293, 271, 16,
+	147, 72, 69, 135, 127, 118, 112, 210, 200, 188, 352, 323, 306, 285, 540, 14,
+	263, 66, 129, 126, 119, 114, 214, 202, 192, 180, 341, 317, 301, 281, 262, 12,
+	249, 123, 121, 117, 113, 215, 206, 195, 185, 347, 330, 308, 291, 272, 520, 10,
+	435, 115, 111, 109, 211, 203, 196, 187, 353, 332, 313, 298, 283, 531, 381, 17,
+	427, 212, 208, 205, 201, 193, 186, 177, 169, 320, 303, 286, 268, 514, 377, 16,
+	335, 199, 197, 191, 189, 181, 174, 333, 321, 305, 289, 275, 521, 379, 371, 11,
+	668, 184, 183, 179, 175, 344, 331, 314, 304, 290, 277, 530, 383, 373, 366, 10,
+	652, 346, 171, 168, 164, 318, 309, 299, 287, 276, 263, 513, 375, 368, 362, 6,
+	648, 322, 316, 312, 307, 302, 292, 284, 269, 261, 512, 376, 370, 364, 359, 4,
+	620, 300, 296, 294, 288, 282, 273, 266, 515, 380, 374, 369, 365, 361, 357, 2,
+	1033, 280, 278, 274, 267, 264, 259, 382, 378, 372, 367, 363, 360, 358, 356, 0,
+	43, 20, 19, 17, 15, 13, 11, 9, 7, 6, 4, 7, 5, 3, 1, 3,
+}
+
+var huffLengths24 = []uint8{
+	4, 4, 6, 7, 8, 9, 9, 10, 10, 11, 11, 11, 11, 11, 12, 9,
+	4, 4, 5, 6, 7, 8, 8, 9, 9, 9, 10, 10, 10, 10, 10, 8,
+	6, 5, 6, 7, 7, 8, 8, 9, 9, 9, 9, 10, 10, 10, 11, 7,
+	7, 6, 7, 7, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 7,
+	8, 7, 7, 8, 8, 8, 8, 9, 9, 9, 10, 10, 10, 10, 11, 7,
+	9, 7, 8, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 10, 7,
+	9, 8, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 10, 11, 7,
+	10, 8, 8, 8, 9, 9, 9, 9, 10, 10, 10, 10, 10, 11, 11, 8,
+	10, 9, 9, 9, 9, 9, 9, 9, 9, 10, 10, 10, 10, 11, 11, 8,
+	10, 9, 9, 9, 9, 9, 9, 10, 10, 10, 10, 10, 11, 11, 11, 8,
+	11, 9, 9, 9, 9, 10, 10, 10, 10, 10, 10, 11, 11, 11, 11, 8,
+	11, 10, 9, 9, 9, 10, 10, 10, 10, 10, 10, 11, 11, 11, 11, 8,
+	11, 10, 10, 10, 10, 10, 10, 10, 10, 10, 11, 11, 11, 11, 11, 8,
+	11, 10, 10, 10, 10, 10, 10, 10, 11, 11, 11, 11, 11, 11, 11, 8,
+	12, 10, 10, 10, 10, 10, 10, 11, 11, 11, 11, 11, 11, 11, 11, 8,
+	8, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 8, 8, 8, 8, 4,
+}
+
+// quadCodesA and quadLengthsA are count1 table A, indexed by v<<3 | w<<2 | x<<1 | y
+var quadCodesA = []uint8{
+	1, 5, 4, 5, 6, 5, 4, 4, 7, 3, 6, 0, 7, 2, 3, 1,
+}
+
+var quadLengthsA = []uint8{
+	1, 4, 4, 5, 4, 6, 5, 6, 4, 5, 5, 6, 5, 6, 6, 6,
+}
+
+// quadCodesB and quadLengthsB are count1 table B
+var quadCodesB = []uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+}
+
+var quadLengthsB = []uint8{
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+}
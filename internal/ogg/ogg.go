@@ -0,0 +1,174 @@
+// Package ogg writes Ogg bitstreams, framing packets into pages
+package ogg
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	headerSize     = 27
+	maxSegments    = 255
+	maxSegmentSize = 255
+
+	// pageTargetSize is the amount of packet data after which a page is written
+	pageTargetSize = 4096
+
+	flagContinued = 0x01
+	flagBOS       = 0x02
+	flagEOS       = 0x04
+)
+
+// NoGranule is the granule position of a page on which no packet ends
+const NoGranule = ^uint64(0)
+
+// Writer frames packets of a single logical bitstream into Ogg pages
+type Writer struct {
+	w      io.Writer
+	serial uint32
+	seq    uint32
+
+	// the packet data and lacing values of the page being built
+	data    []byte
+	lacing  []byte
+	granule uint64
+	// last is the granule position of the last packet
+	last uint64
+	// continued is true if the page starts with the rest of a packet from the previous page
+	continued bool
+	bos       bool
+}
+
+// NewWriter returns a writer for the logical bitstream with the serial number
+func NewWriter(w io.Writer, serial uint32) *Writer {
+	return &Writer{
+		w:       w,
+		serial:  serial,
+		granule: NoGranule,
+		bos:     true,
+	}
+}
+
+// WritePacket adds a packet, which ends at the granule position, to the current page.
+// The page is written once it is full, when the next packet is added.
+func (o *Writer) WritePacket(packet []byte, granule uint64) error {
+	if len(o.lacing) == maxSegments || len(o.data) >= pageTargetSize {
+		if err := o.Flush(); err != nil {
+			return err
+		}
+	}
+	for {
+		// a packet is laced as a run of full segments, ended by a shorter one
+		n := len(packet)
+		if n > maxSegmentSize {
+			n = maxSegmentSize
+		}
+		o.lacing = append(o.lacing, byte(n))
+		o.data = append(o.data, packet[:n]...)
+		packet = packet[n:]
+		if n < maxSegmentSize {
+			break
+		}
+		if len(o.lacing) == maxSegments {
+			// the packet continues on the next page
+			if err := o.writePage(0); err != nil {
+				return err
+			}
+			o.continued = true
+		}
+	}
+	o.granule = granule
+	o.last = granule
+	return nil
+}
+
+// Flush writes the current page, if it holds any data, so the next packet starts a new page
+func (o *Writer) Flush() error {
+	if len(o.lacing) == 0 {
+		return nil
+	}
+	return o.writePage(0)
+}
+
+// Close writes the current page as the last page of the bitstream
+func (o *Writer) Close() error {
+	if len(o.lacing) == 0 {
+		// the empty last page ends where the last packet did
+		o.granule = o.last
+	}
+	return o.writePage(flagEOS)
+}
+
+func (o *Writer) writePage(flags byte) error {
+	if o.continued {
+		flags |= flagContinued
+	}
+	if o.bos {
+		flags |= flagBOS
+	}
+	page := buildPage(o.serial, o.seq, o.granule, flags, o.lacing, o.data)
+
+	o.seq++
+	o.bos = false
+	o.continued = false
+	o.data = o.data[:0]
+	o.lacing = o.lacing[:0]
+	o.granule = NoGranule
+	_, err := o.w.Write(page)
+	return err
+}
+
+// FirstPage returns the first page of the bitstream with the serial number, holding only the packet,
+// as written by a Writer flushed after a first packet at granule 0. It lets the first packet be
+// rewritten once the bitstream is complete, if its size is unchanged.
+func FirstPage(serial uint32, packet []byte) []byte {
+	var lacing []byte
+	for n := len(packet); ; n -= maxSegmentSize {
+		if n < maxSegmentSize {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, maxSegmentSize)
+	}
+	return buildPage(serial, 0, 0, flagBOS, lacing, packet)
+}
+
+func buildPage(serial uint32, seq uint32, granule uint64, flags byte, lacing []byte, data []byte) []byte {
+	page := make([]byte, headerSize, headerSize+len(lacing)+len(data))
+	copy(page, "OggS")                               // CapturePattern
+	page[4] = 0                                      // Version
+	page[5] = flags                                  // HeaderType
+	binary.LittleEndian.PutUint64(page[6:], granule) // GranulePosition
+	binary.LittleEndian.PutUint32(page[14:], serial) // BitstreamSerialNumber
+	binary.LittleEndian.PutUint32(page[18:], seq)    // PageSequenceNumber
+	page[26] = byte(len(lacing))                     // PageSegments
+	page = append(page, lacing...)
+	page = append(page, data...)
+	binary.LittleEndian.PutUint32(page[22:], crc(page)) // Checksum
+	return page
+}
+
+var crcTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+// crc returns the Ogg checksum of the page, whose checksum field is zero
+func crc(page []byte) uint32 {
+	var c uint32
+	for _, b := range page {
+		c = c<<8 ^ crcTable[byte(c>>24)^b]
+	}
+	return c
+}
@@ -4,22 +4,84 @@ package pulseaudio
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/jfreymuth/pulse"
 	"github.com/jfreymuth/pulse/proto"
 )
 
+// MaxSampleRate is the highest sample rate supported by PulseAudio
+const MaxSampleRate = 384000
+
+var (
+	// ErrUnsupportedChannels is returned when the channel count has no PulseAudio channel map
+	ErrUnsupportedChannels = errors.New("unsupported channel count")
+	// ErrUnsupportedFormat is returned when the sample format cannot be played
+	ErrUnsupportedFormat = errors.New("unsupported sample format")
+)
+
+// Format is a PulseAudio sample format
+type Format byte
+
+// sample formats accepted by New
+const (
+	FormatUint8     = Format(proto.FormatUint8)
+	FormatInt16LE   = Format(proto.FormatInt16LE)
+	FormatFloat32LE = Format(proto.FormatFloat32LE)
+	FormatInt32LE   = Format(proto.FormatInt32LE)
+	// FormatInt24LE is PA_SAMPLE_S24LE. The client library does not support it,
+	// so packed 24-bit samples are widened and sent as FormatInt32LE.
+	FormatInt24LE = Format(9)
+)
+
+// sampleSize returns the number of bytes in each sample of the format
+func (f Format) sampleSize() int {
+	switch f {
+	case FormatUint8:
+		return 1
+	case FormatInt16LE:
+		return 2
+	case FormatInt24LE:
+		return 3
+	case FormatFloat32LE, FormatInt32LE:
+		return 4
+	default:
+		return 0
+	}
+}
+
 type Client struct {
-	pc    *pulse.Client
-	chmap proto.ChannelMap
-	strm  *pulse.PlaybackStream
-	ch    chan []byte
-	r     bytes.Buffer
+	pc        *pulse.Client
+	chmap     proto.ChannelMap
+	strm      *pulse.PlaybackStream
+	ch        chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	r         bytes.Buffer
+	frameSize int
+	widen24   bool
+	primed    int64
+	rendered  int64
+	discarded int64
+}
+
+// Timing is the playback timing of the stream, in frames
+type Timing struct {
+	// Rendered is the number of frames handed to Output
+	Rendered uint64
+	// Played is the number of frames that have been played by the sink
+	Played uint64
+	// Latency is the delay between a frame being handed to Output and it being played
+	Latency time.Duration
 }
 
-func New(appName string, sampleRate int, channels int, bitsPerSample int) (*Client, error) {
-	pa := Client{}
+func New(appName string, sampleRate int, channels int, format Format) (*Client, error) {
+	var pa Client
 
 	switch channels {
 	case 1:
@@ -28,15 +90,20 @@ func New(appName string, sampleRate int, channels int, bitsPerSample int) (*Clie
 		pa.chmap = append(pa.chmap, proto.ChannelLeft, proto.ChannelRight)
 	case 4:
 		pa.chmap = append(pa.chmap, proto.ChannelFrontLeft, proto.ChannelFrontRight, proto.ChannelRearLeft, proto.ChannelRearRight)
+	default:
+		return nil, ErrUnsupportedChannels
 	}
 
-	var r pulse.Reader
-	switch bitsPerSample {
-	case 8:
-		r = pulse.NewReader(&pa, proto.FormatUint8)
-	case 16:
-		r = pulse.NewReader(&pa, proto.FormatInt16LE)
+	if format.sampleSize() == 0 {
+		return nil, ErrUnsupportedFormat
 	}
+	streamFormat := format
+	if format == FormatInt24LE {
+		pa.widen24 = true
+		streamFormat = FormatInt32LE
+	}
+	pa.frameSize = channels * streamFormat.sampleSize()
+	r := pulse.NewReader(&pa, byte(streamFormat))
 
 	c, err := pulse.NewClient(pulse.ClientApplicationName(appName))
 	if err != nil {
@@ -45,6 +112,7 @@ func New(appName string, sampleRate int, channels int, bitsPerSample int) (*Clie
 	pa.pc = c
 
 	pa.ch = make(chan []byte)
+	pa.done = make(chan struct{})
 
 	strm, err := c.NewPlayback(r,
 		pulse.PlaybackSampleRate(sampleRate),
@@ -52,42 +120,172 @@ func New(appName string, sampleRate int, channels int, bitsPerSample int) (*Clie
 		pulse.PlaybackChannels(pa.chmap))
 	if err != nil {
 		c.Close()
-		close(pa.ch)
+		close(pa.done)
 		return nil, err
 	}
 	pa.strm = strm
 	// we need to prime the buffer with empty data, otherwise it'll stall out
-	pa.r.Write(make([]byte, pa.strm.BufferSizeBytes()))
+	pa.primed = int64(pa.strm.BufferSizeBytes())
+	pa.r.Write(make([]byte, pa.primed))
 	pa.strm.Start()
 
 	return &pa, nil
 }
 
-func (pa *Client) Output(data []byte) {
-	pa.ch <- data
+// Probe checks that a PulseAudio server is reachable
+func Probe(appName string) error {
+	c, err := pulse.NewClient(pulse.ClientApplicationName(appName))
+	if err != nil {
+		return err
+	}
+	c.Close()
+	return nil
+}
+
+// Output queues the data for playback, waiting until the server asks for it.
+// It returns early if the context is done or the client is closed, in which case the data is not played.
+func (pa *Client) Output(ctx context.Context, data []byte) error {
+	if pa.widen24 {
+		data = widenInt24(data)
+	}
+	pa.mu.Lock()
+	pa.rendered += int64(len(data))
+	pa.mu.Unlock()
+	select {
+	case pa.ch <- data:
+		return nil
+	case <-ctx.Done():
+		pa.discard(len(data))
+		return ctx.Err()
+	case <-pa.done:
+		pa.discard(len(data))
+		return io.ErrClosedPipe
+	}
+}
+
+// discard counts bytes that were rendered but will never reach the server
+func (pa *Client) discard(n int) {
+	pa.mu.Lock()
+	pa.discarded += int64(n)
+	pa.mu.Unlock()
+}
+
+// widenInt24 converts packed 24-bit samples to 32-bit samples
+func widenInt24(data []byte) []byte {
+	out := make([]byte, len(data)/3*4)
+	for i, o := 0, 0; i+3 <= len(data); i, o = i+3, o+4 {
+		out[o+1] = data[i]
+		out[o+2] = data[i+1]
+		out[o+3] = data[i+2]
+	}
+	return out
 }
 
 func (pa *Client) Read(p []byte) (int, error) {
 	needed := len(p)
 	for {
+		pa.mu.Lock()
 		if pa.r.Len() >= needed {
-			return pa.r.Read(p)
+			n, err := pa.r.Read(p)
+			pa.mu.Unlock()
+			return n, err
 		}
-		buf, ok := <-pa.ch
-		if !ok {
+		pa.mu.Unlock()
+		var buf []byte
+		select {
+		case buf = <-pa.ch:
+		case <-pa.done:
 			return 0, io.ErrClosedPipe
 		}
+		pa.mu.Lock()
 		pa.r = *bytes.NewBuffer(pa.r.Bytes())
 		pa.r.Write(buf)
+		pa.mu.Unlock()
+	}
+}
+
+// Pause corks the playback stream
+func (pa *Client) Pause() {
+	pa.strm.Pause()
+}
+
+// Resume uncorks the playback stream
+func (pa *Client) Resume() {
+	pa.strm.Resume()
+}
+
+// Flush discards the audio buffered locally and on the server,
+// including the data of an Output call waiting for the server
+func (pa *Client) Flush() error {
+	select {
+	case buf := <-pa.ch:
+		pa.discard(len(buf))
+	default:
+	}
+	pa.mu.Lock()
+	pa.discarded += int64(pa.r.Len())
+	pa.r.Reset()
+	pa.mu.Unlock()
+	return pa.pc.RawRequest(&proto.FlushPlaybackStream{
+		StreamIndex: pa.strm.StreamIndex(),
+	}, nil)
+}
+
+// Timing queries the server for the current playback timing of the stream
+func (pa *Client) Timing() (Timing, error) {
+	var rpl proto.GetPlaybackLatencyReply
+	now := time.Now()
+	if err := pa.pc.RawRequest(&proto.GetPlaybackLatency{
+		StreamIndex: pa.strm.StreamIndex(),
+		Time: proto.Time{
+			Seconds:      uint32(now.Unix()),
+			Microseconds: uint32(now.Nanosecond() / 1000),
+		},
+	}, &rpl); err != nil {
+		return Timing{}, err
+	}
+	return pa.timing(rpl.ReadIndex, rpl.Latency, int64(pa.strm.SampleRate())), nil
+}
+
+// timing returns the playback timing of the stream, from the read index of the server buffer and
+// the latency of the sink reported by the server
+func (pa *Client) timing(readIndex int64, sinkLatency proto.Microseconds, sampleRate int64) Timing {
+	pa.mu.Lock()
+	rendered := pa.rendered
+	discarded := pa.discarded
+	pa.mu.Unlock()
+
+	// bytes read from the server buffer that have not yet left the sink
+	sinkBytes := int64(sinkLatency) * sampleRate / int64(time.Second/time.Microsecond) * int64(pa.frameSize)
+	// the priming silence is not part of the rendered audio, but locally
+	// flushed audio never reached the server, so count it as played
+	played := readIndex - sinkBytes - pa.primed + discarded
+	if played < 0 {
+		played = 0
+	}
+	if played > rendered {
+		played = rendered
+	}
+
+	t := Timing{
+		Rendered: uint64(rendered / int64(pa.frameSize)),
+		Played:   uint64(played / int64(pa.frameSize)),
+	}
+	if sampleRate > 0 {
+		t.Latency = time.Duration(t.Rendered-t.Played) * time.Second / time.Duration(sampleRate)
 	}
+	return t
 }
 
+// Close closes the stream, causing any waiting Output call to return
 func (pa *Client) Close() {
+	pa.closeOnce.Do(func() {
+		close(pa.done)
+	})
 	if pa.strm != nil {
 		pa.strm.Close()
 	}
 	if pa.pc != nil {
 		pa.pc.Close()
 	}
-	close(pa.ch)
 }
@@ -0,0 +1,45 @@
+// +build linux pulseaudio
+
+package pulseaudio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestTiming(t *testing.T) {
+	const (
+		rate      = 44100
+		frameSize = 4
+		// primed is 100ms of silence written before the stream starts
+		primed = rate / 10 * frameSize
+	)
+	for _, tc := range []struct {
+		name        string
+		rendered    int64
+		discarded   int64
+		readIndex   int64
+		sinkLatency proto.Microseconds
+		want        Timing
+	}{
+		{"nothing read past the priming", rate * frameSize, 0, primed, 0,
+			Timing{Rendered: rate, Played: 0, Latency: time.Second}},
+		// 22050 frames have been read, of which 50ms (2205 frames) are still in the sink
+		{"read by the sink", rate * frameSize, 0, primed + (22050+2205)*frameSize, 50000,
+			Timing{Rendered: rate, Played: 22050, Latency: 500 * time.Millisecond}},
+		{"still playing the priming", rate * frameSize, 0, primed / 2, 50000,
+			Timing{Rendered: rate, Played: 0, Latency: time.Second}},
+		// 400 of the 1000 frames were flushed before reaching the server, and the rest were played
+		{"flushed", 1000 * frameSize, 400 * frameSize, primed + 600*frameSize, 0,
+			Timing{Rendered: 1000, Played: 1000, Latency: 0}},
+		{"read past the rendered audio", 1000 * frameSize, 0, primed + 2000*frameSize, 0,
+			Timing{Rendered: 1000, Played: 1000, Latency: 0}},
+	} {
+		pa := Client{frameSize: frameSize, primed: primed, rendered: tc.rendered, discarded: tc.discarded}
+		if got := pa.timing(tc.readIndex, tc.sinkLatency, rate); got != tc.want {
+			t.Errorf("%s: %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package vorbis
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// bitWriter packs values into bytes, least significant bit first, as Vorbis packets are read
+type bitWriter struct {
+	buf  []byte
+	bits uint
+}
+
+// write writes the low n bits of v
+func (b *bitWriter) write(v uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		if b.bits%8 == 0 {
+			b.buf = append(b.buf, 0)
+		}
+		if v>>i&1 != 0 {
+			b.buf[len(b.buf)-1] |= 1 << (b.bits % 8)
+		}
+		b.bits++
+	}
+}
+
+func (b *bitWriter) writeBool(v bool) {
+	if v {
+		b.write(1, 1)
+	} else {
+		b.write(0, 1)
+	}
+}
+
+func (b *bitWriter) writeBytes(p []byte) {
+	for _, c := range p {
+		b.write(uint32(c), 8)
+	}
+}
+
+// writeBits writes the bits written to o
+func (b *bitWriter) writeBits(o *bitWriter) {
+	for i := uint(0); i < o.bits; i++ {
+		b.write(uint32(o.buf[i/8]>>(i%8)), 1)
+	}
+}
+
+// bytes returns the packed data, with the last byte padded with zero bits
+func (b *bitWriter) bytes() []byte {
+	return b.buf
+}
+
+// ilog returns the number of bits needed to hold v
+func ilog(v int) uint {
+	n := uint(0)
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+// codebook is a Huffman codebook, optionally mapping each entry to a vector
+// on a regular lattice (lookup type 1)
+type codebook struct {
+	dimensions int
+	lengths    []uint8
+	codewords  []uint32
+
+	// the lattice holds values minimum + i*delta, for i in [0, values)
+	lookup  bool
+	values  int
+	minimum int
+	delta   int
+}
+
+// newScalarCodebook returns a codebook of entries without vectors, with code lengths fitted to the weights.
+// The dimensions are only used by classbooks, where they are the number of classes held by each entry.
+func newScalarCodebook(dimensions int, weights []float64) *codebook {
+	c := &codebook{
+		dimensions: dimensions,
+		lengths:    huffmanLengths(weights),
+	}
+	c.codewords = codewords(c.lengths)
+	return c
+}
+
+// newLatticeCodebook returns a codebook of vectors with the values minimum + i*delta, for i in [0, values).
+// The code lengths are fitted to the weight of each value, which are independent in each dimension.
+func newLatticeCodebook(dimensions int, values int, minimum int, delta int, weight func(v int) float64) *codebook {
+	entries := 1
+	for i := 0; i < dimensions; i++ {
+		entries *= values
+	}
+	weights := make([]float64, entries)
+	for e := range weights {
+		w := 1.0
+		for i, rest := 0, e; i < dimensions; i, rest = i+1, rest/values {
+			w *= weight(minimum + rest%values*delta)
+		}
+		weights[e] = w
+	}
+	c := &codebook{
+		dimensions: dimensions,
+		lengths:    huffmanLengths(weights),
+		lookup:     true,
+		values:     values,
+		minimum:    minimum,
+		delta:      delta,
+	}
+	c.codewords = codewords(c.lengths)
+	return c
+}
+
+// encodeEntry writes the codeword of the entry
+func (c *codebook) encodeEntry(b *bitWriter, entry int) {
+	// codewords are read from their most significant bit
+	cw, n := c.codewords[entry], uint(c.lengths[entry])
+	for i := n; i > 0; i-- {
+		b.write(cw>>(i-1), 1)
+	}
+}
+
+// encodeVector writes the entry of the lattice vector holding v, which must be on the lattice
+func (c *codebook) encodeVector(b *bitWriter, v []int) {
+	c.encodeEntry(b, c.vectorEntry(v))
+}
+
+// vectorLength returns the length of the codeword of the lattice vector holding v
+func (c *codebook) vectorLength(v []int) int {
+	return int(c.lengths[c.vectorEntry(v)])
+}
+
+func (c *codebook) vectorEntry(v []int) int {
+	entry := 0
+	// the first dimension varies fastest
+	for i := c.dimensions - 1; i >= 0; i-- {
+		entry = entry*c.values + (v[i]-c.minimum)/c.delta
+	}
+	return entry
+}
+
+// writeHeader writes the codebook, as held in the setup header
+func (c *codebook) writeHeader(b *bitWriter) {
+	b.write(0x564342, 24) // sync pattern
+	b.write(uint32(c.dimensions), 16)
+	b.write(uint32(len(c.lengths)), 24)
+	b.write(0, 1) // not ordered
+	b.write(0, 1) // not sparse
+	for _, l := range c.lengths {
+		b.write(uint32(l-1), 5)
+	}
+	if !c.lookup {
+		b.write(0, 4)
+		return
+	}
+	b.write(1, 4)
+	b.write(packFloat(c.minimum), 32)
+	b.write(packFloat(c.delta), 32)
+	valueBits := ilog(c.values - 1)
+	if valueBits == 0 {
+		valueBits = 1
+	}
+	b.write(uint32(valueBits-1), 4)
+	b.write(0, 1) // not a sequence
+	for i := 0; i < c.values; i++ {
+		b.write(uint32(i), valueBits)
+	}
+}
+
+// packFloat returns the integer v in the 32-bit float format of the codebook header
+func packFloat(v int) uint32 {
+	const exponentBias = 788
+	var sign uint32
+	if v < 0 {
+		sign = 1 << 31
+		v = -v
+	}
+	// v is held as the mantissa, scaled by 2^0
+	return sign | exponentBias<<21 | uint32(v)
+}
+
+// codewords returns the codeword of each entry, assigned in entry order as the decoder does
+func codewords(lengths []uint8) []uint32 {
+	var marker [33]uint32
+	out := make([]uint32, len(lengths))
+	for i, l := range lengths {
+		entry := marker[l]
+		out[i] = entry
+		// find the next available codeword of each length
+		for j := l; j > 0; j-- {
+			if marker[j]&1 != 0 {
+				if j == 1 {
+					marker[1]++
+				} else {
+					marker[j] = marker[j-1] << 1
+				}
+				break
+			}
+			marker[j]++
+		}
+		for j := l + 1; j < 33; j++ {
+			if marker[j]>>1 != entry {
+				break
+			}
+			entry = marker[j]
+			marker[j] = marker[j-1] << 1
+		}
+	}
+	return out
+}
+
+// maxCodewordLength is the longest codeword the Huffman code is allowed to hold
+const maxCodewordLength = 24
+
+// huffmanLengths returns the lengths of a complete Huffman code for the weights
+func huffmanLengths(weights []float64) []uint8 {
+	maxWeight := 0.0
+	for _, w := range weights {
+		maxWeight = math.Max(maxWeight, w)
+	}
+	// rare entries are made more likely until the code is short enough
+	for floor := math.Pow(2, -16); ; floor *= 4 {
+		adjusted := make([]float64, len(weights))
+		for i, w := range weights {
+			adjusted[i] = math.Max(w, maxWeight*floor)
+		}
+		lengths := huffman(adjusted)
+		longest := uint8(0)
+		for _, l := range lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if longest <= maxCodewordLength {
+			return lengths
+		}
+	}
+}
+
+type huffmanNode struct {
+	weight float64
+	// order breaks ties, so the code does not depend on the heap implementation
+	order    int
+	children [2]*huffmanNode
+	entry    int
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].order < h[j].order
+}
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffman returns the code lengths of a Huffman code for the weights
+func huffman(weights []float64) []uint8 {
+	lengths := make([]uint8, len(weights))
+	if len(weights) == 1 {
+		lengths[0] = 1
+		return lengths
+	}
+	h := make(huffmanHeap, len(weights))
+	for i, w := range weights {
+		h[i] = &huffmanNode{weight: w, order: i, entry: i}
+	}
+	heap.Init(&h)
+	order := len(weights)
+	for h.Len() > 1 {
+		a := heap.Pop(&h).(*huffmanNode)
+		b := heap.Pop(&h).(*huffmanNode)
+		heap.Push(&h, &huffmanNode{weight: a.weight + b.weight, order: order, children: [2]*huffmanNode{a, b}, entry: -1})
+		order++
+	}
+	var walk func(n *huffmanNode, depth uint8)
+	walk = func(n *huffmanNode, depth uint8) {
+		if n.entry >= 0 {
+			lengths[n.entry] = depth
+			return
+		}
+		walk(n.children[0], depth+1)
+		walk(n.children[1], depth+1)
+	}
+	walk(h[0], 0)
+	return lengths
+}
+
+// sortedIndices returns the indices of the values, sorted by value
+func sortedIndices(values []int) []int {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return values[idx[a]] < values[idx[b]] })
+	return idx
+}
@@ -0,0 +1,245 @@
+package vorbis
+
+import "math"
+
+const (
+	// floorMultiplier scales the floor Y values into the inverse dB table
+	floorMultiplier = 2
+	floorRange      = 256 / floorMultiplier
+	floorDimensions = 3
+	// floorSlack is how far a post may be above its wanted value when its predicted value is used instead
+	floorSlack = 2
+
+	// dbStep is the ratio between neighbouring values of the decoder's inverse dB table,
+	// which runs up to 1.0 at its last value
+	dbStep = 1.0649856
+)
+
+// longFloorPosts and shortFloorPosts are the X positions of the floor posts of long and short
+// blocks, other than the first and last, which are spaced more closely at low frequencies
+var (
+	longFloorPosts = []int{
+		2, 4, 6, 8, 11, 14, 17, 20, 24, 28, 32, 37, 42, 48, 54,
+		61, 68, 76, 85, 95, 106, 118, 131, 145, 160, 177, 195, 215, 237, 261,
+		287, 315, 345, 378, 414, 453, 496, 543, 594, 650, 712, 780, 854, 935, 1000,
+	}
+	shortFloorPosts = []int{
+		1, 2, 3, 4, 5, 6, 7, 9, 11, 13, 16, 19, 23, 28, 34, 41, 50, 61, 74, 90, 109,
+	}
+)
+
+// floor is a floor 1 configuration with a single partition class
+type floor struct {
+	// n is the number of spectral values, a power of two which is also the range of the X values
+	n int
+	// x holds the post positions in header order, where each post after the first two lies
+	// between two earlier posts, so its Y value is predicted from its neighbours
+	x    []int
+	low  []int
+	high []int
+	// sorted holds the indices of x in order of position
+	sorted []int
+
+	book *codebook
+}
+
+// newFloor returns a floor for blocks of n spectral values with posts at the positions given,
+// using the book for the Y values
+func newFloor(n int, posts []int, book *codebook) *floor {
+	f := &floor{
+		n:    n,
+		x:    []int{0, n},
+		book: book,
+	}
+	// order the posts by repeatedly bisecting the spans between them
+	type span struct{ lo, hi int }
+	queue := []span{{0, len(posts)}}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if s.lo >= s.hi {
+			continue
+		}
+		mid := (s.lo + s.hi) / 2
+		f.x = append(f.x, posts[mid])
+		queue = append(queue, span{s.lo, mid}, span{mid + 1, s.hi})
+	}
+	f.sorted = sortedIndices(f.x)
+	f.low = make([]int, len(f.x))
+	f.high = make([]int, len(f.x))
+	for i := 2; i < len(f.x); i++ {
+		f.low[i], f.high[i] = 0, 1
+		for j := 0; j < i; j++ {
+			if f.x[j] < f.x[i] && f.x[j] > f.x[f.low[i]] {
+				f.low[i] = j
+			}
+			if f.x[j] > f.x[i] && f.x[j] < f.x[f.high[i]] {
+				f.high[i] = j
+			}
+		}
+	}
+	return f
+}
+
+// writeHeader writes the floor configuration, as held in the setup header
+func (f *floor) writeHeader(b *bitWriter, bookNumber int) {
+	partitions := (len(f.x) - 2) / floorDimensions
+	b.write(1, 16) // floor type
+	b.write(uint32(partitions), 5)
+	for i := 0; i < partitions; i++ {
+		b.write(0, 4) // partition class
+	}
+	b.write(floorDimensions-1, 3)
+	b.write(0, 2) // subclasses
+	b.write(uint32(bookNumber+1), 8)
+	b.write(floorMultiplier-1, 2)
+	rangeBits := ilog(f.n) - 1
+	b.write(uint32(rangeBits), 4)
+	for _, x := range f.x[2:] {
+		b.write(uint32(x), rangeBits)
+	}
+}
+
+// floorY returns the lowest floor Y value at or above the amplitude
+func floorY(amplitude float64) int {
+	i := 255 + math.Log(amplitude)/math.Log(dbStep)
+	y := int(math.Ceil(i / floorMultiplier))
+	if y < 0 {
+		return 0
+	}
+	if y >= floorRange {
+		return floorRange - 1
+	}
+	return y
+}
+
+// encode writes the floor fitted to the wanted amplitude at each post, returning the floor
+// curve the decoder renders from it. The amplitudes are in header order.
+func (f *floor) encode(b *bitWriter, amplitudes []float64) []float64 {
+	values := len(f.x)
+	want := make([]int, values)
+	for i, a := range amplitudes {
+		want[i] = floorY(a)
+	}
+
+	// the Y values are coded as the difference from the prediction made from the neighbours
+	final := make([]int, values)
+	coded := make([]int, values)
+	used := make([]bool, values)
+	final[0], final[1] = want[0], want[1]
+	coded[0], coded[1] = want[0], want[1]
+	used[0], used[1] = true, true
+	for i := 2; i < values; i++ {
+		lo, hi := f.low[i], f.high[i]
+		predicted := renderPoint(f.x[lo], final[lo], f.x[hi], final[hi], f.x[i])
+		val := 0
+		// the floor may be left a little high, but never below the wanted value
+		if d := predicted - want[i]; d < 0 || d > floorSlack {
+			val = floorVal(want[i], predicted)
+		}
+		coded[i] = val
+		final[i] = predicted
+		if val != 0 {
+			used[lo], used[hi], used[i] = true, true, true
+			final[i] = want[i]
+		}
+	}
+
+	b.write(1, 1) // nonzero
+	yBits := ilog(floorRange - 1)
+	b.write(uint32(coded[0]), yBits)
+	b.write(uint32(coded[1]), yBits)
+	for _, v := range coded[2:] {
+		f.book.encodeEntry(b, v)
+	}
+
+	// render the curve between the used posts, in order of position
+	curve := make([]int, f.n)
+	lx, ly := 0, final[0]*floorMultiplier
+	hx, hy := 0, 0
+	for _, i := range f.sorted[1:] {
+		if !used[i] {
+			continue
+		}
+		hx, hy = f.x[i], final[i]*floorMultiplier
+		renderLine(lx, ly, hx, hy, curve)
+		lx, ly = hx, hy
+	}
+	if hx < f.n {
+		renderLine(hx, hy, f.n, hy, curve)
+	}
+	out := make([]float64, f.n)
+	for i, y := range curve {
+		out[i] = math.Pow(dbStep, float64(y-255))
+	}
+	return out
+}
+
+// floorVal returns the coded value of the Y value, given its predicted value
+func floorVal(y int, predicted int) int {
+	highroom, lowroom := floorRange-predicted, predicted
+	room := highroom
+	if lowroom < room {
+		room = lowroom
+	}
+	switch d := y - predicted; {
+	case d > 0 && d < room:
+		return 2 * d
+	case d > 0:
+		return d + lowroom
+	case d < 0 && -d <= room:
+		return -2*d - 1
+	case d < 0:
+		return highroom - 1 - d
+	}
+	return 0
+}
+
+// renderPoint returns the Y value at x of the line between two posts
+func renderPoint(x0, y0, x1, y1, x int) int {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	off := ady * (x - x0) / adx
+	if dy < 0 {
+		return y0 - off
+	}
+	return y0 + off
+}
+
+// renderLine draws the line between two posts into v, as the decoder does
+func renderLine(x0, y0, x1, y1 int, v []int) {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	base := dy / adx
+	sy := base + 1
+	if dy < 0 {
+		sy = base - 1
+	}
+	absBase := base
+	if absBase < 0 {
+		absBase = -absBase
+	}
+	ady -= absBase * adx
+	y, err := y0, 0
+	if x0 < len(v) {
+		v[x0] = y
+	}
+	for x := x0 + 1; x < x1 && x < len(v); x++ {
+		err += ady
+		if err >= adx {
+			err -= adx
+			y += sy
+		} else {
+			y += base
+		}
+		v[x] = y
+	}
+}
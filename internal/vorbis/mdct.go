@@ -0,0 +1,134 @@
+package vorbis
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// mdct computes the forward modified discrete cosine transform of a block, scaled so
+// the inverse transform of the decoder, windowed and overlapped, restores the input
+type mdct struct {
+	n    int
+	pre  []complex128
+	post []complex128
+	fft  *fft
+	// windows holds the window for each pair of left and right slope lengths
+	windows map[[2]int][]float64
+}
+
+func newMDCT(n int) *mdct {
+	m := &mdct{
+		n:       n,
+		pre:     make([]complex128, n/4),
+		post:    make([]complex128, n/4),
+		fft:     newFFT(n / 4),
+		windows: make(map[[2]int][]float64),
+	}
+	half := float64(n / 2)
+	for i := range m.pre {
+		m.pre[i] = cmplx.Exp(complex(0, -math.Pi*float64(i)/half))
+		m.post[i] = cmplx.Exp(complex(0, -math.Pi*(float64(i)+0.25)/half))
+	}
+	return m
+}
+
+// window returns the window of the block with left and right slopes of the lengths given,
+// centred on the quarters of the block
+func (m *mdct) window(left int, right int) []float64 {
+	if w, ok := m.windows[[2]int{left, right}]; ok {
+		return w
+	}
+	slope := func(i int, n int) float64 {
+		s := math.Sin((float64(i) + 0.5) / float64(n) * math.Pi / 2)
+		return math.Sin(math.Pi / 2 * s * s)
+	}
+	w := make([]float64, m.n)
+	leftStart, rightStart := m.n/4-left/2, m.n*3/4-right/2
+	for i := range w {
+		switch {
+		case i < leftStart:
+		case i < leftStart+left:
+			w[i] = slope(i-leftStart, left)
+		case i < rightStart:
+			w[i] = 1
+		case i < rightStart+right:
+			w[i] = slope(rightStart+right-1-i, right)
+		}
+	}
+	m.windows[[2]int{left, right}] = w
+	return w
+}
+
+// transform windows the n samples of in and writes the n/2 coefficients to out. Each slope
+// of the window is half as long as the smaller of the block and its neighbour on that side.
+func (m *mdct) transform(in []float64, out []float64, left int, right int) {
+	half, quarter := m.n/2, m.n/4
+	window := m.window(left, right)
+	w := func(i int) float64 { return in[i] * window[i] }
+
+	// fold the four quarters (a, b, c, d) of the block into (-c_r-d, a-b_r), whose DCT-IV is the MDCT
+	v := make([]float64, half)
+	for i := 0; i < quarter; i++ {
+		v[i] = -w(3*quarter-1-i) - w(3*quarter+i)
+		v[quarter+i] = w(i) - w(half-1-i)
+	}
+
+	// the DCT-IV is computed with a complex FFT of a quarter of the size
+	z := make([]complex128, quarter)
+	for i := range z {
+		z[i] = complex(v[2*i], v[half-1-2*i]) * m.pre[i]
+	}
+	m.fft.transform(z)
+	scale := 2 / float64(half)
+	for k, c := range z {
+		c *= m.post[k]
+		out[2*k] = real(c) * scale
+		out[half-1-2*k] = -imag(c) * scale
+	}
+}
+
+// fft is a radix-2 complex fast Fourier transform of a fixed size
+type fft struct {
+	n       int
+	roots   []complex128
+	reverse []int
+}
+
+func newFFT(n int) *fft {
+	f := &fft{
+		n:       n,
+		roots:   make([]complex128, n/2),
+		reverse: make([]int, n),
+	}
+	for i := range f.roots {
+		f.roots[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(n)))
+	}
+	bits := ilog(n) - 1
+	for i := range f.reverse {
+		r := 0
+		for b := uint(0); b < bits; b++ {
+			r |= (i >> b & 1) << (bits - 1 - b)
+		}
+		f.reverse[i] = r
+	}
+	return f
+}
+
+// transform replaces x with its discrete Fourier transform
+func (f *fft) transform(x []complex128) {
+	for i, r := range f.reverse {
+		if i < r {
+			x[i], x[r] = x[r], x[i]
+		}
+	}
+	for size := 2; size <= f.n; size <<= 1 {
+		step := f.n / size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < size/2; k++ {
+				t := f.roots[k*step] * x[start+k+size/2]
+				x[start+k+size/2] = x[start+k] - t
+				x[start+k] += t
+			}
+		}
+	}
+}
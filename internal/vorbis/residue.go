@@ -0,0 +1,159 @@
+package vorbis
+
+const (
+	residuePartitionSize = 16
+	// residueClassDimensions is the number of partition classes coded by each classbook entry
+	residueClassDimensions = 2
+	// residueMaxValue is the largest quantized residue value that can be coded, by the three passes
+	// of the widest class
+	residueMaxValue = 8*256 + 127
+)
+
+// residueClass describes how the partitions of a class are coded, in one or more passes
+type residueClass struct {
+	// limit is the largest value the class can code
+	limit int
+	books []*codebook
+	// steps are the quanta of the values coded in each pass, when the class is coded in more
+	// than one pass; each pass codes what is left by the passes before it
+	steps []int
+}
+
+// residue is a residue type 1 configuration
+type residue struct {
+	end       int
+	classbook *codebook
+	classes   []residueClass
+	// bookNumbers maps each book of the classes to its number in the setup header
+	bookNumbers map[*codebook]int
+}
+
+// class returns the class of the partition of quantized values which codes it in the fewest bits
+func (r *residue) class(q []int) int {
+	m := 0
+	for _, v := range q {
+		if v < 0 {
+			v = -v
+		}
+		if v > m {
+			m = v
+		}
+	}
+	best, bestCost := len(r.classes)-1, -1
+	part := make([]int, len(q))
+	for c, rc := range r.classes {
+		if m > rc.limit {
+			continue
+		}
+		cost := 0
+		for pass, book := range rc.books {
+			copy(part, q)
+			rc.split(part, pass)
+			for j := 0; j < len(part); j += book.dimensions {
+				cost += book.vectorLength(part[j : j+book.dimensions])
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = c, cost
+		}
+	}
+	return best
+}
+
+// writeHeader writes the residue configuration, as held in the setup header
+func (r *residue) writeHeader(b *bitWriter, classbookNumber int) {
+	b.write(1, 16) // residue type
+	b.write(0, 24) // begin
+	b.write(uint32(r.end), 24)
+	b.write(residuePartitionSize-1, 24)
+	b.write(uint32(len(r.classes)-1), 6)
+	b.write(uint32(classbookNumber), 8)
+	for _, rc := range r.classes {
+		cascade := uint32(1)<<len(rc.books) - 1
+		b.write(cascade&7, 3)
+		b.write(0, 1) // no high bits
+	}
+	for _, rc := range r.classes {
+		for _, book := range rc.books {
+			b.write(uint32(r.bookNumbers[book]), 8)
+		}
+	}
+}
+
+// encode writes the quantized residue vectors of the channels, skipping nil vectors
+func (r *residue) encode(b *bitWriter, vectors [][]int) {
+	partitions := r.end / residuePartitionSize
+	classes := make([][]int, len(vectors))
+	for ch, v := range vectors {
+		if v == nil {
+			continue
+		}
+		// the classbook codes whole groups of partitions, so the last group is padded with silence
+		classes[ch] = make([]int, (partitions+residueClassDimensions-1)/residueClassDimensions*residueClassDimensions)
+		for p := 0; p < partitions; p++ {
+			classes[ch][p] = r.class(v[p*residuePartitionSize : (p+1)*residuePartitionSize])
+		}
+	}
+
+	passes := 0
+	for _, rc := range r.classes {
+		if len(rc.books) > passes {
+			passes = len(rc.books)
+		}
+	}
+	part := make([]int, residuePartitionSize)
+	for pass := 0; pass < passes; pass++ {
+		for p := 0; p < partitions; p += residueClassDimensions {
+			if pass == 0 {
+				for ch, v := range vectors {
+					if v == nil {
+						continue
+					}
+					entry := 0
+					for _, c := range classes[ch][p : p+residueClassDimensions] {
+						entry = entry*len(r.classes) + c
+					}
+					r.classbook.encodeEntry(b, entry)
+				}
+			}
+			for i := p; i < p+residueClassDimensions && i < partitions; i++ {
+				for ch, v := range vectors {
+					if v == nil {
+						continue
+					}
+					rc := r.classes[classes[ch][i]]
+					if pass >= len(rc.books) {
+						continue
+					}
+					copy(part, v[i*residuePartitionSize:(i+1)*residuePartitionSize])
+					rc.split(part, pass)
+					book := rc.books[pass]
+					for j := 0; j < residuePartitionSize; j += book.dimensions {
+						book.encodeVector(b, part[j:j+book.dimensions])
+					}
+				}
+			}
+		}
+	}
+}
+
+// split replaces the values of the partition with the part coded in the pass
+func (rc residueClass) split(q []int, pass int) {
+	if rc.steps == nil {
+		return
+	}
+	for i, v := range q {
+		for _, step := range rc.steps[:pass] {
+			v -= roundDiv(v, step) * step
+		}
+		q[i] = roundDiv(v, rc.steps[pass]) * rc.steps[pass]
+	}
+}
+
+// roundDiv returns v/d rounded to the nearest integer
+func roundDiv(v, d int) int {
+	if v < 0 {
+		return -((-v + d/2) / d)
+	}
+	return (v + d/2) / d
+}
@@ -0,0 +1,566 @@
+// Package vorbis encodes audio as an Ogg Vorbis bitstream
+package vorbis
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/gotracker/gosound/internal/ogg"
+)
+
+const (
+	// blocks are long, but for runs of short blocks where the audio has a sudden attack
+	longBlockBits  = 11
+	shortBlockBits = 8
+	longBlock      = 1 << longBlockBits
+	shortBlock     = 1 << shortBlockBits
+	// hop is the distance between the middles of long blocks, where a run of short blocks
+	// can take the place of a long block
+	hop = longBlock / 2
+	// shortRun is the number of short blocks which take the place of a long block
+	shortRun = longBlock / shortBlock
+	// lookahead is how far past the end of a long block the samples are needed, to find
+	// whether the block after it is replaced by short blocks
+	lookahead = hop / 2
+
+	// transientRatio is how much the high frequency energy of a short span must rise above the
+	// long span before it for the audio around it to be coded in short blocks
+	transientRatio = 10
+	// transientFloor is the high frequency energy per sample below which there is no transient
+	transientFloor = 1e-6
+
+	// MinQuality is the lowest encoding quality
+	MinQuality = 0.0
+	// MaxQuality is the highest encoding quality
+	MaxQuality = 10.0
+
+	// silence is the spectral amplitude below which a channel is not coded
+	silence = 1e-6
+	// minStep is the lowest quantization step, near the resolution of 16-bit audio
+	minStep = 1e-5
+	// floorHeadroom is the largest ratio of a spectral value to the floor, leaving room for rounding
+	floorHeadroom = residueMaxValue - 200
+	// deadZone is the ratio of a spectral value to the floor below which it is coded as zero
+	deadZone = 0.65
+
+	// stepBase and stepPerQuality give the quantization step, in dB relative to the level,
+	// at a quality
+	stepBase       = -13
+	stepPerQuality = -2
+	// levelRelease is how quickly the level falls after the signal gets quieter, in dB per second
+	levelRelease = 7.5
+)
+
+// blockConfig is the transform, floor and residue of a block size
+type blockConfig struct {
+	n       int
+	mdct    *mdct
+	floor   *floor
+	residue *residue
+}
+
+// Encoder encodes audio as an Ogg Vorbis bitstream
+type Encoder struct {
+	ogg      *ogg.Writer
+	channels int
+	rate     int
+
+	// step is the quantization step, relative to the level
+	step float64
+	// release is how much the level falls from one block to the next
+	release float64
+
+	short, long blockConfig
+	books       []*codebook
+
+	// buf holds the samples of each channel not yet fully coded, starting at the next long block
+	buf [][]float64
+	// shortNext is set when the next long block is replaced by short blocks, and shortLast
+	// when the last block written was short
+	shortNext, shortLast bool
+	// end is the position of the middle of the last block written, up to which the samples are
+	// coded, and lastSize is the size of that block
+	end      int
+	lastSize int
+	packets  uint64
+	samples  uint64
+	// level is the RMS spectral value of the loudest recent block, held and slowly released
+	// so that the step follows the loudness of the audio rather than every block
+	level float64
+}
+
+// NewEncoder returns an encoder writing the Ogg bitstream with the serial number to w, at a quality
+// from MinQuality to MaxQuality. The headers are written straight away, with the vendor string and comments.
+func NewEncoder(w io.Writer, serial uint32, channels int, sampleRate int, quality float64, vendor string, comments [][2]string) (*Encoder, error) {
+	if channels < 1 || channels > 255 {
+		return nil, errors.New("invalid channel count for vorbis")
+	}
+	if sampleRate < 1 {
+		return nil, errors.New("invalid sample rate for vorbis")
+	}
+	quality = math.Max(MinQuality, math.Min(MaxQuality, quality))
+
+	e := &Encoder{
+		ogg:      ogg.NewWriter(w, serial),
+		channels: channels,
+		rate:     sampleRate,
+		step:     math.Pow(10, (stepBase+stepPerQuality*quality)/20),
+		release:  math.Pow(10, -levelRelease/20*hop/float64(sampleRate)),
+		buf:      make([][]float64, channels),
+	}
+	e.setup()
+	for i := range e.buf {
+		// the first block starts half a block before the first sample
+		e.buf[i] = make([]float64, hop)
+	}
+
+	if err := e.ogg.WritePacket(e.identificationHeader(), 0); err != nil {
+		return nil, err
+	}
+	// the identification header is alone on the first page
+	if err := e.ogg.Flush(); err != nil {
+		return nil, err
+	}
+	if err := e.ogg.WritePacket(commentHeader(vendor, comments), 0); err != nil {
+		return nil, err
+	}
+	if err := e.ogg.WritePacket(e.setupHeader(), 0); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// setup builds the codebooks, and the floors and residues of both block sizes
+func (e *Encoder) setup() {
+	laplace := func(scale float64) func(int) float64 {
+		return func(v int) float64 { return math.Exp(-math.Abs(float64(v)) / scale) }
+	}
+
+	yWeights := make([]float64, floorRange)
+	for i := range yWeights {
+		yWeights[i] = math.Exp(-float64(i)/12) + 1e-3
+	}
+	// most posts are close enough to their predicted value to be left out
+	yWeights[0] = 10
+	floorBook := newScalarCodebook(1, yWeights)
+
+	classes := []residueClass{
+		{limit: 0},
+		{limit: 1, books: []*codebook{newLatticeCodebook(4, 3, -1, 1, laplace(0.3))}},
+		{limit: 1, books: []*codebook{newLatticeCodebook(4, 3, -1, 1, laplace(0.8))}},
+		{limit: 2, books: []*codebook{newLatticeCodebook(4, 5, -2, 1, laplace(0.8))}},
+		{limit: 4, books: []*codebook{newLatticeCodebook(2, 9, -4, 1, laplace(1.5))}},
+		{limit: 8, books: []*codebook{newLatticeCodebook(2, 17, -8, 1, laplace(3))}},
+		{limit: 15, books: []*codebook{newLatticeCodebook(2, 31, -15, 1, laplace(5))}},
+		{limit: 8*16 + 7, steps: []int{16, 1}, books: []*codebook{
+			newLatticeCodebook(2, 17, -128, 16, laplace(12)),
+			newLatticeCodebook(2, 17, -8, 1, laplace(1)),
+		}},
+		{limit: 8*16 + 7, steps: []int{16, 1}, books: []*codebook{
+			newLatticeCodebook(2, 17, -128, 16, laplace(40)),
+			newLatticeCodebook(2, 17, -8, 1, laplace(6)),
+		}},
+		{limit: residueMaxValue, steps: []int{256, 16, 1}, books: []*codebook{
+			newLatticeCodebook(2, 17, -2048, 256, laplace(400)),
+			newLatticeCodebook(2, 17, -128, 16, laplace(60)),
+			newLatticeCodebook(2, 17, -8, 1, laplace(6)),
+		}},
+	}
+	classWeights := []float64{0.3, 0.35, 0.15, 0.07, 0.01, 0.005, 0.005, 0.07, 0.01, 0.01}
+	entries := 1
+	for i := 0; i < residueClassDimensions; i++ {
+		entries *= len(classes)
+	}
+	cw := make([]float64, entries)
+	for i := range cw {
+		cw[i] = 1
+		for j, rest := 0, i; j < residueClassDimensions; j, rest = j+1, rest/len(classes) {
+			cw[i] *= classWeights[rest%len(classes)]
+		}
+	}
+	classbook := newScalarCodebook(residueClassDimensions, cw)
+
+	e.books = []*codebook{floorBook, classbook}
+	bookNumbers := make(map[*codebook]int)
+	for _, rc := range classes {
+		for _, book := range rc.books {
+			bookNumbers[book] = len(e.books)
+			e.books = append(e.books, book)
+		}
+	}
+	e.short = blockConfig{
+		n:       shortBlock,
+		mdct:    newMDCT(shortBlock),
+		floor:   newFloor(shortBlock/2, shortFloorPosts, floorBook),
+		residue: &residue{end: shortBlock / 2, classbook: classbook, classes: classes, bookNumbers: bookNumbers},
+	}
+	e.long = blockConfig{
+		n:       longBlock,
+		mdct:    newMDCT(longBlock),
+		floor:   newFloor(longBlock/2, longFloorPosts, floorBook),
+		residue: &residue{end: longBlock / 2, classbook: classbook, classes: classes, bookNumbers: bookNumbers},
+	}
+}
+
+func (e *Encoder) identificationHeader() []byte {
+	var b bitWriter
+	b.write(1, 8)
+	b.writeBytes([]byte("vorbis"))
+	b.write(0, 32) // version
+	b.write(uint32(e.channels), 8)
+	b.write(uint32(e.rate), 32)
+	b.write(0, 32) // maximum bitrate
+	b.write(0, 32) // nominal bitrate
+	b.write(0, 32) // minimum bitrate
+	b.write(shortBlockBits, 4)
+	b.write(longBlockBits, 4)
+	b.write(1, 1) // framing
+	return b.bytes()
+}
+
+func commentHeader(vendor string, comments [][2]string) []byte {
+	var b bitWriter
+	b.write(3, 8)
+	b.writeBytes([]byte("vorbis"))
+	b.write(uint32(len(vendor)), 32)
+	b.writeBytes([]byte(vendor))
+	b.write(uint32(len(comments)), 32)
+	for _, c := range comments {
+		comment := c[0] + "=" + c[1]
+		b.write(uint32(len(comment)), 32)
+		b.writeBytes([]byte(comment))
+	}
+	b.write(1, 1) // framing
+	return b.bytes()
+}
+
+func (e *Encoder) setupHeader() []byte {
+	var b bitWriter
+	b.write(5, 8)
+	b.writeBytes([]byte("vorbis"))
+
+	b.write(uint32(len(e.books)-1), 8)
+	for _, book := range e.books {
+		book.writeHeader(&b)
+	}
+
+	b.write(0, 6)  // time domain transforms
+	b.write(0, 16) // unused transform
+
+	// the floor and residue of each block size share its number, which is its block flag;
+	// each mode has its own mapping, for each block size uncoupled and then coupled
+	configs := []blockConfig{e.short, e.long}
+	b.write(uint32(len(configs)-1), 6) // floors
+	for _, c := range configs {
+		c.floor.writeHeader(&b, 0)
+	}
+
+	b.write(uint32(len(configs)-1), 6) // residues
+	for _, c := range configs {
+		c.residue.writeHeader(&b, 1)
+	}
+
+	b.write(uint32(e.modes()-1), 6) // mappings
+	for mode := 0; mode < e.modes(); mode++ {
+		b.write(0, 16) // mapping type
+		b.write(0, 1)  // single submap
+		if mode < len(configs) {
+			b.write(0, 1) // no coupling
+		} else {
+			b.write(1, 1)                  // square polar coupling
+			b.write(0, 8)                  // a single step
+			b.write(0, ilog(e.channels-1)) // magnitude
+			b.write(1, ilog(e.channels-1)) // angle
+		}
+		b.write(0, 2)                         // reserved
+		b.write(0, 8)                         // unused time configuration
+		b.write(uint32(mode%len(configs)), 8) // floor
+		b.write(uint32(mode%len(configs)), 8) // residue
+	}
+
+	b.write(uint32(e.modes()-1), 6) // modes
+	for mode := 0; mode < e.modes(); mode++ {
+		b.write(uint32(mode%len(configs)), 1) // block flag
+		b.write(0, 16)                        // window type
+		b.write(0, 16)                        // transform type
+		b.write(uint32(mode), 8)              // mapping
+	}
+
+	b.write(1, 1) // framing
+	return b.bytes()
+}
+
+// Write encodes the samples, which hold the same number of samples for each channel, nominally in [-1, 1]
+func (e *Encoder) Write(samples [][]float32) error {
+	if len(samples) != e.channels {
+		return errors.New("invalid channel count")
+	}
+	for ch, s := range samples {
+		for _, v := range s {
+			e.buf[ch] = append(e.buf[ch], float64(v))
+		}
+	}
+	e.samples += uint64(len(samples[0]))
+	for len(e.buf[0]) >= longBlock+lookahead {
+		if err := e.writeLong(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close encodes the remaining samples and ends the bitstream. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	// the block holding the last sample is followed by one that finishes it
+	for e.samples > 0 && (e.packets == 0 || uint64(e.end) < e.samples) {
+		for ch := range e.buf {
+			for len(e.buf[ch]) < longBlock+lookahead {
+				e.buf[ch] = append(e.buf[ch], 0)
+			}
+		}
+		if err := e.writeLong(); err != nil {
+			return err
+		}
+	}
+	return e.ogg.Close()
+}
+
+// writeLong encodes the first long block of the buffered samples, or the short blocks which
+// take its place, once it is known whether the long block after it is replaced too
+func (e *Encoder) writeLong() error {
+	// the first block is long, as the audio starts in its middle
+	short := e.shortNext
+	e.shortNext = e.transient()
+	c, left, right := e.long, hop, hop
+	if e.shortLast {
+		left = shortBlock / 2
+	}
+	if e.shortNext {
+		right = shortBlock / 2
+	}
+	blocks := [][][]float64{e.transform(c, 0, left, right)}
+	if short {
+		// the short blocks are spread around the middle of the long block
+		c, left, right = e.short, shortBlock/2, shortBlock/2
+		blocks = make([][][]float64, shortRun)
+		for i := range blocks {
+			blocks[i] = e.transform(c, hop/2-shortBlock/4+i*shortBlock/2, left, right)
+		}
+	}
+
+	// the level is measured over the whole run of blocks, as each block holds about the same
+	// energy whatever its size
+	energy := 0.0
+	for _, spectra := range blocks {
+		for _, spectrum := range spectra {
+			for _, v := range spectrum {
+				energy += v * v
+			}
+		}
+	}
+	e.level = math.Max(math.Sqrt(energy/float64(len(blocks)*e.channels*hop)), e.level*e.release)
+	for _, spectra := range blocks {
+		if err := e.writeBlock(c, spectra, left, right); err != nil {
+			return err
+		}
+	}
+	e.shortLast = short
+	for ch := range e.buf {
+		e.buf[ch] = e.buf[ch][hop:]
+	}
+	return nil
+}
+
+// transient reports whether the long block after the first buffered one is replaced by short
+// blocks, as the high frequency energy of a short span in its middle rises well above the long
+// span before it
+func (e *Encoder) transient() bool {
+	const span = shortBlock / 2
+	// the spans cover half a hop either side of the middle of the next long block,
+	// after a hop of spans before them
+	start := longBlock - hop/2 - hop
+	energies := make([]float64, (longBlock+lookahead-start)/span)
+	for _, buf := range e.buf {
+		for i := range energies {
+			for j := start + i*span; j < start+(i+1)*span; j++ {
+				d := buf[j] - buf[j-1]
+				energies[i] += d * d
+			}
+		}
+	}
+	before := hop / span
+	for i := before; i < len(energies); i++ {
+		mean := 0.0
+		for _, v := range energies[i-before : i] {
+			mean += v
+		}
+		mean /= float64(before)
+		if energies[i] > transientRatio*mean && energies[i] > transientFloor*float64(span*e.channels) {
+			return true
+		}
+	}
+	return false
+}
+
+// transform returns the spectrum of each channel of the block starting at the buffered position,
+// with slopes of the window as given
+func (e *Encoder) transform(c blockConfig, start int, left int, right int) [][]float64 {
+	spectra := make([][]float64, e.channels)
+	for ch, buf := range e.buf {
+		spectra[ch] = make([]float64, c.n/2)
+		c.mdct.transform(buf[start:start+c.n], spectra[ch], left, right)
+	}
+	return spectra
+}
+
+// modes returns the number of modes, which are the block sizes, uncoupled and then, for stereo, coupled
+func (e *Encoder) modes() int {
+	if e.channels == 2 {
+		return 4
+	}
+	return 2
+}
+
+// writeBlock encodes the spectra of a block, with slopes of the window as given, as an audio packet
+func (e *Encoder) writeBlock(c blockConfig, spectra [][]float64, left int, right int) error {
+	// the noise of a step in a short block is spread over fewer samples, so its step is larger
+	step := math.Max(e.level*e.step, minStep) * math.Sqrt(float64(hop)/float64(c.n/2))
+	var floors bitWriter
+	residues := e.encodeFloors(&floors, c, spectra, step)
+
+	// a stereo pair is coded as its magnitude and angle when that takes fewer bits
+	mode := 0
+	if c.n == longBlock {
+		mode = 1
+	}
+	var uncoupled, coupled bitWriter
+	residue := &uncoupled
+	c.residue.encode(&uncoupled, residues)
+	if e.channels == 2 && residues[0] != nil && residues[1] != nil {
+		if magnitude, angle, ok := couple(residues[0], residues[1]); ok {
+			c.residue.encode(&coupled, [][]int{magnitude, angle})
+			if coupled.bits < uncoupled.bits {
+				mode += 2
+				residue = &coupled
+			}
+		}
+	}
+
+	var b bitWriter
+	b.write(0, 1) // audio packet
+	b.write(uint32(mode), ilog(e.modes()-1))
+	if c.n == longBlock {
+		b.writeBool(left == hop)
+		b.writeBool(right == hop)
+	}
+	b.writeBits(&floors)
+	b.writeBits(residue)
+
+	if e.packets == 0 {
+		// the audio starts on a fresh page
+		if err := e.ogg.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// the packet finishes the samples up to the middle of its block, where the first block
+	// starts half a long block before the first sample
+	if e.packets > 0 {
+		e.end += e.lastSize/4 + c.n/4
+	}
+	e.lastSize = c.n
+	granule := uint64(e.end)
+	if granule > e.samples {
+		granule = e.samples
+	}
+	e.packets++
+	return e.ogg.WritePacket(b.bytes(), granule)
+}
+
+// encodeFloors writes the floor of each channel at the step, returning the quantized residues,
+// which are nil for silent channels
+func (e *Encoder) encodeFloors(b *bitWriter, c blockConfig, spectra [][]float64, step float64) [][]int {
+	// every post is placed at the step, so the noise is spread evenly across the spectrum, but
+	// high enough that the largest value of any channel around it can still be coded; the channels
+	// share the floor, so their residues can be coupled
+	f := c.floor
+	amplitudes := make([]float64, len(f.x))
+	for s, i := range f.sorted {
+		lo, hi := 0, f.n
+		if s > 0 {
+			lo = f.x[f.sorted[s-1]]
+		}
+		if s < len(f.sorted)-1 {
+			hi = f.x[f.sorted[s+1]] + 1
+		}
+		if hi > f.n {
+			hi = f.n
+		}
+		envelope := 0.0
+		for _, spectrum := range spectra {
+			for _, v := range spectrum[lo:hi] {
+				envelope = math.Max(envelope, math.Abs(v))
+			}
+		}
+		amplitudes[i] = math.Max(step, envelope/floorHeadroom)
+	}
+
+	residues := make([][]int, len(spectra))
+	for ch, spectrum := range spectra {
+		peak := 0.0
+		for _, v := range spectrum {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		if peak < silence {
+			b.write(0, 1) // unused
+			continue
+		}
+		curve := f.encode(b, amplitudes)
+		q := make([]int, f.n)
+		for k := 0; k < c.residue.end; k++ {
+			r := spectrum[k] / curve[k]
+			if math.Abs(r) < deadZone {
+				continue
+			}
+			v := int(math.Round(r))
+			if v > residueMaxValue {
+				v = residueMaxValue
+			} else if v < -residueMaxValue {
+				v = -residueMaxValue
+			}
+			q[k] = v
+		}
+		residues[ch] = q
+	}
+	return residues
+}
+
+// couple returns the square polar magnitude and angle of the residues of a channel pair,
+// or false if an angle is too large to be coded
+func couple(left []int, right []int) ([]int, []int, bool) {
+	magnitude := make([]int, len(left))
+	angle := make([]int, len(left))
+	for i, l := range left {
+		r := right[i]
+		m, a := r, l-r
+		if abs(l) > abs(r) {
+			m = l
+		}
+		if m < 0 {
+			a = -a
+		}
+		if abs(a) > residueMaxValue {
+			return nil, nil, false
+		}
+		magnitude[i], angle[i] = m, a
+	}
+	return magnitude, angle, true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -10,4 +10,22 @@ const (
 	KindFile
 	// KindSoundCard is an active sound playback device (e.g.: a sound card attached to speakers)
 	KindSoundCard
+	// KindVirtual is a device that consumes audio without sending it to hardware or a file (e.g.: a null or memory device)
+	KindVirtual
 )
+
+// String returns the name of the device kind
+func (k Kind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindFile:
+		return "file"
+	case KindSoundCard:
+		return "soundcard"
+	case KindVirtual:
+		return "virtual"
+	default:
+		return "unknown"
+	}
+}
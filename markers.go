@@ -0,0 +1,151 @@
+package gosound
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Marker is implemented by PremixData.Userdata to mark the start of its row
+// (e.g.: an order or pattern boundary) in the files written by the file device
+type Marker interface {
+	// MarkerLabel returns the label of the marker, or false if the row is not marked
+	MarkerLabel() (string, bool)
+}
+
+// marker is a recorded marker
+type marker struct {
+	// Frame is the position of the marker, in sample frames from the start of the stream
+	Frame uint64
+	Label string
+}
+
+const (
+	// cueFramesPerSecond is the number of CD frames per second, used in the .cue file timestamps
+	cueFramesPerSecond = 75
+	// cueMaxTracks is the largest track number of a .cue file
+	cueMaxTracks = 99
+)
+
+// markerRecorder records the markers of the rows played by a file device
+type markerRecorder struct {
+	// embed is true if the markers are written into the file
+	embed bool
+	// cuePath is the path of the sidecar .cue file, or empty if none is written
+	cuePath   string
+	audioPath string
+	metadata  Metadata
+	markers   []marker
+}
+
+func newMarkerRecorder(settings Settings) markerRecorder {
+	r := markerRecorder{
+		embed:     settings.Markers,
+		audioPath: settings.Filepath,
+		metadata:  settings.Metadata,
+	}
+	if settings.CueSheet {
+		r.cuePath = cueSheetPath(settings.Filepath)
+	}
+	return r
+}
+
+// cueSheetPath returns the path of the .cue file next to the audio file, or empty if it has no path
+func cueSheetPath(audioPath string) string {
+	if audioPath == "" {
+		return ""
+	}
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".cue"
+}
+
+// record records the marker of the row, if it has one, at the frame position
+func (r *markerRecorder) record(row *PremixData, frame uint64) {
+	if !r.embed && r.cuePath == "" {
+		return
+	}
+	m, ok := row.Userdata.(Marker)
+	if !ok {
+		return
+	}
+	if label, ok := m.MarkerLabel(); ok {
+		r.markers = append(r.markers, marker{
+			Frame: frame,
+			Label: label,
+		})
+	}
+}
+
+// embedded returns the markers to be written into the file
+func (r *markerRecorder) embedded() []marker {
+	if !r.embed {
+		return nil
+	}
+	return r.markers
+}
+
+// fallBackToCueSheet has the markers written to the sidecar .cue file, for when they cannot be
+// written into the file. It fails if there is no path to write the .cue file next to.
+func (r *markerRecorder) fallBackToCueSheet() error {
+	if r.cuePath == "" {
+		r.cuePath = cueSheetPath(r.audioPath)
+	}
+	if r.cuePath == "" && len(r.markers) > 0 {
+		return errors.New("markers not written: no room in the file, and no path for a .cue file")
+	}
+	return nil
+}
+
+// writeCueSheet writes the sidecar .cue file, if one was requested, with a track per marker.
+// fileType is the .cue file type of the audio file (e.g.: "WAVE").
+func (r *markerRecorder) writeCueSheet(fileType string, samplesPerSecond int) error {
+	if r.cuePath == "" || len(r.markers) == 0 {
+		return nil
+	}
+	f, err := os.Create(r.cuePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "REM COMMENT %s\n", cueQuote(wavSoftware))
+	if r.metadata.Artist != "" {
+		fmt.Fprintf(w, "PERFORMER %s\n", cueQuote(r.metadata.Artist))
+	}
+	if r.metadata.Title != "" {
+		fmt.Fprintf(w, "TITLE %s\n", cueQuote(r.metadata.Title))
+	}
+	fmt.Fprintf(w, "FILE %s %s\n", cueQuote(filepath.Base(r.audioPath)), fileType)
+	for i, m := range r.markers {
+		if i >= cueMaxTracks {
+			break
+		}
+		fmt.Fprintf(w, "  TRACK %02d AUDIO\n", i+1)
+		if m.Label != "" {
+			fmt.Fprintf(w, "    TITLE %s\n", cueQuote(m.Label))
+		}
+		fmt.Fprintf(w, "    INDEX 01 %s\n", cueTimestamp(m.Frame, samplesPerSecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// cueQuote quotes a .cue file string, which cannot hold quotes or line breaks
+func cueQuote(s string) string {
+	s = strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ").Replace(s)
+	return `"` + s + `"`
+}
+
+// cueTimestamp returns the frame position as a .cue file MM:SS:FF timestamp
+func cueTimestamp(frame uint64, samplesPerSecond int) string {
+	cdFrames := frame * cueFramesPerSecond / uint64(samplesPerSecond)
+	return fmt.Sprintf("%02d:%02d:%02d",
+		cdFrames/(60*cueFramesPerSecond),
+		cdFrames/cueFramesPerSecond%60,
+		cdFrames%cueFramesPerSecond)
+}
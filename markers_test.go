@@ -0,0 +1,161 @@
+package gosound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMarkers returns the markers of the rows from testMarked
+func testMarkers(rows int) []marker {
+	var out []marker
+	for r := 0; r < rows; r += 50 {
+		label, _ := testMarker(r).MarkerLabel()
+		out = append(out, marker{Frame: uint64(r * testRowLen), Label: label})
+	}
+	return out
+}
+
+// testWavMarkers returns the markers held in the cue and LIST adtl chunks of a WAV file
+func testWavMarkers(t *testing.T, chunks []testChunk) []marker {
+	t.Helper()
+	cue := testFindChunk(t, chunks, "cue ")
+	n := int(binary.LittleEndian.Uint32(cue))
+	if len(cue) != 4+n*wavCuePointSize {
+		t.Fatalf("cue chunk of %d bytes holds %d cue points", len(cue), n)
+	}
+	markers := make([]marker, n)
+	for i := range markers {
+		p := cue[4+i*wavCuePointSize:]
+		if id := binary.LittleEndian.Uint32(p); int(id) != i+1 || string(p[8:12]) != "data" {
+			t.Fatalf("cue point %d: ID %d in chunk %q", i, id, p[8:12])
+		}
+		markers[i].Frame = uint64(binary.LittleEndian.Uint32(p[4:]))
+	}
+
+	var list []byte
+	for _, c := range chunks {
+		if c.id == "LIST" && string(c.body[:4]) == "adtl" {
+			list = c.body
+		}
+	}
+	if list == nil {
+		t.Fatal("no LIST chunk of type adtl")
+	}
+	for pos := 4; pos < len(list); {
+		size := int(binary.LittleEndian.Uint32(list[pos+4:]))
+		body := list[pos+8 : pos+8+size]
+		if string(list[pos:pos+4]) != "labl" || body[size-1] != 0 {
+			t.Fatalf("adtl chunk %q holding %q", list[pos:pos+4], body)
+		}
+		id := int(binary.LittleEndian.Uint32(body))
+		if id < 1 || id > n {
+			t.Fatalf("label for cue point %d", id)
+		}
+		markers[id-1].Label = string(body[4 : size-1])
+		pos += 8 + size + size&1
+	}
+	return markers
+}
+
+func TestWavMarkers(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	want := testMarkers(120)
+	sampler := &WavSampler{UnityNote: 60, LoopType: WavLoopForward}
+	s := Settings{Markers: true, Options: &WavOptions{Sampler: sampler}}
+	chunks := testRiffChunks(t, testRenderFile(t, "wav", s, rows))
+	if got := testWavMarkers(t, chunks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("markers %+v, want %+v", got, want)
+	}
+
+	// a stream that cannot seek still gets the chunks after the data, with the sizes left unknown
+	b := testRenderStream(t, "wav", s, rows)
+	pos := 12
+	for string(b[pos:pos+4]) != "data" {
+		pos += 8 + int(binary.LittleEndian.Uint32(b[pos+4:]))
+	}
+	if size := binary.LittleEndian.Uint32(b[pos+4:]); size != wavStreamingSize {
+		t.Fatalf("data size %d written to a stream that cannot seek", size)
+	}
+	// the RIFF header and the data are stood in for, to read the chunks after the data
+	tail := b[pos+8+120*testRowLen*2*2:]
+	header := append([]byte("RIFF\x00\x00\x00\x00WAVE"), tail...)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(header)-8))
+	streamed := testRiffChunks(t, header)
+	testFindChunk(t, streamed, "smpl")
+	if got := testWavMarkers(t, streamed); !reflect.DeepEqual(got, want) {
+		t.Fatalf("streaming: markers %+v, want %+v", got, want)
+	}
+}
+
+func TestAiffMarkers(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	_, chunks := testAiffChunks(t, testRenderFile(t, "aiff", Settings{Markers: true}, rows))
+	mark := testFindChunk(t, chunks, "MARK")
+	var got []marker
+	pos := 2
+	for i := 0; i < int(binary.BigEndian.Uint16(mark)); i++ {
+		if id := binary.BigEndian.Uint16(mark[pos:]); int(id) != i+1 {
+			t.Fatalf("marker %d: ID %d", i, id)
+		}
+		// the name is a Pascal string, padded to an even size with its length byte
+		n := int(mark[pos+6])
+		got = append(got, marker{
+			Frame: uint64(binary.BigEndian.Uint32(mark[pos+2:])),
+			Label: string(mark[pos+7 : pos+7+n]),
+		})
+		pos += 6 + 1 + n + (n+1)&1
+	}
+	if pos != len(mark) {
+		t.Fatalf("MARK chunk of %d bytes, markers end at %d", len(mark), pos)
+	}
+	if want := testMarkers(120); !reflect.DeepEqual(got, want) {
+		t.Fatalf("markers %+v, want %+v", got, want)
+	}
+}
+
+func TestCueSheet(t *testing.T) {
+	rows := testMarked(testSignal(2, 120, testRowLen, testSampleRate))
+	s := testSettings(Settings{
+		Name:     fileName,
+		Filepath: filepath.Join(t.TempDir(), "song.wav"),
+		CueSheet: true,
+		Metadata: Metadata{Title: `The "Song"`, Artist: "Someone"},
+	})
+	testPlay(t, s, rows)
+	b, err := os.ReadFile(strings.TrimSuffix(s.Filepath, ".wav") + ".cue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`REM COMMENT "` + wavSoftware + `"`,
+		`PERFORMER "Someone"`,
+		`TITLE "The 'Song'"`,
+		`FILE "song.wav" WAVE`,
+		`  TRACK 01 AUDIO`,
+		`    TITLE "row 0"`,
+		`    INDEX 01 00:00:00`,
+		`  TRACK 02 AUDIO`,
+		`    TITLE "row 50"`,
+		`    INDEX 01 00:00:37`,
+		`  TRACK 03 AUDIO`,
+		`    TITLE "row 100"`,
+		`    INDEX 01 00:01:00`,
+		``,
+	}, "\n")
+	if !bytes.Equal(b, []byte(want)) {
+		t.Fatalf(".cue file\n%s\nwant\n%s", b, want)
+	}
+
+	// without the option, no .cue file is written
+	s.CueSheet = false
+	s.Filepath = filepath.Join(t.TempDir(), "song.wav")
+	testPlay(t, s, rows)
+	if _, err := os.Stat(strings.TrimSuffix(s.Filepath, ".wav") + ".cue"); !os.IsNotExist(err) {
+		t.Fatalf(".cue file written without the option: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package gosound
+
+import "sort"
+
+// Metadata is descriptive information about the audio, written by the file formats that support it
+type Metadata struct {
+	Title   string
+	Artist  string
+	Album   string
+	Comment string
+	// Tags holds additional name/value pairs (e.g.: "GENRE" or "DATE"), written in name order
+	Tags map[string]string
+}
+
+// IsEmpty returns true if there is no metadata to write
+func (m Metadata) IsEmpty() bool {
+	return m.Title == "" && m.Artist == "" && m.Album == "" && m.Comment == "" && len(m.Tags) == 0
+}
+
+// vorbisComments returns the metadata as Vorbis comment name/value pairs
+func (m Metadata) vorbisComments() [][2]string {
+	var comments [][2]string
+	for _, f := range [...][2]string{
+		{"TITLE", m.Title},
+		{"ARTIST", m.Artist},
+		{"ALBUM", m.Album},
+		{"COMMENT", m.Comment},
+	} {
+		if f[1] != "" {
+			comments = append(comments, f)
+		}
+	}
+	for _, name := range m.tagNames() {
+		comments = append(comments, [2]string{name, m.Tags[name]})
+	}
+	return comments
+}
+
+// tagNames returns the names of the additional tags, sorted
+func (m Metadata) tagNames() []string {
+	names := make([]string, 0, len(m.Tags))
+	for name := range m.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
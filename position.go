@@ -0,0 +1,76 @@
+package gosound
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Position is the playback position of an output device, in frames (samples per channel)
+type Position struct {
+	// Rendered is the number of frames handed to the device for output
+	Rendered uint64
+	// Played is the number of frames that have been output by the device
+	// For sound card devices, this is the number of frames that have been made audible
+	Played uint64
+	// Latency is the delay between a frame being rendered and it being played
+	Latency time.Duration
+}
+
+// Positioner is an interface to devices that report their playback position
+type Positioner interface {
+	Position() Position
+}
+
+// GetPosition returns the playback position of the passed in device, if it reports one
+func GetPosition(d Device) (Position, bool) {
+	if p, ok := d.(Positioner); ok {
+		return p.Position(), true
+	}
+	return Position{}, false
+}
+
+type frameCounter struct {
+	rendered uint64
+	played   uint64
+}
+
+func (c *frameCounter) addRendered(frames int) {
+	atomic.AddUint64(&c.rendered, uint64(frames))
+}
+
+func (c *frameCounter) addPlayed(frames int) {
+	atomic.AddUint64(&c.played, uint64(frames))
+}
+
+func (c *frameCounter) renderedFrames() uint64 {
+	return atomic.LoadUint64(&c.rendered)
+}
+
+// setPlayed moves the played position forward to frame, if it is not already past it
+func (c *frameCounter) setPlayed(frame uint64) {
+	for {
+		played := atomic.LoadUint64(&c.played)
+		if played >= frame || atomic.CompareAndSwapUint64(&c.played, played, frame) {
+			return
+		}
+	}
+}
+
+func (c *frameCounter) position(samplesPerSecond int) Position {
+	p := Position{
+		Rendered: atomic.LoadUint64(&c.rendered),
+		Played:   atomic.LoadUint64(&c.played),
+	}
+	if p.Played > p.Rendered {
+		p.Played = p.Rendered
+	}
+	p.Latency = framesToDuration(p.Rendered-p.Played, samplesPerSecond)
+	return p
+}
+
+func framesToDuration(frames uint64, samplesPerSecond int) time.Duration {
+	if samplesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(frames) * time.Second / time.Duration(samplesPerSecond)
+}
@@ -0,0 +1,60 @@
+package gosound
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPositionAfterPlay(t *testing.T) {
+	rows := testSignal(2, 20, testRowLen, testSampleRate)
+	for _, s := range []Settings{
+		{Name: fileName, Format: "wav", Filepath: filepath.Join(t.TempDir(), "out.wav")},
+		{Name: nullName},
+		{Name: memoryName},
+	} {
+		d, err := CreateOutputDevice(testSettings(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, ok := GetPosition(d); !ok || p != (Position{}) {
+			t.Fatalf("%s: position %+v before playing", s.Name, p)
+		}
+		if err := d.Play(testRowChan(rows)); err != nil {
+			t.Fatal(err)
+		}
+		// these devices play each row as soon as it is rendered
+		want := Position{Rendered: 20 * testRowLen, Played: 20 * testRowLen}
+		if p, _ := GetPosition(d); p != want {
+			t.Errorf("%s: position %+v, want %+v", s.Name, p, want)
+		}
+		d.Close()
+	}
+}
+
+func TestFrameCounter(t *testing.T) {
+	var c frameCounter
+	c.addRendered(testSampleRate)
+	c.setPlayed(testSampleRate / 2)
+	want := Position{Rendered: testSampleRate, Played: testSampleRate / 2, Latency: 500 * time.Millisecond}
+	if p := c.position(testSampleRate); p != want {
+		t.Fatalf("position %+v, want %+v", p, want)
+	}
+
+	// the played position never moves back, nor past the rendered position
+	c.setPlayed(1000)
+	if p := c.position(testSampleRate); p != want {
+		t.Fatalf("position %+v after moving back, want %+v", p, want)
+	}
+	c.addPlayed(testSampleRate)
+	want = Position{Rendered: testSampleRate, Played: testSampleRate}
+	if p := c.position(testSampleRate); p != want {
+		t.Fatalf("position %+v after playing past the end, want %+v", p, want)
+	}
+
+	// without a sample rate, the latency is unknown
+	c.addRendered(testSampleRate)
+	if p := c.position(0); p.Latency != 0 {
+		t.Fatalf("latency %v without a sample rate", p.Latency)
+	}
+}
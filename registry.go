@@ -0,0 +1,170 @@
+package gosound
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CreateOutputDeviceFunc is a factory that creates an output device based on the provided settings
+type CreateOutputDeviceFunc func(settings Settings) (Device, error)
+
+// ProbeFunc checks whether a device is usable on the current machine.
+// A nil result means the device should be expected to work.
+type ProbeFunc func() error
+
+// CapabilitiesFunc returns the capabilities of a device for the provided settings
+type CapabilitiesFunc func(settings Settings) (Capabilities, error)
+
+type deviceDetails struct {
+	create          CreateOutputDeviceFunc
+	probe           ProbeFunc
+	caps            CapabilitiesFunc
+	Kind            Kind
+	Description     string
+	defaultPriority int
+	isDefault       bool
+}
+
+// RegisterOption configures optional details of a device registration
+type RegisterOption func(details *deviceDetails)
+
+// WithDescription sets the human-readable description of a registered device
+func WithDescription(description string) RegisterOption {
+	return func(details *deviceDetails) {
+		details.Description = description
+	}
+}
+
+// WithProbe sets the availability probe of a registered device
+func WithProbe(probe ProbeFunc) RegisterOption {
+	return func(details *deviceDetails) {
+		details.probe = probe
+	}
+}
+
+// WithCapabilities sets the fixed capabilities of a registered device
+func WithCapabilities(caps Capabilities) RegisterOption {
+	return func(details *deviceDetails) {
+		details.caps = func(Settings) (Capabilities, error) {
+			return caps, nil
+		}
+	}
+}
+
+// WithCapabilitiesFunc sets a function that reports the capabilities of a
+// registered device, for devices whose capabilities depend on the settings
+func WithCapabilitiesFunc(caps CapabilitiesFunc) RegisterOption {
+	return func(details *deviceDetails) {
+		details.caps = caps
+	}
+}
+
+// WithDefaultPriority adds a registered device to the selection chain of the
+// "default" device. Devices with higher priority values are tried first.
+func WithDefaultPriority(priority int) RegisterOption {
+	return func(details *deviceDetails) {
+		details.defaultPriority = priority
+		details.isDefault = true
+	}
+}
+
+// DeviceInfo is the information about a registered device
+type DeviceInfo struct {
+	Name        string
+	Kind        Kind
+	Description string
+	// ProbeErr is the result of probing the device - nil if the device appears to be usable
+	ProbeErr error
+}
+
+// Available returns true if the device probe did not report a problem
+func (i DeviceInfo) Available() bool {
+	return i.ProbeErr == nil
+}
+
+var (
+	// Map is the mapping of device name to device details.
+	//
+	// Deprecated: Map must only be read. Use Register to add a device, and ListDevices or Probe
+	// to look them up; changing Map directly is not guarded by the lock the registry is read under.
+	Map = make(map[string]deviceDetails)
+
+	mapMu sync.RWMutex
+)
+
+// Register makes an output device available by the provided name.
+// If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, kind Kind, factory CreateOutputDeviceFunc, options ...RegisterOption) {
+	if name == "" {
+		panic("gosound: Register device name is empty")
+	}
+	if factory == nil {
+		panic("gosound: Register device factory is nil for " + name)
+	}
+
+	details := deviceDetails{
+		create: factory,
+		Kind:   kind,
+	}
+	for _, o := range options {
+		o(&details)
+	}
+
+	mapMu.Lock()
+	defer mapMu.Unlock()
+	if _, dup := Map[name]; dup {
+		panic("gosound: Register called twice for device " + name)
+	}
+	Map[name] = details
+}
+
+func lookupDevice(name string) (deviceDetails, bool) {
+	mapMu.RLock()
+	defer mapMu.RUnlock()
+	details, ok := Map[name]
+	return details, ok
+}
+
+// Probe checks whether the named device is usable on the current machine
+func Probe(name string) error {
+	details, ok := lookupDevice(name)
+	if !ok {
+		return errors.Wrap(ErrDeviceNotSupported, name)
+	}
+	return details.runProbe()
+}
+
+func (d deviceDetails) runProbe() error {
+	if d.probe == nil {
+		return nil
+	}
+	return d.probe()
+}
+
+// ListDevices returns the information about all registered devices, sorted by name.
+// Each device is probed for availability as part of the listing.
+func ListDevices() []DeviceInfo {
+	mapMu.RLock()
+	infos := make([]DeviceInfo, 0, len(Map))
+	probes := make([]deviceDetails, 0, len(Map))
+	for name, details := range Map {
+		infos = append(infos, DeviceInfo{
+			Name:        name,
+			Kind:        details.Kind,
+			Description: details.Description,
+		})
+		probes = append(probes, details)
+	}
+	mapMu.RUnlock()
+
+	for i := range infos {
+		infos[i].ProbeErr = probes[i].runProbe()
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
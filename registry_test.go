@@ -0,0 +1,122 @@
+package gosound
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testRegister registers a device for the duration of the test
+func testRegister(t *testing.T, name string, options ...RegisterOption) {
+	t.Helper()
+	Register(name, KindVirtual, newNullDevice, options...)
+	t.Cleanup(func() {
+		mapMu.Lock()
+		defer mapMu.Unlock()
+		delete(Map, name)
+	})
+}
+
+// testPanics returns whether f panics
+func testPanics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestRegisterPanics(t *testing.T) {
+	testRegister(t, "test-registered")
+	for name, f := range map[string]func(){
+		"duplicate name": func() { Register("test-registered", KindVirtual, newNullDevice) },
+		"empty name":     func() { Register("", KindVirtual, newNullDevice) },
+		"nil factory":    func() { Register("test-nil-factory", KindVirtual, nil) },
+	} {
+		if !testPanics(f) {
+			t.Errorf("%s: no panic", name)
+		}
+	}
+	if _, ok := lookupDevice("test-nil-factory"); ok {
+		t.Fatal("device with a nil factory registered")
+	}
+}
+
+func TestRegisterOptions(t *testing.T) {
+	probeErr := errors.New("not plugged in")
+	caps := Capabilities{Channels: []int{2}, MinSamplesPerSecond: 44100, MaxSamplesPerSecond: 44100, SampleFormats: []SampleFormat{SampleFormatInt16}}
+	testRegister(t, "test-options",
+		WithDescription("Test device"),
+		WithProbe(func() error { return probeErr }),
+		WithCapabilities(caps))
+	testRegister(t, "test-caps-func", WithCapabilitiesFunc(func(s Settings) (Capabilities, error) {
+		c := caps
+		c.Channels = []int{s.Channels}
+		return c, nil
+	}))
+
+	var info DeviceInfo
+	for _, i := range ListDevices() {
+		if i.Name == "test-options" {
+			info = i
+		}
+	}
+	if info.Kind != KindVirtual || info.Description != "Test device" || info.ProbeErr != probeErr || info.Available() {
+		t.Fatalf("device info %+v", info)
+	}
+	if err := Probe("test-options"); err != probeErr {
+		t.Fatalf("probe returned %v", err)
+	}
+	if err := Probe("test-caps-func"); err != nil {
+		t.Fatalf("device without a probe returned %v", err)
+	}
+	if err := Probe("test-missing"); !errors.Is(err, ErrDeviceNotSupported) {
+		t.Fatalf("probe of a missing device returned %v", err)
+	}
+
+	if got, err := QueryCapabilities(Settings{Name: "test-options"}); err != nil || !reflect.DeepEqual(got, caps) {
+		t.Fatalf("capabilities %v, %v", got, err)
+	}
+	if got, err := QueryCapabilities(Settings{Name: "test-caps-func", Channels: 6}); err != nil || !reflect.DeepEqual(got.Channels, []int{6}) {
+		t.Fatalf("capabilities %v, %v for the settings", got, err)
+	}
+	// a device without the option takes its defaults
+	if d, _ := lookupDevice("test-caps-func"); d.isDefault || d.Description != "" {
+		t.Fatalf("device details %+v", d)
+	}
+}
+
+func TestListDevicesSorted(t *testing.T) {
+	testRegister(t, "test-b")
+	testRegister(t, "test-a")
+	var names []string
+	for _, i := range ListDevices() {
+		names = append(names, i.Name)
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("devices not sorted by name: %v", names)
+		}
+	}
+}
+
+func TestDefaultDevicesPriority(t *testing.T) {
+	// the priorities are below those of the real devices, so they come last
+	testRegister(t, "test-low", WithDefaultPriority(-20))
+	testRegister(t, "test-high-b", WithDefaultPriority(-10))
+	testRegister(t, "test-high-a", WithDefaultPriority(-10))
+	testRegister(t, "test-not-default")
+	names := DefaultDevices()
+	if len(names) < 3 {
+		t.Fatalf("default devices %v", names)
+	}
+	// higher priorities come first, and equal ones by name
+	if got, want := names[len(names)-3:], []string{"test-high-a", "test-high-b", "test-low"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("default devices end with %v, want %v", got, want)
+	}
+	for _, name := range names {
+		if name == "test-not-default" {
+			t.Fatal("device registered without a default priority is a default device")
+		}
+	}
+}
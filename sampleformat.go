@@ -0,0 +1,209 @@
+package gosound
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/gotracker/gomixing/mixing"
+	"github.com/gotracker/gomixing/volume"
+)
+
+// SampleFormat is the encoding of each sample in the audio stream
+type SampleFormat int
+
+const (
+	// SampleFormatDefault selects the integer sample format matching Settings.BitsPerSample
+	SampleFormatDefault = SampleFormat(iota)
+	// SampleFormatInt8 is 8-bit integer PCM
+	SampleFormatInt8
+	// SampleFormatInt16 is 16-bit integer PCM
+	SampleFormatInt16
+	// SampleFormatInt24 is packed (3 byte) 24-bit integer PCM
+	SampleFormatInt24
+	// SampleFormatInt32 is 32-bit integer PCM
+	SampleFormatInt32
+	// SampleFormatFloat32 is 32-bit IEEE floating point, normalized to [-1, 1]
+	SampleFormatFloat32
+)
+
+// BitsPerSample returns the number of bits used to store each sample
+func (f SampleFormat) BitsPerSample() int {
+	switch f {
+	case SampleFormatInt8:
+		return 8
+	case SampleFormatInt16:
+		return 16
+	case SampleFormatInt24:
+		return 24
+	case SampleFormatInt32, SampleFormatFloat32:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// IsFloat returns true if the samples are floating point
+func (f SampleFormat) IsFloat() bool {
+	return f == SampleFormatFloat32
+}
+
+func (f SampleFormat) String() string {
+	switch f {
+	case SampleFormatDefault:
+		return "default"
+	case SampleFormatInt8:
+		return "int8"
+	case SampleFormatInt16:
+		return "int16"
+	case SampleFormatInt24:
+		return "int24"
+	case SampleFormatInt32:
+		return "int32"
+	case SampleFormatFloat32:
+		return "float32"
+	default:
+		return "unknown"
+	}
+}
+
+// allSampleFormats returns every sample format that can be flattened by a sampleMixer
+func allSampleFormats() []SampleFormat {
+	return []SampleFormat{SampleFormatInt8, SampleFormatInt16, SampleFormatInt24, SampleFormatInt32, SampleFormatFloat32}
+}
+
+// sampleFormatForBits returns the integer sample format with the provided bits per sample
+func sampleFormatForBits(bitsPerSample int) SampleFormat {
+	switch bitsPerSample {
+	case 8:
+		return SampleFormatInt8
+	case 16:
+		return SampleFormatInt16
+	case 24:
+		return SampleFormatInt24
+	case 32:
+		return SampleFormatInt32
+	default:
+		return SampleFormatDefault
+	}
+}
+
+// sampleMixer flattens mixed rows into samples of a sample format.
+// 8- and 16-bit formats are flattened directly by the mixer; the others
+// are flattened at 32 bits, then converted.
+type sampleMixer struct {
+	mixing.Mixer
+	Format SampleFormat
+}
+
+func newSampleMixer(channels int, format SampleFormat) sampleMixer {
+	bits := 32
+	switch format {
+	case SampleFormatInt8, SampleFormatInt16:
+		bits = format.BitsPerSample()
+	}
+	return sampleMixer{
+		Mixer: mixing.Mixer{
+			Channels:      channels,
+			BitsPerSample: bits,
+		},
+		Format: format,
+	}
+}
+
+// Flatten returns the interleaved little-endian sample data for the row
+func (m *sampleMixer) Flatten(panmixer mixing.PanMixer, samplesLen int, row []mixing.ChannelData, mixerVolume volume.Volume) []byte {
+	switch m.Format {
+	case SampleFormatInt8, SampleFormatInt16:
+		return m.Mixer.Flatten(panmixer, samplesLen, row, mixerVolume)
+	}
+
+	data := m.Mixer.FlattenToInts(panmixer, samplesLen, row, mixerVolume)
+	sampleSize := m.Format.BitsPerSample() / 8
+	out := make([]byte, samplesLen*len(data)*sampleSize)
+	pos := 0
+	for i := 0; i < samplesLen; i++ {
+		for _, samples := range data {
+			v := samples[i]
+			switch m.Format {
+			case SampleFormatInt24:
+				v >>= 8
+				out[pos] = byte(v)
+				out[pos+1] = byte(v >> 8)
+				out[pos+2] = byte(v >> 16)
+			case SampleFormatInt32:
+				binary.LittleEndian.PutUint32(out[pos:], uint32(v))
+			case SampleFormatFloat32:
+				binary.LittleEndian.PutUint32(out[pos:], math.Float32bits(int32ToFloat(v)))
+			}
+			pos += sampleSize
+		}
+	}
+	return out
+}
+
+// FlattenToInts returns the sample data for the row, one slice per channel,
+// scaled to the bits per sample of the format
+func (m *sampleMixer) FlattenToInts(panmixer mixing.PanMixer, samplesLen int, row []mixing.ChannelData, mixerVolume volume.Volume) [][]int32 {
+	data := m.Mixer.FlattenToInts(panmixer, samplesLen, row, mixerVolume)
+	if shift := m.Mixer.BitsPerSample - m.Format.BitsPerSample(); shift > 0 {
+		for _, samples := range data {
+			for i := range samples {
+				samples[i] >>= shift
+			}
+		}
+	}
+	return data
+}
+
+// int32ToFloat converts a full-scale 32-bit sample to a float in [-1, 1]
+func int32ToFloat(v int32) float32 {
+	return float32(float64(v) / (1 << 31))
+}
+
+// samplesToFloat returns the sample data of the channels, as produced by
+// sampleMixer.FlattenToInts, scaled to [-1, 1]
+func samplesToFloat(data [][]int32, format SampleFormat) [][]float32 {
+	scale := 1 / float32(int64(1)<<(format.BitsPerSample()-1))
+	out := make([][]float32, len(data))
+	for ch, samples := range data {
+		out[ch] = make([]float32, len(samples))
+		for i, v := range samples {
+			out[ch][i] = float32(v) * scale
+		}
+	}
+	return out
+}
+
+// encodeSamples returns the interleaved sample data of the channels, as
+// produced by sampleMixer.FlattenToInts, in the provided byte order
+func encodeSamples(data [][]int32, format SampleFormat, order binary.ByteOrder) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	sampleSize := format.BitsPerSample() / 8
+	out := make([]byte, len(data[0])*len(data)*sampleSize)
+	pos := 0
+	for i := range data[0] {
+		for _, samples := range data {
+			v := samples[i]
+			switch format {
+			case SampleFormatInt8:
+				out[pos] = byte(v)
+			case SampleFormatInt16:
+				order.PutUint16(out[pos:], uint16(v))
+			case SampleFormatInt24:
+				if order == binary.BigEndian {
+					out[pos], out[pos+1], out[pos+2] = byte(v>>16), byte(v>>8), byte(v)
+				} else {
+					out[pos], out[pos+1], out[pos+2] = byte(v), byte(v>>8), byte(v>>16)
+				}
+			case SampleFormatInt32:
+				order.PutUint32(out[pos:], uint32(v))
+			case SampleFormatFloat32:
+				order.PutUint32(out[pos:], math.Float32bits(int32ToFloat(v)))
+			}
+			pos += sampleSize
+		}
+	}
+	return out
+}
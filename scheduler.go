@@ -0,0 +1,177 @@
+package gosound
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	schedulerMinWait = time.Millisecond
+	schedulerMaxWait = 20 * time.Millisecond
+	// schedulerDrainSlack is the extra time allowed for queued rows to become audible once input ends
+	schedulerDrainSlack = 250 * time.Millisecond
+)
+
+type scheduledRow struct {
+	start uint64
+	row   *PremixData
+}
+
+// rowScheduler delivers DisplayFunc callbacks when the playback position of a
+// device reaches the first frame of each row, instead of when the row is queued
+type rowScheduler struct {
+	kind             Kind
+	onRowOutput      DisplayFunc
+	position         func() Position
+	samplesPerSecond int
+
+	mu      sync.Mutex
+	pending []scheduledRow
+	idle    chan struct{}
+	kick    chan struct{}
+}
+
+func newRowScheduler(kind Kind, onRowOutput DisplayFunc, position func() Position, samplesPerSecond int) *rowScheduler {
+	idle := make(chan struct{})
+	close(idle)
+	return &rowScheduler{
+		kind:             kind,
+		onRowOutput:      onRowOutput,
+		position:         position,
+		samplesPerSecond: samplesPerSecond,
+		idle:             idle,
+		kick:             make(chan struct{}, 1),
+	}
+}
+
+// Schedule queues a row for delivery once the frame at start has been played
+func (s *rowScheduler) Schedule(start uint64, row *PremixData) {
+	if s.onRowOutput == nil {
+		return
+	}
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.pending = append(s.pending, scheduledRow{
+		start: start,
+		row:   row,
+	})
+	s.mu.Unlock()
+	s.Kick()
+}
+
+// Kick wakes the scheduler to recheck the playback position
+func (s *rowScheduler) Kick() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Discard drops all rows that have not been delivered yet
+func (s *rowScheduler) Discard() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setIdle()
+}
+
+// setIdle empties the queue - s.mu must be held
+func (s *rowScheduler) setIdle() {
+	if len(s.pending) != 0 {
+		s.pending = nil
+		close(s.idle)
+	}
+}
+
+// Run delivers the scheduled rows until the context is done
+func (s *rowScheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(schedulerMaxWait)
+	defer timer.Stop()
+	for {
+		wait, ok := s.deliver(false)
+		if !ok {
+			// nothing queued, wait for something to be scheduled
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.kick:
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.kick:
+		case <-timer.C:
+		}
+	}
+}
+
+// Drain waits for all scheduled rows to be delivered. If playback does not
+// catch up within the expected latency, the remaining rows are delivered immediately.
+func (s *rowScheduler) Drain(ctx context.Context) {
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+
+	timeout := s.position().Latency + schedulerDrainSlack
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-idle:
+	case <-timer.C:
+		s.deliver(true)
+	}
+}
+
+// deliver calls the DisplayFunc for every row that has become audible and
+// returns how long to wait before checking again, or false if nothing is pending
+func (s *rowScheduler) deliver(all bool) (time.Duration, bool) {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return 0, false
+	}
+	var played uint64
+	if !all {
+		s.mu.Unlock()
+		played = s.position().Played
+		s.mu.Lock()
+	}
+
+	var ready []scheduledRow
+	for len(s.pending) > 0 && (all || s.pending[0].start <= played) {
+		ready = append(ready, s.pending[0])
+		s.pending = s.pending[1:]
+	}
+	var wait time.Duration
+	pending := len(s.pending) != 0
+	if pending {
+		wait = framesToDuration(s.pending[0].start-played, s.samplesPerSecond)
+	} else if len(ready) != 0 {
+		close(s.idle)
+	}
+	s.mu.Unlock()
+
+	for _, r := range ready {
+		s.onRowOutput(s.kind, r.row)
+	}
+
+	if wait < schedulerMinWait {
+		wait = schedulerMinWait
+	} else if wait > schedulerMaxWait {
+		wait = schedulerMaxWait
+	}
+	return wait, pending
+}
@@ -0,0 +1,122 @@
+package gosound
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testScheduler returns a scheduler of rows whose playback position is given by the frame counter,
+// and the channel to which it delivers the Userdata of each row
+func testScheduler(frames *frameCounter) (*rowScheduler, <-chan interface{}) {
+	delivered := make(chan interface{}, 16)
+	s := newRowScheduler(KindSoundCard, func(kind Kind, row *PremixData) {
+		delivered <- row.Userdata
+	}, func() Position {
+		return frames.position(testSampleRate)
+	}, testSampleRate)
+	return s, delivered
+}
+
+// testDelivered returns the rows delivered within a while
+func testDelivered(delivered <-chan interface{}) []interface{} {
+	var out []interface{}
+	timeout := time.After(testTransportWait)
+	for {
+		select {
+		case r := <-delivered:
+			out = append(out, r)
+		case <-timeout:
+			return out
+		}
+	}
+}
+
+func TestSchedulerDeliversWhenPlayed(t *testing.T) {
+	frames := &frameCounter{}
+	frames.addRendered(10 * testSampleRate)
+	s, delivered := testScheduler(frames)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	for _, start := range []uint64{0, 1000, 2000, 3000} {
+		s.Schedule(start, &PremixData{Userdata: start})
+	}
+	for _, tc := range []struct {
+		played uint64
+		want   []interface{}
+	}{
+		// a row is only delivered once the first of its frames has been played
+		{0, []interface{}{uint64(0)}},
+		{999, nil},
+		{1000, []interface{}{uint64(1000)}},
+		// rows caught up with at once are delivered in order
+		{3500, []interface{}{uint64(2000), uint64(3000)}},
+	} {
+		frames.setPlayed(tc.played)
+		s.Kick()
+		if got := testDelivered(delivered); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("played %d: delivered %v, want %v", tc.played, got, tc.want)
+		}
+	}
+}
+
+func TestSchedulerWakesItself(t *testing.T) {
+	// without being kicked, the scheduler checks the position again before long
+	frames := &frameCounter{}
+	frames.addRendered(testSampleRate)
+	s, delivered := testScheduler(frames)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Schedule(500, &PremixData{Userdata: 1})
+	if got := testDelivered(delivered); got != nil {
+		t.Fatalf("delivered %v before it was played", got)
+	}
+	frames.setPlayed(500)
+	if got := testDelivered(delivered); !reflect.DeepEqual(got, []interface{}{1}) {
+		t.Fatalf("delivered %v", got)
+	}
+}
+
+func TestSchedulerDrain(t *testing.T) {
+	frames := &frameCounter{}
+	frames.addRendered(testSampleRate / 10)
+	s, delivered := testScheduler(frames)
+	for i := 1; i <= 3; i++ {
+		s.Schedule(uint64(i*1000), &PremixData{Userdata: i})
+	}
+
+	// playback never reaches the rows, so they are delivered once the latency and slack have passed
+	start := time.Now()
+	s.Drain(context.Background())
+	if elapsed, timeout := time.Since(start), 100*time.Millisecond+schedulerDrainSlack; elapsed < timeout {
+		t.Fatalf("drained after %v, before the timeout of %v", elapsed, timeout)
+	}
+	if got := testDelivered(delivered); !reflect.DeepEqual(got, []interface{}{1, 2, 3}) {
+		t.Fatalf("delivered %v", got)
+	}
+
+	// with nothing pending, Drain returns at once
+	start = time.Now()
+	s.Drain(context.Background())
+	if elapsed := time.Since(start); elapsed >= schedulerDrainSlack {
+		t.Fatalf("drained nothing in %v", elapsed)
+	}
+}
+
+func TestSchedulerDiscard(t *testing.T) {
+	frames := &frameCounter{}
+	s, delivered := testScheduler(frames)
+	s.Schedule(1000, &PremixData{Userdata: 1})
+	s.Discard()
+	s.Drain(context.Background())
+	frames.addRendered(2000)
+	frames.setPlayed(2000)
+	if _, pending := s.deliver(false); pending || len(delivered) != 0 {
+		t.Fatalf("discarded row delivered")
+	}
+}
@@ -0,0 +1,141 @@
+package gosound
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultName is the name of the pseudo-device that selects the best available output device
+const DefaultName = "default"
+
+// SelectionAttempt is the outcome of trying to create a single device during device selection
+type SelectionAttempt struct {
+	Name string
+	Err  error
+}
+
+// Selection describes which device was chosen by SelectOutputDevice and why the others were not
+type Selection struct {
+	// Name is the name of the chosen device, or empty if none could be created
+	Name string
+	// Attempts is the list of devices tried, in order, including the chosen one
+	Attempts []SelectionAttempt
+}
+
+// SelectionError is returned when none of the candidate devices could be created
+type SelectionError struct {
+	Attempts []SelectionAttempt
+}
+
+func (e *SelectionError) Error() string {
+	if len(e.Attempts) == 0 {
+		return "no output devices available"
+	}
+	var sb strings.Builder
+	sb.WriteString("no usable output device: ")
+	for i, a := range e.Attempts {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(a.Name)
+		sb.WriteString(": ")
+		sb.WriteString(a.Err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap allows a SelectionError to match ErrDeviceNotSupported
+func (e *SelectionError) Unwrap() error {
+	return ErrDeviceNotSupported
+}
+
+// DefaultDevices returns the names of the devices tried by the "default" device, in priority order
+func DefaultDevices() []string {
+	type candidate struct {
+		name     string
+		priority int
+	}
+
+	mapMu.RLock()
+	var candidates []candidate
+	for name, details := range Map {
+		if details.isDefault {
+			candidates = append(candidates, candidate{
+				name:     name,
+				priority: details.defaultPriority,
+			})
+		}
+	}
+	mapMu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.name
+	}
+	return names
+}
+
+func selectionCandidates(settings Settings) []string {
+	names := append([]string{settings.Name}, settings.Fallbacks...)
+
+	var candidates []string
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		expanded := []string{name}
+		if name == DefaultName {
+			expanded = DefaultDevices()
+		}
+		for _, n := range expanded {
+			if _, dup := seen[n]; dup {
+				continue
+			}
+			seen[n] = struct{}{}
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+// SelectOutputDevice creates the first available output device from the device
+// named in settings, followed by the devices named in settings.Fallbacks.
+// The "default" name expands to the registered devices in priority order.
+func SelectOutputDevice(settings Settings) (Device, Selection, error) {
+	candidates := selectionCandidates(settings)
+	if len(candidates) == 1 && settings.Name != DefaultName {
+		// a single explicitly named device reports its own error
+		dev, err := createNamedOutputDevice(settings)
+		sel := Selection{
+			Attempts: []SelectionAttempt{{Name: settings.Name, Err: err}},
+		}
+		if err == nil {
+			sel.Name = settings.Name
+		}
+		return dev, sel, err
+	}
+
+	var sel Selection
+	for _, name := range candidates {
+		s := settings
+		s.Name = name
+		dev, err := createNamedOutputDevice(s)
+		sel.Attempts = append(sel.Attempts, SelectionAttempt{
+			Name: name,
+			Err:  err,
+		})
+		if err == nil {
+			sel.Name = name
+			return dev, sel, nil
+		}
+	}
+
+	return nil, sel, &SelectionError{
+		Attempts: sel.Attempts,
+	}
+}
@@ -0,0 +1,48 @@
+package gosound
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func init() {
+	Register("test-unavailable", KindSoundCard, func(Settings) (Device, error) {
+		return nil, errors.New("unavailable")
+	}, WithDefaultPriority(1000))
+}
+
+func TestSelectionCandidatesDefaultWithFallbacks(t *testing.T) {
+	got := selectionCandidates(Settings{
+		Name:      DefaultName,
+		Fallbacks: []string{nullName},
+	})
+	var want []string
+	for _, name := range DefaultDevices() {
+		if name != nullName {
+			want = append(want, name)
+		}
+	}
+	want = append(want, nullName)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("candidates = %v, want %v", got, want)
+	}
+	if got[0] != "test-unavailable" {
+		t.Fatalf("highest priority default device not tried first: %v", got)
+	}
+}
+
+func TestSelectOutputDeviceFallsBack(t *testing.T) {
+	dev, sel, err := SelectOutputDevice(Settings{
+		Name:      DefaultName,
+		Fallbacks: []string{nullName},
+		Channels:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	if sel.Name == "" || sel.Attempts[0].Name != "test-unavailable" || sel.Attempts[0].Err == nil {
+		t.Fatalf("unexpected selection %+v", sel)
+	}
+}
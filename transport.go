@@ -0,0 +1,117 @@
+package gosound
+
+import (
+	"context"
+	"sync"
+)
+
+// Controllable is an interface to the transport controls of an output device.
+// A control the device cannot carry out returns ErrTransportNotSupported.
+type Controllable interface {
+	// Pause holds playback at the current position
+	Pause() error
+	// Resume continues playback after a Pause
+	Resume() error
+	// Flush discards any audio queued on the device that has not been played yet
+	Flush() error
+	// Stop ends playback, causing Play/PlayWithCtx to return
+	Stop() error
+}
+
+// GetControllable returns the transport controls of the passed in device, if it supports them
+func GetControllable(d Device) (Controllable, bool) {
+	c, ok := d.(Controllable)
+	return c, ok
+}
+
+type transport struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	stopped chan struct{}
+	stop    bool
+}
+
+func newTransport() *transport {
+	return &transport{
+		stopped: make(chan struct{}),
+	}
+}
+
+func (t *transport) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused {
+		t.paused = true
+		t.resumed = make(chan struct{})
+	}
+}
+
+func (t *transport) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		t.paused = false
+		close(t.resumed)
+	}
+}
+
+func (t *transport) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.stop {
+		t.stop = true
+		close(t.stopped)
+	}
+}
+
+// reset rearms the transport after a Stop so that playback may start again. It is deferred by
+// Play, so that a Stop made before Play started ends that Play at once rather than being lost.
+func (t *transport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop {
+		t.stop = false
+		t.stopped = make(chan struct{})
+	}
+}
+
+func (t *transport) state() (resumed <-chan struct{}, stopped <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		resumed = t.resumed
+	}
+	return resumed, t.stopped
+}
+
+// nextRow waits out any pause, then returns the next row to play.
+// A nil row is returned when the input is exhausted or the transport was stopped.
+func (t *transport) nextRow(ctx context.Context, in <-chan *PremixData) (*PremixData, error) {
+	for {
+		resumed, stopped := t.state()
+		if resumed == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-stopped:
+			return nil, nil
+		case <-resumed:
+		}
+	}
+
+	_, stopped := t.state()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-stopped:
+		return nil, nil
+	case row, ok := <-in:
+		if !ok {
+			return nil, nil
+		}
+		return row, nil
+	}
+}
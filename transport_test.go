@@ -0,0 +1,135 @@
+package gosound
+
+import (
+	"testing"
+	"time"
+)
+
+// testTransportWait is how long a test waits for something that should happen, or to be sure it does not
+const testTransportWait = 50 * time.Millisecond
+
+// testTransportDevice creates the device, with the transport controls
+func testTransportDevice(t *testing.T, name string) (Device, Controllable) {
+	t.Helper()
+	d, err := CreateOutputDevice(testSettings(Settings{Name: name}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := GetControllable(d)
+	if !ok {
+		t.Fatalf("%s: no transport controls", name)
+	}
+	return d, c
+}
+
+// testPlayAsync plays the input on the device, returning the result of Play once it returns
+func testPlayAsync(d Device, in <-chan *PremixData) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Play(in)
+	}()
+	return done
+}
+
+// testPlayReturned checks that Play returns nil within a while
+func testPlayReturned(t *testing.T, name string, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s: Play returned %v", name, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s: Play did not return", name)
+	}
+}
+
+// testSendRow sends a row to the device, returning whether it was taken within a while
+func testSendRow(in chan<- *PremixData, row *PremixData) bool {
+	select {
+	case in <- row:
+		return true
+	case <-time.After(testTransportWait):
+		return false
+	}
+}
+
+func TestTransportStopBeforePlay(t *testing.T) {
+	rows := testSignal(2, 5, testRowLen, testSampleRate)
+	for _, name := range []string{nullName, memoryName} {
+		d, c := testTransportDevice(t, name)
+		if err := c.Stop(); err != nil {
+			t.Fatalf("%s: Stop returned %v", name, err)
+		}
+		// the input never ends, so only the Stop can end Play
+		testPlayReturned(t, name, testPlayAsync(d, make(chan *PremixData)))
+
+		// the Stop ended that Play only, so the next one plays its input
+		testPlayReturned(t, name, testPlayAsync(d, testRowChan(rows)))
+		if p, _ := GetPosition(d); p.Rendered != 5*testRowLen {
+			t.Fatalf("%s: %d frames rendered after the Stop, want %d", name, p.Rendered, 5*testRowLen)
+		}
+		d.Close()
+	}
+}
+
+func TestTransportPauseResumeStop(t *testing.T) {
+	row := testSignal(2, 1, testRowLen, testSampleRate)[0]
+	for _, name := range []string{nullName, memoryName} {
+		d, c := testTransportDevice(t, name)
+		in := make(chan *PremixData)
+		if err := c.Pause(); err != nil {
+			t.Fatalf("%s: Pause returned %v", name, err)
+		}
+		done := testPlayAsync(d, in)
+		if testSendRow(in, row) {
+			t.Fatalf("%s: row taken while paused", name)
+		}
+
+		if err := c.Resume(); err != nil {
+			t.Fatalf("%s: Resume returned %v", name, err)
+		}
+		for i := 0; i < 3; i++ {
+			if !testSendRow(in, row) {
+				t.Fatalf("%s: row %d not taken after Resume", name, i)
+			}
+		}
+
+		if err := c.Stop(); err != nil {
+			t.Fatalf("%s: Stop returned %v", name, err)
+		}
+		testPlayReturned(t, name, done)
+		if p, _ := GetPosition(d); p.Rendered != 3*testRowLen {
+			t.Fatalf("%s: %d frames rendered, want %d", name, p.Rendered, 3*testRowLen)
+		}
+		d.Close()
+	}
+}
+
+func TestTransportStopWhilePaused(t *testing.T) {
+	for _, name := range []string{nullName, memoryName} {
+		d, c := testTransportDevice(t, name)
+		done := testPlayAsync(d, make(chan *PremixData))
+		_ = c.Pause()
+		_ = c.Stop()
+		testPlayReturned(t, name, done)
+		d.Close()
+	}
+}
+
+func TestTransportFlush(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		// these devices keep no queue of audio, so there is nothing to discard
+		{nullName, nil},
+		{memoryName, nil},
+	} {
+		d, c := testTransportDevice(t, tc.name)
+		if err := c.Flush(); err != tc.err {
+			t.Fatalf("%s: Flush returned %v, want %v", tc.name, err, tc.err)
+		}
+		d.Close()
+	}
+}